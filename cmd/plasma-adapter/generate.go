@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const vmImport = "github.com/shoriwe/plasma/pkg/vm"
+
+type (
+	/*
+		declaration is the interface to adapt and the file declaring it
+	*/
+	declaration struct {
+		fileSet       *token.FileSet
+		file          *ast.File
+		name          string
+		interfaceType *ast.InterfaceType
+	}
+	/*
+		adapterMethod is a method of the interface with a name for every argument
+	*/
+	adapterMethod struct {
+		name      string
+		signature string // Function type with the argument names
+		arguments string // Arguments forwarded to the script method
+		results   bool
+	}
+)
+
+/*
+generate writes the adapter of the interface declared in the package of the directory
+*/
+func generate(directory, interfaceName, output string) error {
+	found, findError := findInterface(directory, interfaceName)
+	if findError != nil {
+		return findError
+	}
+	source, sourceError := found.adapter()
+	if sourceError != nil {
+		return sourceError
+	}
+	if output == "" {
+		output = strings.ToLower(interfaceName) + "_plasma.go"
+	}
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(directory, output)
+	}
+	return os.WriteFile(output, source, 0644)
+}
+
+/*
+findInterface parses the Go files of the directory, test files excluded, looking for the interface
+*/
+func findInterface(directory, interfaceName string) (*declaration, error) {
+	files, globError := filepath.Glob(filepath.Join(directory, "*.go"))
+	if globError != nil {
+		return nil, globError
+	}
+	fileSet := token.NewFileSet()
+	for _, fileName := range files {
+		if strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+		file, parseError := parser.ParseFile(fileSet, fileName, nil, parser.ParseComments)
+		if parseError != nil {
+			return nil, parseError
+		}
+		for _, decl := range file.Decls {
+			genDecl, isGenDecl := decl.(*ast.GenDecl)
+			if !isGenDecl || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if typeSpec.Name.Name != interfaceName {
+					continue
+				}
+				interfaceType, isInterface := typeSpec.Type.(*ast.InterfaceType)
+				if !isInterface {
+					return nil, fmt.Errorf("%s is not an interface", interfaceName)
+				}
+				if typeSpec.TypeParams != nil {
+					return nil, fmt.Errorf("%s: generic interfaces are not supported", interfaceName)
+				}
+				return &declaration{
+					fileSet:       fileSet,
+					file:          file,
+					name:          interfaceName,
+					interfaceType: interfaceType,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found in %s", interfaceName, directory)
+}
+
+/*
+adapter returns the formatted source of the adapter
+*/
+func (found *declaration) adapter() ([]byte, error) {
+	var methods []adapterMethod
+	packages := map[string]struct{}{}
+	for _, field := range found.interfaceType.Methods.List {
+		functionType, isFunction := field.Type.(*ast.FuncType)
+		if !isFunction || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported, declare their methods", found.name)
+		}
+		ast.Inspect(functionType, func(node ast.Node) bool {
+			if selector, isSelector := node.(*ast.SelectorExpr); isSelector {
+				if packageName, isIdent := selector.X.(*ast.Ident); isIdent {
+					packages[packageName.Name] = struct{}{}
+				}
+			}
+			return true
+		})
+		for _, name := range field.Names {
+			method, methodError := found.method(name.Name, functionType)
+			if methodError != nil {
+				return nil, methodError
+			}
+			methods = append(methods, method)
+		}
+	}
+	imports, importsError := found.imports(packages)
+	if importsError != nil {
+		return nil, importsError
+	}
+	adapterType := lowerFirst(found.name) + "PlasmaAdapter"
+	register := "Register" + upperFirst(found.name) + "Adapter"
+	if !ast.IsExported(found.name) {
+		register = lowerFirst(register)
+	}
+	source := &bytes.Buffer{}
+	fmt.Fprintf(source, "// Code generated by plasma-adapter -type %s; DO NOT EDIT.\n\n", found.name)
+	fmt.Fprintf(source, "package %s\n\nimport (\n", found.file.Name.Name)
+	for _, line := range imports {
+		fmt.Fprintf(source, "\t%s\n", line)
+	}
+	fmt.Fprintf(source, ")\n\n")
+	fmt.Fprintf(source, "/*\n%s calls the methods of a script object implementing %s\n*/\n", adapterType, found.name)
+	fmt.Fprintf(source, "type %s struct {\n\tobject vm.ScriptObject\n}\n\n", adapterType)
+	fmt.Fprintf(source, "/*\n%s registers in the VM the adapter vm.Implement uses to return script objects as %s\n*/\n", register, found.name)
+	fmt.Fprintf(source, "func %s(plasma *vm.Plasma) {\n", register)
+	fmt.Fprintf(source, "\tvm.RegisterInterface[%s](plasma, func(object vm.ScriptObject) %[1]s {\n", found.name)
+	fmt.Fprintf(source, "\t\treturn %s{object: object}\n\t})\n}\n", adapterType)
+	for _, method := range methods {
+		call := fmt.Sprintf("vm.Method[%s](adapter.object, %q)(%s)", method.signature, method.name, method.arguments)
+		if method.results {
+			call = "return " + call
+		}
+		fmt.Fprintf(source, "\nfunc (adapter %s) %s%s {\n\t%s\n}\n",
+			adapterType, method.name, strings.TrimPrefix(method.signature, "func"), call)
+	}
+	return format.Source(source.Bytes())
+}
+
+/*
+method names the arguments of the method, so they can be forwarded
+*/
+func (found *declaration) method(name string, functionType *ast.FuncType) (adapterMethod, error) {
+	var (
+		parameters []string
+		arguments  []string
+	)
+	index := 0
+	for _, field := range functionType.Params.List {
+		typeSource, typeError := found.source(field.Type)
+		if typeError != nil {
+			return adapterMethod{}, typeError
+		}
+		names := len(field.Names)
+		if names == 0 {
+			names = 1
+		}
+		for count := 0; count < names; count++ {
+			argument := "argument" + strconv.Itoa(index)
+			index++
+			parameters = append(parameters, argument+" "+typeSource)
+			if _, isVariadic := field.Type.(*ast.Ellipsis); isVariadic {
+				argument += "..."
+			}
+			arguments = append(arguments, argument)
+		}
+	}
+	results := ""
+	if functionType.Results != nil && len(functionType.Results.List) > 0 {
+		var resultTypes []string
+		for _, field := range functionType.Results.List {
+			typeSource, typeError := found.source(field.Type)
+			if typeError != nil {
+				return adapterMethod{}, typeError
+			}
+			for count := 0; count < len(field.Names) || count == 0; count++ {
+				resultTypes = append(resultTypes, typeSource)
+			}
+		}
+		results = " " + strings.Join(resultTypes, ", ")
+		if len(resultTypes) > 1 {
+			results = " (" + strings.Join(resultTypes, ", ") + ")"
+		}
+	}
+	return adapterMethod{
+		name:      name,
+		signature: "func(" + strings.Join(parameters, ", ") + ")" + results,
+		arguments: strings.Join(arguments, ", "),
+		results:   results != "",
+	}, nil
+}
+
+/*
+imports returns the import lines of the packages used by the methods, resolved with the imports of the file
+*/
+func (found *declaration) imports(packages map[string]struct{}) ([]string, error) {
+	lines := []string{strconv.Quote(vmImport)}
+	for _, spec := range found.file.Imports {
+		importPath, unquoteError := strconv.Unquote(spec.Path.Value)
+		if unquoteError != nil {
+			return nil, unquoteError
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if _, used := packages[name]; !used {
+			continue
+		}
+		delete(packages, name)
+		if importPath == vmImport && spec.Name == nil {
+			continue
+		}
+		if spec.Name != nil {
+			lines = append(lines, spec.Name.Name+" "+spec.Path.Value)
+		} else {
+			lines = append(lines, spec.Path.Value)
+		}
+	}
+	delete(packages, "vm")
+	if len(packages) > 0 {
+		var missing []string
+		for name := range packages {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%s: could not resolve the imports of %s", found.name, strings.Join(missing, ", "))
+	}
+	sort.Strings(lines[1:])
+	return lines, nil
+}
+
+func (found *declaration) source(node ast.Node) (string, error) {
+	result := &bytes.Buffer{}
+	if printError := printer.Fprint(result, found.fileSet, node); printError != nil {
+		return "", printError
+	}
+	return result.String(), nil
+}
+
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func upperFirst(s string) string {
+	runes := []rune(s)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
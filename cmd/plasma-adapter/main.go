@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const helpMessage = `Usage: %s -type INTERFACE [-output FILE] [DIRECTORY]
+
+Generates the adapter vm.Implement uses to return script objects as the Go interface declared in the
+package of DIRECTORY, the current directory by default. Use it from a go:generate directive:
+
+	//go:generate go run github.com/shoriwe/plasma/cmd/plasma-adapter -type Handler
+
+The generated file declares RegisterHandlerAdapter, which registers the adapter in a VM
+`
+
+func main() {
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), helpMessage, os.Args[0])
+	}
+	interfaceName := flags.String("type", "", "name of the interface")
+	output := flags.String("output", "", "generated file, <interface>_plasma.go by default")
+	_ = flags.Parse(os.Args[1:])
+	directory := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		directory = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+	if *interfaceName == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if generateError := generate(directory, *interfaceName, *output); generateError != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "plasma-adapter: %s\n", generateError)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/dap"
+	"os"
+)
+
+const debugHelpMessage = `Usage: %s -debug
+
+Serves the Debug Adapter Protocol over stdin and stdout, editors launch the script to debug with
+the "program" argument of the launch request
+`
+
+func debug() {
+	if len(os.Args) != 2 {
+		fmt.Printf(debugHelpMessage, os.Args[0])
+		os.Exit(1)
+	}
+	if serveError := dap.Serve(os.Stdin, os.Stdout); serveError != nil {
+		onError("dap", serveError)
+		os.Exit(1)
+	}
+}
@@ -1,36 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"github.com/shoriwe/plasma/pkg/compiler"
 	"github.com/shoriwe/plasma/pkg/vm"
 	"os"
 )
 
 func executeFiles() {
-	for _, arg := range os.Args {
+	names := make([]string, 0, len(os.Args[1:]))
+	for index, arg := range os.Args[1:] {
+		if arg == "--" {
+			names = append(names, os.Args[index+2:]...)
+			break
+		}
 		switch arg {
 		case "-h", "--help":
 			help()
 		}
+		names = append(names, arg)
 	}
-	files := make([][]byte, 0, len(os.Args[1:]))
-	for _, file := range os.Args[1:] {
+	files := make([][]byte, 0, len(names))
+	for _, file := range names {
 		contents, readError := os.ReadFile(file)
 		if readError != nil {
 			onError(file, readError)
 		}
 		files = append(files, contents)
 	}
-	plasma := vm.NewVM(os.Stdin, os.Stdout, os.Stderr)
+	// The VM flushes the output when a script reads its input or ends, and when it calls flush
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	plasma := vm.NewVM(os.Stdin, stdout, os.Stderr)
 	for index, file := range files {
 		bytecode, compileError := compiler.Compile(string(file))
 		if compileError != nil {
-			onError(os.Args[1:][index], compileError)
+			onError(names[index], compileError)
 		}
 		_, errorChan, _ := plasma.Execute(bytecode)
 		executeError := <-errorChan
 		if executeError != nil {
-			onError(os.Args[1:][index], executeError)
+			onError(names[index], executeError)
 		}
 	}
 }
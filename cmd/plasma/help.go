@@ -5,9 +5,12 @@ import (
 	"os"
 )
 
-const helpMessage = `Usage: %s [FILE [FILE [FILE [...]]]]
+const helpMessage = `Usage: %s [--] [FILE [FILE [FILE [...]]]]
+       %[1]s -debug
 
-Zero arguments will start the REPL'`
+Zero arguments will start the REPL'
+Arguments after -- are always files, even when they start with a dash
+The -debug flag serves the Debug Adapter Protocol over stdio`
 
 func help() {
 	fmt.Printf(helpMessage, os.Args[0])
@@ -7,7 +7,9 @@ import (
 func main() {
 	if len(os.Args) == 1 {
 		repl()
-	} else if len(os.Args) > 1 {
+	} else if os.Args[1] == "-debug" {
+		debug()
+	} else {
 		executeFiles()
 	}
 }
@@ -31,17 +31,21 @@ func splitFunc() bufio.SplitFunc {
 }
 
 func repl() {
+	// The VM flushes the output when a script reads its input or ends, and when it calls flush
+	stdout := bufio.NewWriter(os.Stdout)
 	defer func() {
+		_ = stdout.Flush()
 		err := recover()
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 	}()
-	plasma := vm.NewVM(os.Stdin, os.Stdout, os.Stderr)
+	plasma := vm.NewVM(os.Stdin, stdout, os.Stderr)
 	plasma.Load("exit", func(plasma *vm.Plasma) *vm.Value {
 		return plasma.NewBuiltInFunction(plasma.RootSymbols(),
 			func(argument ...*vm.Value) (*vm.Value, error) {
+				_ = stdout.Flush()
 				if len(argument) == 0 {
 					os.Exit(0)
 				} else {
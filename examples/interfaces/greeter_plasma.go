@@ -0,0 +1,35 @@
+// Code generated by plasma-adapter -type Greeter; DO NOT EDIT.
+
+package main
+
+import (
+	"github.com/shoriwe/plasma/pkg/vm"
+)
+
+/*
+greeterPlasmaAdapter calls the methods of a script object implementing Greeter
+*/
+type greeterPlasmaAdapter struct {
+	object vm.ScriptObject
+}
+
+/*
+RegisterGreeterAdapter registers in the VM the adapter vm.Implement uses to return script objects as Greeter
+*/
+func RegisterGreeterAdapter(plasma *vm.Plasma) {
+	vm.RegisterInterface[Greeter](plasma, func(object vm.ScriptObject) Greeter {
+		return greeterPlasmaAdapter{object: object}
+	})
+}
+
+func (adapter greeterPlasmaAdapter) Greet(argument0 string) (string, error) {
+	return vm.Method[func(argument0 string) (string, error)](adapter.object, "Greet")(argument0)
+}
+
+func (adapter greeterPlasmaAdapter) Names(argument0 string, argument1 ...string) []string {
+	return vm.Method[func(argument0 string, argument1 ...string) []string](adapter.object, "Names")(argument0, argument1...)
+}
+
+func (adapter greeterPlasmaAdapter) Reset() {
+	vm.Method[func()](adapter.object, "Reset")()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/vm"
+	"os"
+	"strings"
+)
+
+//go:generate go run github.com/shoriwe/plasma/cmd/plasma-adapter -type Greeter
+
+type Greeter interface {
+	Greet(name string) (string, error)
+	Names(prefix string, names ...string) []string
+	Reset()
+}
+
+const greeterScript = `
+class Greeter
+	def __init__(greeting)
+		self.greeting = greeting
+	end
+	def Greet(name)
+		if name == ""
+			return 1 / none
+		end
+		return self.greeting + " " + name
+	end
+	def Names(prefix, names)
+		result = []
+		for name in names
+			result.append(prefix + name)
+		end
+		return result
+	end
+	def Reset()
+		self.greeting = "Hello"
+	end
+end
+Greeter("Hi")
+`
+
+func main() {
+	plasma := vm.NewVM(os.Stdin, os.Stdout, os.Stderr)
+	RegisterGreeterAdapter(plasma)
+	rCh, errCh, _ := plasma.ExecuteString(greeterScript)
+	if err := <-errCh; err != nil {
+		panic(err)
+	}
+	greeter, implementError := vm.Implement[Greeter](plasma, <-rCh)
+	if implementError != nil {
+		panic(implementError)
+	}
+	greeting, greetError := greeter.Greet("Plasma")
+	fmt.Println(greeting, greetError)
+	_, greetError = greeter.Greet("")
+	fmt.Println(greetError != nil)
+	greeter.Reset()
+	greeting, _ = greeter.Greet("again")
+	fmt.Println(greeting, strings.Join(greeter.Names("@", "a", "b"), " "))
+}
@@ -150,4 +150,12 @@ type (
 		Statement
 		X *MethodInvocationExpression
 	}
+
+	/*
+		LineStatement marks the source line of the statements following it, it is never produced by the parser
+	*/
+	LineStatement struct {
+		Statement
+		Line int
+	}
 )
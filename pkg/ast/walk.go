@@ -186,7 +186,7 @@ func walk(visitor Visitor, node Node) {
 		}
 	case *DeleteStatement:
 		walk(visitor, n.X)
-	case *PassStatement:
+	case *PassStatement, *LineStatement:
 		return
 	case nil:
 		break // Ignore nil
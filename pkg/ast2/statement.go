@@ -69,6 +69,10 @@ type (
 	Pass struct {
 		Statement
 	}
+	Line struct {
+		Statement
+		Number int
+	}
 
 	Delete struct {
 		Statement
@@ -11,6 +11,7 @@ type (
 	}
 	Function struct {
 		Expression
+		Name      string // Empty for anonymous functions
 		Arguments []*Identifier
 		Body      []Node
 	}
@@ -24,6 +25,15 @@ type (
 		Function  Expression
 		Arguments []Expression
 	}
+	/*
+		Binary operations resolve to Operator magic method of Left, the VM executes them directly
+		when both operands are primitive values
+	*/
+	Binary struct {
+		Expression
+		Operator    string
+		Left, Right Expression
+	}
 
 	Array struct {
 		Expression
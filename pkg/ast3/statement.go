@@ -39,4 +39,8 @@ type (
 		Statement
 		X Expression
 	}
+	Line struct {
+		Statement
+		Number int
+	}
 )
@@ -0,0 +1,30 @@
+package assembler
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/ast3"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+)
+
+var binaryOpcodes = func() map[string]byte {
+	result := make(map[string]byte, len(opcodes.BinaryOperations))
+	for op, function := range opcodes.BinaryOperations {
+		result[function] = op
+	}
+	return result
+}()
+
+func (a *assembler) Binary(binary *ast3.Binary) []byte {
+	op, found := binaryOpcodes[binary.Operator]
+	if !found {
+		panic(fmt.Sprintf("unknown binary operator %s", binary.Operator))
+	}
+	// Operands are evaluated in the same order as in a magic method call, arguments first
+	var result []byte
+	result = append(result, a.Expression(binary.Right)...)
+	result = append(result, opcodes.Push)
+	result = append(result, a.Expression(binary.Left)...)
+	result = append(result, opcodes.Push)
+	result = append(result, op)
+	return result
+}
@@ -17,6 +17,8 @@ func (a *assembler) Expression(expr ast3.Expression) []byte {
 		return a.Class(e)
 	case *ast3.Call:
 		return a.Call(e)
+	case *ast3.Binary:
+		return a.Binary(e)
 	case *ast3.Array:
 		return a.Array(e)
 	case *ast3.Tuple:
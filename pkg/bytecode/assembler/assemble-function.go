@@ -18,6 +18,8 @@ func (a *assembler) Function(function *ast3.Function) []byte {
 	}
 	var result []byte
 	result = append(result, opcodes.NewFunction)
+	result = append(result, common.IntToBytes(len(function.Name))...)
+	result = append(result, []byte(function.Name)...)
 	result = append(result, common.IntToBytes(len(function.Arguments))...)
 	result = append(result, arguments...)
 	result = append(result, common.IntToBytes(len(body))...)
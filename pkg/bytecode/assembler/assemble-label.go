@@ -11,3 +11,9 @@ func (a *assembler) Label(label *ast3.Label) []byte {
 	result = append(result, common.IntToBytes(label.Code)...)
 	return result
 }
+
+func (a *assembler) Line(line *ast3.Line) []byte {
+	result := []byte{opcodes.Line}
+	result = append(result, common.IntToBytes(line.Number)...)
+	return result
+}
@@ -28,6 +28,8 @@ func (a *assembler) Statement(stmt ast3.Statement) []byte {
 		return a.Delete(s)
 	case *ast3.Defer:
 		return a.Defer(s)
+	case *ast3.Line:
+		return a.Line(s)
 	default:
 		panic(fmt.Sprintf("unknown type of statement %s", reflect.TypeOf(s).String()))
 	}
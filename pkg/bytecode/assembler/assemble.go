@@ -9,11 +9,15 @@ import (
 )
 
 type (
-	assembler struct{}
+	assembler struct {
+		optimize bool
+	}
 )
 
-func newAssembler() *assembler {
-	return &assembler{}
+func newAssembler(optimize bool) *assembler {
+	return &assembler{
+		optimize: optimize,
+	}
 }
 
 func (a *assembler) assemble(node ast3.Node) []byte {
@@ -72,8 +76,13 @@ func (a *assembler) enumLabels(bytecode []byte) map[int64]int64 {
 		case opcodes.Defer:
 			index++
 			index += 8
+		case opcodes.Line:
+			index++
+			index += 8
 		case opcodes.NewFunction:
 			index++
+			nameLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8 + nameLength
 			argsNumber := common.BytesToInt(bytecode[index : index+8])
 			index += 8
 			for arg := int64(0); arg < argsNumber; arg++ {
@@ -127,6 +136,11 @@ func (a *assembler) enumLabels(bytecode []byte) map[int64]int64 {
 			index += 8 + symbolLength
 		case opcodes.Super:
 			index++
+		case opcodes.Add, opcodes.Sub, opcodes.Mul, opcodes.Div, opcodes.FloorDiv, opcodes.Modulus, opcodes.PowerOf,
+			opcodes.BitwiseOr, opcodes.BitwiseXor, opcodes.BitwiseAnd, opcodes.BitwiseLeft, opcodes.BitwiseRight,
+			opcodes.Equal, opcodes.NotEqual, opcodes.GreaterThan, opcodes.GreaterOrEqualThan, opcodes.LessThan,
+			opcodes.LessOrEqualThan:
+			index++
 		default:
 			panic(fmt.Sprintf("unknown opcode %d in %v", op, bytecode[index-5:]))
 		}
@@ -179,8 +193,13 @@ func (a *assembler) resolveLabels(bytecode []byte, labels map[int64]int64) []byt
 		case opcodes.Defer:
 			index++
 			index += 8
+		case opcodes.Line:
+			index++
+			index += 8
 		case opcodes.NewFunction:
 			index++
+			nameLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8 + nameLength
 			argsNumber := common.BytesToInt(bytecode[index : index+8])
 			index += 8
 			for arg := int64(0); arg < argsNumber; arg++ {
@@ -234,6 +253,11 @@ func (a *assembler) resolveLabels(bytecode []byte, labels map[int64]int64) []byt
 			index += 8 + symbolLength
 		case opcodes.Super:
 			index++
+		case opcodes.Add, opcodes.Sub, opcodes.Mul, opcodes.Div, opcodes.FloorDiv, opcodes.Modulus, opcodes.PowerOf,
+			opcodes.BitwiseOr, opcodes.BitwiseXor, opcodes.BitwiseAnd, opcodes.BitwiseLeft, opcodes.BitwiseRight,
+			opcodes.Equal, opcodes.NotEqual, opcodes.GreaterThan, opcodes.GreaterOrEqualThan, opcodes.LessThan,
+			opcodes.LessOrEqualThan:
+			index++
 		default:
 			panic(fmt.Sprintf("unknown opcode %d in %v", op, bytecode[index-5:]))
 		}
@@ -257,19 +281,36 @@ func (a *assembler) Assemble(program ast3.Program) ([]byte, error) {
 			chunk := a.assemble(node)
 			bytecode = append(bytecode, chunk...)
 		}
+		if a.optimize {
+			bytecode = a.peephole(bytecode)
+		}
 		labels := a.enumLabels(bytecode)
-		rChan <- a.resolveLabels(bytecode, labels)
+		program := make([]byte, 0, opcodes.HeaderLength+len(bytecode))
+		program = append(program, opcodes.Magic...)
+		program = append(program, common.IntToBytes(opcodes.FormatVersion)...)
+		rChan <- append(program, a.resolveLabels(bytecode, labels)...)
 		eChan <- nil
 	}(resultChan, errorChan)
 	return <-resultChan, <-errorChan
 }
 
 func AssembleAny(node ast3.Node) ([]byte, error) {
-	a := newAssembler()
+	a := newAssembler(false)
 	return a.Assemble(ast3.Program{node})
 }
 
+/*
+Assemble assembles the program, the bytecode starts with the format header described by opcodes.Magic
+*/
 func Assemble(program ast3.Program) ([]byte, error) {
-	a := newAssembler()
+	a := newAssembler(false)
+	return a.Assemble(program)
+}
+
+/*
+AssembleOptimized assembles the program removing redundant instruction sequences from the result
+*/
+func AssembleOptimized(program ast3.Program) ([]byte, error) {
+	a := newAssembler(true)
 	return a.Assemble(program)
 }
@@ -1,6 +1,8 @@
 package assembler
 
 import (
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/shoriwe/plasma/pkg/common"
 	"github.com/shoriwe/plasma/pkg/lexer"
 	"github.com/shoriwe/plasma/pkg/parser"
 	"github.com/shoriwe/plasma/pkg/passes/simplification"
@@ -29,3 +31,20 @@ func test(t *testing.T, samples map[string]string) {
 func TestSampleScript(t *testing.T) {
 	test(t, basic.Samples)
 }
+
+func TestPeephole(t *testing.T) {
+	a := newAssembler(true)
+	function := []byte{opcodes.NewFunction}
+	function = append(function, common.IntToBytes(1)...)
+	function = append(function, 'f')
+	function = append(function, common.IntToBytes(0)...)
+	function = append(function, common.IntToBytes(3)...)
+	function = append(function, opcodes.None, opcodes.Push, opcodes.Pop)
+	expect := []byte{opcodes.NewFunction}
+	expect = append(expect, common.IntToBytes(1)...)
+	expect = append(expect, 'f')
+	expect = append(expect, common.IntToBytes(0)...)
+	expect = append(expect, common.IntToBytes(1)...)
+	expect = append(expect, opcodes.None)
+	assert.Equal(t, expect, a.peephole(function))
+}
@@ -0,0 +1,88 @@
+package assembler
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/shoriwe/plasma/pkg/common"
+)
+
+/*
+peephole removes redundant instruction sequences from bytecode with unresolved labels,
+nested function, class and defer bodies are rebuilt with their new lengths
+*/
+func (a *assembler) peephole(bytecode []byte) []byte {
+	bytecodeLength := int64(len(bytecode))
+	result := make([]byte, 0, bytecodeLength)
+	for index := int64(0); index < bytecodeLength; {
+		op := bytecode[index]
+		start := index
+		switch op {
+		case opcodes.Push:
+			index++
+			// Push followed by Pop leaves both the stack and the register untouched
+			if index < bytecodeLength && bytecode[index] == opcodes.Pop {
+				index++
+				continue
+			}
+		case opcodes.Pop, opcodes.Return, opcodes.True, opcodes.False, opcodes.None, opcodes.Super:
+			index++
+		case opcodes.Add, opcodes.Sub, opcodes.Mul, opcodes.Div, opcodes.FloorDiv, opcodes.Modulus, opcodes.PowerOf,
+			opcodes.BitwiseOr, opcodes.BitwiseXor, opcodes.BitwiseAnd, opcodes.BitwiseLeft, opcodes.BitwiseRight,
+			opcodes.Equal, opcodes.NotEqual, opcodes.GreaterThan, opcodes.GreaterOrEqualThan, opcodes.LessThan,
+			opcodes.LessOrEqualThan:
+			index++
+		case opcodes.IdentifierAssign, opcodes.SelectorAssign, opcodes.DeleteIdentifier, opcodes.DeleteSelector,
+			opcodes.Identifier, opcodes.String, opcodes.Bytes, opcodes.Selector:
+			index++
+			symbolLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8 + symbolLength
+		case opcodes.Label, opcodes.Line, opcodes.Jump, opcodes.IfJump, opcodes.Call, opcodes.NewArray, opcodes.NewTuple,
+			opcodes.NewHash, opcodes.Integer, opcodes.Float:
+			index += 9
+		case opcodes.Defer:
+			index++
+			bodyLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8
+			body := a.peephole(bytecode[index : index+bodyLength])
+			index += bodyLength
+			result = append(result, opcodes.Defer)
+			result = append(result, common.IntToBytes(len(body))...)
+			result = append(result, body...)
+			continue
+		case opcodes.NewFunction:
+			index++
+			nameLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8 + nameLength
+			argsNumber := common.BytesToInt(bytecode[index : index+8])
+			index += 8
+			for arg := int64(0); arg < argsNumber; arg++ {
+				argSymbolLength := common.BytesToInt(bytecode[index : index+8])
+				index += 8 + argSymbolLength
+			}
+			header := bytecode[start:index]
+			bodyLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8
+			body := a.peephole(bytecode[index : index+bodyLength])
+			index += bodyLength
+			result = append(result, header...)
+			result = append(result, common.IntToBytes(len(body))...)
+			result = append(result, body...)
+			continue
+		case opcodes.NewClass:
+			index += 9
+			header := bytecode[start:index]
+			bodyLength := common.BytesToInt(bytecode[index : index+8])
+			index += 8
+			body := a.peephole(bytecode[index : index+bodyLength])
+			index += bodyLength
+			result = append(result, header...)
+			result = append(result, common.IntToBytes(len(body))...)
+			result = append(result, body...)
+			continue
+		default:
+			panic(fmt.Sprintf("unknown opcode %d in %v", op, bytecode[index:]))
+		}
+		result = append(result, bytecode[start:index]...)
+	}
+	return result
+}
@@ -1,5 +1,7 @@
 package opcodes
 
+import magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+
 const (
 	Push byte = iota
 	Pop
@@ -28,34 +30,115 @@ const (
 	None
 	Selector
 	Super
+	// Binary operations
+	Add
+	Sub
+	Mul
+	Div
+	FloorDiv
+	Modulus
+	PowerOf
+	BitwiseOr
+	BitwiseXor
+	BitwiseAnd
+	BitwiseLeft
+	BitwiseRight
+	Equal
+	NotEqual
+	GreaterThan
+	GreaterOrEqualThan
+	LessThan
+	LessOrEqualThan
+	// Source positions
+	Line
 )
 
 var OpCodes = map[byte]string{
-	Push:             "Push",
-	Pop:              "Pop",
-	IdentifierAssign: "IdentifierAssign",
-	SelectorAssign:   "SelectorAssign",
-	Label:            "Label",
-	Jump:             "Jump",
-	IfJump:           "IfJump",
-	Return:           "Return",
-	DeleteIdentifier: "DeleteIdentifier",
-	DeleteSelector:   "DeleteSelector",
-	Defer:            "Defer",
-	NewFunction:      "NewFunction",
-	NewClass:         "NewClass",
-	Call:             "Call",
-	NewArray:         "NewArray",
-	NewTuple:         "NewTuple",
-	NewHash:          "NewHash",
-	Identifier:       "Identifier",
-	Integer:          "Integer",
-	Float:            "Float",
-	String:           "String",
-	Bytes:            "Bytes",
-	True:             "True",
-	False:            "False",
-	None:             "None",
-	Selector:         "Selector",
-	Super:            "Super",
+	Push:               "Push",
+	Pop:                "Pop",
+	IdentifierAssign:   "IdentifierAssign",
+	SelectorAssign:     "SelectorAssign",
+	Label:              "Label",
+	Jump:               "Jump",
+	IfJump:             "IfJump",
+	Return:             "Return",
+	DeleteIdentifier:   "DeleteIdentifier",
+	DeleteSelector:     "DeleteSelector",
+	Defer:              "Defer",
+	NewFunction:        "NewFunction",
+	NewClass:           "NewClass",
+	Call:               "Call",
+	NewArray:           "NewArray",
+	NewTuple:           "NewTuple",
+	NewHash:            "NewHash",
+	Identifier:         "Identifier",
+	Integer:            "Integer",
+	Float:              "Float",
+	String:             "String",
+	Bytes:              "Bytes",
+	True:               "True",
+	False:              "False",
+	None:               "None",
+	Selector:           "Selector",
+	Super:              "Super",
+	Add:                "Add",
+	Sub:                "Sub",
+	Mul:                "Mul",
+	Div:                "Div",
+	FloorDiv:           "FloorDiv",
+	Modulus:            "Modulus",
+	PowerOf:            "PowerOf",
+	BitwiseOr:          "BitwiseOr",
+	BitwiseXor:         "BitwiseXor",
+	BitwiseAnd:         "BitwiseAnd",
+	BitwiseLeft:        "BitwiseLeft",
+	BitwiseRight:       "BitwiseRight",
+	Equal:              "Equal",
+	NotEqual:           "NotEqual",
+	GreaterThan:        "GreaterThan",
+	GreaterOrEqualThan: "GreaterOrEqualThan",
+	LessThan:           "LessThan",
+	LessOrEqualThan:    "LessOrEqualThan",
+	Line:               "Line",
+}
+
+/*
+BinaryOperations maps binary operation opcodes to the magic method they resolve to
+*/
+var BinaryOperations = map[byte]string{
+	Add:                magic_functions.Add,
+	Sub:                magic_functions.Sub,
+	Mul:                magic_functions.Mul,
+	Div:                magic_functions.Div,
+	FloorDiv:           magic_functions.FloorDiv,
+	Modulus:            magic_functions.Modulus,
+	PowerOf:            magic_functions.PowerOf,
+	BitwiseOr:          magic_functions.BitwiseOr,
+	BitwiseXor:         magic_functions.BitwiseXor,
+	BitwiseAnd:         magic_functions.BitwiseAnd,
+	BitwiseLeft:        magic_functions.BitwiseLeft,
+	BitwiseRight:       magic_functions.BitwiseRight,
+	Equal:              magic_functions.Equal,
+	NotEqual:           magic_functions.NotEqual,
+	GreaterThan:        magic_functions.GreaterThan,
+	GreaterOrEqualThan: magic_functions.GreaterOrEqualThan,
+	LessThan:           magic_functions.LessThan,
+	LessOrEqualThan:    magic_functions.LessOrEqualThan,
 }
+
+/*
+Magic starts the bytecode of the programs produced by the assembler, it is followed by the FormatVersion
+of the bytecode encoded like the integer operands. Bodies of functions, classes and defer blocks have no header
+*/
+const Magic = "PLBC"
+
+/*
+FormatVersion changes every time the encoding of the instructions changes, VMs refuse to execute bytecode
+of other versions. Version 1 records the name of the function in NewFunction, version 2 adds the Line opcode
+*/
+const FormatVersion int64 = 2
+
+/*
+HeaderLength is the length of the magic and the version that start the bytecode of the programs
+*/
+const HeaderLength = len(Magic) + 8
@@ -6,7 +6,8 @@ type (
 		Next  *stackNode
 	}
 	ListStack[T any] struct {
-		Top *stackNode
+		Top  *stackNode
+		size int
 	}
 )
 
@@ -15,6 +16,7 @@ func (s *ListStack[T]) Push(value T) {
 		Value: value,
 		Next:  s.Top,
 	}
+	s.size++
 }
 
 func (s *ListStack[T]) Peek() T {
@@ -24,9 +26,17 @@ func (s *ListStack[T]) Peek() T {
 func (s *ListStack[T]) Pop() T {
 	value := s.Top.Value.(T)
 	s.Top = s.Top.Next
+	s.size--
 	return value
 }
 
 func (s *ListStack[T]) HasNext() bool {
 	return s.Top != nil
 }
+
+/*
+Len returns the number of values in the stack
+*/
+func (s *ListStack[T]) Len() int {
+	return s.size
+}
@@ -1,21 +1,28 @@
 package special_symbols
 
 const (
-	Self     = "self"
-	Value    = "Value"
-	String   = "String"
-	Bytes    = "Bytes"
-	Bool     = "Bool"
-	None     = "None"
-	Int      = "Int"
-	Float    = "Float"
-	Array    = "Array"
-	Tuple    = "Tuple"
-	Hash     = "Hash"
-	Function = "Function"
-	Class    = "Class"
-	Input    = "input"
-	Print    = "print"
-	Println  = "println"
-	Range    = "range"
+	Self      = "self"
+	Value     = "Value"
+	String    = "String"
+	Bytes     = "Bytes"
+	Bool      = "Bool"
+	None      = "None"
+	Int       = "Int"
+	Float     = "Float"
+	Array     = "Array"
+	Tuple     = "Tuple"
+	Hash      = "Hash"
+	Function  = "Function"
+	Class     = "Class"
+	Input     = "input"
+	Print     = "print"
+	Println   = "println"
+	EPrint    = "eprint"
+	EPrintln  = "eprintln"
+	Flush     = "flush"
+	ReadLine  = "read_line"
+	ReadAll   = "read_all"
+	ReadBytes = "read_bytes"
+	Lines     = "lines"
+	Range     = "range"
 )
@@ -7,18 +7,67 @@ import (
 	"github.com/shoriwe/plasma/pkg/lexer"
 	"github.com/shoriwe/plasma/pkg/parser"
 	"github.com/shoriwe/plasma/pkg/passes/checks"
+	"github.com/shoriwe/plasma/pkg/passes/optimization"
+	"github.com/shoriwe/plasma/pkg/passes/positions"
 	"github.com/shoriwe/plasma/pkg/passes/simplification"
 	transformations_1 "github.com/shoriwe/plasma/pkg/passes/transformations-1"
 	"github.com/shoriwe/plasma/pkg/reader"
 )
 
+type Options struct {
+	// Optimize enables constant folding, dead branch removal, jump threading and peephole optimizations
+	Optimize bool
+	// SourcePositions records the source line of the statements in the bytecode, debuggers need it to stop at lines
+	SourcePositions bool
+}
+
+/*
+DefaultOptions are the options used by Compile
+*/
+var DefaultOptions = Options{
+	Optimize: true,
+}
+
 func Compile(scriptCode string) ([]byte, error) {
+	return CompileWithOptions(scriptCode, DefaultOptions)
+}
+
+/*
+CompileWithOptions compiles the script, disable the optimizations when debugging the generated bytecode
+*/
+func CompileWithOptions(scriptCode string, options Options) ([]byte, error) {
 	l := lexer.NewLexer(reader.NewStringReader(scriptCode))
 	p := parser.NewParser(l)
+	if options.SourcePositions {
+		p.TrackLines()
+	}
 	programAst1, parseError := p.Parse()
 	if parseError != nil {
 		return nil, parseError
 	}
+	return compileProgram(programAst1, p, options)
+}
+
+/*
+CompileExpression compiles a source made of a single expression, sources with statements are rejected.
+The result of executing the bytecode is the value of the expression
+*/
+func CompileExpression(source string) ([]byte, error) {
+	p := parser.NewParser(lexer.NewLexer(reader.NewStringReader(source)))
+	program, parseError := p.Parse()
+	if parseError != nil {
+		return nil, parseError
+	}
+	if program.Begin != nil || program.End != nil || len(program.Body) != 1 {
+		return nil, fmt.Errorf("expecting a single expression")
+	}
+	if _, isExpression := program.Body[0].(ast.Expression); !isExpression {
+		return nil, fmt.Errorf("expecting an expression but received a statement")
+	}
+	return compileProgram(program, p, DefaultOptions)
+}
+
+func compileProgram(programAst1 *ast.Program, p *parser.Parser, options Options) ([]byte, error) {
 	checkPass := checks.NewCheckPass()
 	ast.Walk(checkPass, programAst1)
 	if checkPass.CountInvalidLoopNodes() > 0 {
@@ -30,6 +79,9 @@ func Compile(scriptCode string) ([]byte, error) {
 	if checkPass.CountInvalidGeneratorNodes() > 0 {
 		return nil, fmt.Errorf("invalid generator nodes found")
 	}
+	if options.SourcePositions {
+		positions.Annotate(programAst1, p.Lines())
+	}
 	programAst2, simplifyError := simplification.Simplify(programAst1)
 	if simplifyError != nil {
 		return nil, simplifyError
@@ -38,5 +90,12 @@ func Compile(scriptCode string) ([]byte, error) {
 	if transformError != nil {
 		return nil, transformError
 	}
-	return assembler.Assemble(programAst3)
+	if !options.Optimize {
+		return assembler.Assemble(programAst3)
+	}
+	optimizedAst3, optimizeError := optimization.Optimize(programAst3)
+	if optimizeError != nil {
+		return nil, optimizeError
+	}
+	return assembler.AssembleOptimized(optimizedAst3)
 }
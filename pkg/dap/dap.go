@@ -0,0 +1,485 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"github.com/shoriwe/plasma/pkg/vm"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const threadId = 1
+
+type (
+	protocolMessage struct {
+		Seq  int    `json:"seq"`
+		Type string `json:"type"`
+	}
+	request struct {
+		protocolMessage
+		Command   string          `json:"command"`
+		Arguments json.RawMessage `json:"arguments,omitempty"`
+	}
+	response struct {
+		protocolMessage
+		RequestSeq int    `json:"request_seq"`
+		Success    bool   `json:"success"`
+		Command    string `json:"command"`
+		Message    string `json:"message,omitempty"`
+		Body       any    `json:"body,omitempty"`
+	}
+	event struct {
+		protocolMessage
+		Event string `json:"event"`
+		Body  any    `json:"body,omitempty"`
+	}
+	source struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path,omitempty"`
+	}
+	variable struct {
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+		Type               string `json:"type"`
+		VariablesReference int    `json:"variablesReference"`
+	}
+	/*
+		Server is a Debug Adapter Protocol server debugging one plasma script. It supports launching a script,
+		line breakpoints, stepping, pausing and inspecting locals, self and the operand stack of the frames
+	*/
+	Server struct {
+		reader      *bufio.Reader
+		writeMutex  sync.Mutex
+		writer      io.Writer
+		seq         int
+		mutex       sync.Mutex
+		program     string
+		bytecode    []byte
+		stopOnEntry bool
+		configured  bool
+		started     bool
+		plasma      *vm.Plasma
+		debugger    *vm.Debugger
+		stopChan    chan struct{}
+		done        chan struct{}
+		stop        *vm.Stop
+		references  [][]variable
+		lazy        map[int]*vm.Value
+	}
+	outputWriter struct {
+		server   *Server
+		category string
+	}
+)
+
+/*
+NewServer creates a server reading requests from in and writing responses and events to out
+*/
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:   bufio.NewReader(in),
+		writer:   out,
+		debugger: vm.NewDebugger(),
+	}
+}
+
+/*
+Serve handles the requests of a client until it disconnects or closes in
+*/
+func Serve(in io.Reader, out io.Writer) error {
+	return NewServer(in, out).Serve()
+}
+
+/*
+Serve handles the requests of the client until it disconnects or closes the input
+*/
+func (server *Server) Serve() error {
+	for {
+		request, readError := server.read()
+		if errors.Is(readError, io.EOF) {
+			server.terminate()
+			return nil
+		} else if readError != nil {
+			return readError
+		}
+		body, handleError := server.handle(request)
+		response := &response{
+			protocolMessage: protocolMessage{Type: "response"},
+			RequestSeq:      request.Seq,
+			Command:         request.Command,
+			Success:         handleError == nil,
+			Body:            body,
+		}
+		if handleError != nil {
+			response.Message = handleError.Error()
+		}
+		server.send(response)
+		switch request.Command {
+		case "initialize":
+			server.event("initialized", nil)
+		case "disconnect":
+			server.terminate()
+			return nil
+		}
+		if handleError == nil && (request.Command == "launch" || request.Command == "configurationDone") {
+			server.start()
+		}
+	}
+}
+
+func (server *Server) read() (*request, error) {
+	header, readError := textproto.NewReader(server.reader).ReadMIMEHeader()
+	if readError != nil {
+		return nil, readError
+	}
+	length, parseError := strconv.Atoi(header.Get("Content-Length"))
+	if parseError != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", parseError)
+	}
+	content := make([]byte, length)
+	if _, readError = io.ReadFull(server.reader, content); readError != nil {
+		return nil, readError
+	}
+	request := &request{}
+	if unmarshalError := json.Unmarshal(content, request); unmarshalError != nil {
+		return nil, unmarshalError
+	}
+	return request, nil
+}
+
+func (m *protocolMessage) header() *protocolMessage {
+	return m
+}
+
+func (server *Server) send(m interface{ header() *protocolMessage }) {
+	server.writeMutex.Lock()
+	defer server.writeMutex.Unlock()
+	server.seq++
+	m.header().Seq = server.seq
+	content, _ := json.Marshal(m)
+	_, _ = fmt.Fprintf(server.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+func (server *Server) event(name string, body any) {
+	server.send(&event{
+		protocolMessage: protocolMessage{Type: "event"},
+		Event:           name,
+		Body:            body,
+	})
+}
+
+func (writer *outputWriter) Write(p []byte) (int, error) {
+	writer.server.event("output", map[string]any{
+		"category": writer.category,
+		"output":   string(p),
+	})
+	return len(p), nil
+}
+
+func (server *Server) handle(request *request) (any, error) {
+	arguments := map[string]json.RawMessage{}
+	if len(request.Arguments) > 0 {
+		if unmarshalError := json.Unmarshal(request.Arguments, &arguments); unmarshalError != nil {
+			return nil, unmarshalError
+		}
+	}
+	switch request.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+		}, nil
+	case "launch":
+		return nil, server.launch(arguments)
+	case "setBreakpoints":
+		return server.setBreakpoints(arguments)
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []any{}}, nil
+	case "configurationDone":
+		server.mutex.Lock()
+		server.configured = true
+		server.mutex.Unlock()
+		return nil, nil
+	case "threads":
+		return map[string]any{
+			"threads": []any{map[string]any{"id": threadId, "name": "main"}},
+		}, nil
+	case "stackTrace":
+		return server.stackTrace()
+	case "scopes":
+		return server.scopes(arguments)
+	case "variables":
+		return server.variables(arguments)
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, server.resume(server.debugger.Continue)
+	case "next":
+		return nil, server.resume(server.debugger.StepOver)
+	case "stepIn":
+		return nil, server.resume(server.debugger.StepIn)
+	case "stepOut":
+		return nil, server.resume(server.debugger.StepOut)
+	case "pause":
+		server.debugger.Pause()
+		return nil, nil
+	case "disconnect":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %s", request.Command)
+}
+
+func (server *Server) launch(arguments map[string]json.RawMessage) error {
+	var program string
+	if unmarshalError := json.Unmarshal(arguments["program"], &program); unmarshalError != nil {
+		return fmt.Errorf("launch requires the program path")
+	}
+	if stopOnEntry, found := arguments["stopOnEntry"]; found {
+		_ = json.Unmarshal(stopOnEntry, &server.stopOnEntry)
+	}
+	contents, readError := os.ReadFile(program)
+	if readError != nil {
+		return readError
+	}
+	bytecode, compileError := compiler.CompileWithOptions(string(contents), compiler.Options{SourcePositions: true})
+	if compileError != nil {
+		return compileError
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.program = program
+	server.bytecode = bytecode
+	if server.stopOnEntry {
+		server.debugger.Pause()
+	}
+	return nil
+}
+
+func (server *Server) setBreakpoints(arguments map[string]json.RawMessage) (any, error) {
+	var requested []struct {
+		Line int `json:"line"`
+	}
+	if breakpoints, found := arguments["breakpoints"]; found {
+		if unmarshalError := json.Unmarshal(breakpoints, &requested); unmarshalError != nil {
+			return nil, unmarshalError
+		}
+	}
+	lines := make([]int, 0, len(requested))
+	verified := make([]any, 0, len(requested))
+	for _, breakpoint := range requested {
+		lines = append(lines, breakpoint.Line)
+		verified = append(verified, map[string]any{"verified": true, "line": breakpoint.Line})
+	}
+	server.debugger.SetBreakpoints(lines...)
+	return map[string]any{"breakpoints": verified}, nil
+}
+
+/*
+start runs the launched script once the client finished its configuration
+*/
+func (server *Server) start() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.started || !server.configured || server.bytecode == nil {
+		return
+	}
+	server.started = true
+	server.plasma = vm.NewVM(strings.NewReader(""), &outputWriter{server, "stdout"}, &outputWriter{server, "stderr"})
+	server.plasma.SetDebugger(server.debugger)
+	_, errChan, stopChan := server.plasma.Execute(server.bytecode)
+	server.stopChan = stopChan
+	server.done = make(chan struct{})
+	go server.stopped(server.debugger, server.done)
+	go func() {
+		defer close(server.done)
+		exitCode := 0
+		if executionError := <-errChan; executionError != nil {
+			exitCode = 1
+			server.event("output", map[string]any{
+				"category": "stderr",
+				"output":   fmt.Sprintf("%s: %s\n", server.program, executionError),
+			})
+		}
+		server.event("exited", map[string]any{"exitCode": exitCode})
+		server.event("terminated", nil)
+	}()
+}
+
+/*
+stopped reports the stops of the execution to the client
+*/
+func (server *Server) stopped(debugger *vm.Debugger, done chan struct{}) {
+	entry := server.stopOnEntry
+	for {
+		var stop *vm.Stop
+		select {
+		case stop = <-debugger.Stops():
+		case <-done:
+			return
+		}
+		reason := string(stop.Reason)
+		if entry {
+			reason = "entry"
+			entry = false
+		}
+		server.mutex.Lock()
+		server.stop = stop
+		server.references = nil
+		server.lazy = nil
+		server.mutex.Unlock()
+		server.event("stopped", map[string]any{
+			"reason":            reason,
+			"threadId":          threadId,
+			"allThreadsStopped": true,
+		})
+	}
+}
+
+func (server *Server) resume(command func()) error {
+	server.mutex.Lock()
+	if server.stop == nil {
+		server.mutex.Unlock()
+		return fmt.Errorf("the program is not stopped")
+	}
+	server.stop = nil
+	server.mutex.Unlock()
+	command()
+	return nil
+}
+
+func (server *Server) terminate() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.stopChan != nil {
+		server.stopChan <- struct{}{}
+		server.stopChan = nil
+	}
+}
+
+func (server *Server) stackTrace() (any, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.stop == nil {
+		return nil, fmt.Errorf("the program is not stopped")
+	}
+	frames := make([]any, 0, len(server.stop.Frames))
+	for index, frame := range server.stop.Frames {
+		name := frame.Function
+		if name == "" {
+			name = "<main>"
+		}
+		frames = append(frames, map[string]any{
+			"id":     index,
+			"name":   name,
+			"line":   frame.Line,
+			"column": 1,
+			"source": source{Name: filepath.Base(server.program), Path: server.program},
+		})
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (server *Server) scopes(arguments map[string]json.RawMessage) (any, error) {
+	var frameId int
+	_ = json.Unmarshal(arguments["frameId"], &frameId)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.stop == nil || frameId < 0 || frameId >= len(server.stop.Frames) {
+		return nil, fmt.Errorf("unknown frame %d", frameId)
+	}
+	frame := server.stop.Frames[frameId]
+	locals := server.named(frame.Locals)
+	if frame.Self != nil {
+		locals = append([]variable{server.variable("self", frame.Self)}, locals...)
+	}
+	stack := make([]variable, 0, len(server.stop.Stack))
+	for index, value := range server.stop.Stack {
+		stack = append(stack, server.variable(strconv.Itoa(index), value))
+	}
+	scopes := []any{
+		map[string]any{"name": "Locals", "variablesReference": server.reference(locals), "expensive": false},
+	}
+	// The operand stack belongs to the innermost frame
+	if frameId == 0 {
+		scopes = append(scopes, map[string]any{
+			"name": "Operand stack", "variablesReference": server.reference(stack), "expensive": false,
+		})
+	}
+	return map[string]any{"scopes": scopes}, nil
+}
+
+func (server *Server) variables(arguments map[string]json.RawMessage) (any, error) {
+	var reference int
+	_ = json.Unmarshal(arguments["variablesReference"], &reference)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if value, found := server.lazy[reference]; found {
+		delete(server.lazy, reference)
+		server.references[reference-1] = server.children(value)
+	}
+	if reference <= 0 || reference > len(server.references) {
+		return nil, fmt.Errorf("unknown variables reference %d", reference)
+	}
+	return map[string]any{"variables": server.references[reference-1]}, nil
+}
+
+/*
+reference stores the variables until the execution resumes, references start at 1
+*/
+func (server *Server) reference(variables []variable) int {
+	server.references = append(server.references, variables)
+	return len(server.references)
+}
+
+func (server *Server) named(values map[string]*vm.Value) []variable {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := make([]variable, 0, len(names))
+	for _, name := range names {
+		variables = append(variables, server.variable(name, values[name]))
+	}
+	return variables
+}
+
+/*
+variable describes the value, arrays, tuples and objects are expanded when the client asks for them
+*/
+func (server *Server) variable(name string, value *vm.Value) variable {
+	result := variable{
+		Name:  name,
+		Value: value.String(),
+		Type:  value.TypeId().String(),
+	}
+	switch value.TypeId() {
+	case vm.ArrayId, vm.TupleId, vm.ValueId:
+		if server.lazy == nil {
+			server.lazy = map[int]*vm.Value{}
+		}
+		result.VariablesReference = server.reference(nil)
+		server.lazy[result.VariablesReference] = value
+	}
+	return result
+}
+
+func (server *Server) children(value *vm.Value) []variable {
+	if value.TypeId() == vm.ValueId {
+		attributes := value.VirtualTable().Values()
+		delete(attributes, "self")
+		return server.named(attributes)
+	}
+	elements := value.GetValues()
+	variables := make([]variable, 0, len(elements))
+	for index, element := range elements {
+		variables = append(variables, server.variable(fmt.Sprintf("[%d]", index), element))
+	}
+	return variables
+}
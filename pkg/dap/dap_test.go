@@ -0,0 +1,231 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type (
+	received struct {
+		Type       string          `json:"type"`
+		Command    string          `json:"command"`
+		Event      string          `json:"event"`
+		RequestSeq int             `json:"request_seq"`
+		Success    bool            `json:"success"`
+		Message    string          `json:"message"`
+		Body       json.RawMessage `json:"body"`
+	}
+	client struct {
+		t        *testing.T
+		seq      int
+		in       io.Writer
+		messages chan *received
+		pending  []*received
+		output   string
+	}
+)
+
+func newClient(t *testing.T) (*client, chan error) {
+	requests, requestsWriter := io.Pipe()
+	responses, responsesWriter := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(requests, responsesWriter)
+		_ = responsesWriter.Close()
+	}()
+	c := &client{t: t, in: requestsWriter, messages: make(chan *received, 100)}
+	go func() {
+		defer close(c.messages)
+		reader := bufio.NewReader(responses)
+		for {
+			header, readError := textproto.NewReader(reader).ReadMIMEHeader()
+			if readError != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			content := make([]byte, length)
+			if _, readError = io.ReadFull(reader, content); readError != nil {
+				return
+			}
+			m := &received{}
+			assert.Nil(t, json.Unmarshal(content, m))
+			c.messages <- m
+		}
+	}()
+	return c, served
+}
+
+func (c *client) request(command string, arguments any) *received {
+	c.seq++
+	content, _ := json.Marshal(map[string]any{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": arguments,
+	})
+	_, writeError := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	assert.Nil(c.t, writeError)
+	response := c.expect("response", command)
+	assert.Equal(c.t, c.seq, response.RequestSeq)
+	return response
+}
+
+/*
+expect returns the next response or event with the name, other messages are kept for later calls and
+output events are collected
+*/
+func (c *client) expect(kind, name string) *received {
+	for index, m := range c.pending {
+		if m.Type == kind && (m.Command == name || m.Event == name) {
+			c.pending = append(c.pending[:index], c.pending[index+1:]...)
+			return m
+		}
+	}
+	for m := range c.messages {
+		if m.Type == "event" && m.Event == "output" {
+			var output struct{ Output string }
+			assert.Nil(c.t, json.Unmarshal(m.Body, &output))
+			c.output += output.Output
+			continue
+		}
+		if m.Type == kind && (m.Command == name || m.Event == name) {
+			return m
+		}
+		c.pending = append(c.pending, m)
+	}
+	c.t.Fatalf("%s %s never received", kind, name)
+	return nil
+}
+
+func decodeBody[T any](t *testing.T, m *received) T {
+	var body T
+	assert.Nil(t, json.Unmarshal(m.Body, &body))
+	return body
+}
+
+func TestServer(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "program.pm")
+	assert.Nil(t, os.WriteFile(program, []byte(`def double(n)
+	result = n * 2
+	return result
+end
+numbers = [1, 2]
+for number in numbers
+	println(double(number))
+end`), 0o644))
+	c, served := newClient(t)
+	assert.True(t, c.request("initialize", map[string]any{"adapterID": "plasma"}).Success)
+	c.expect("event", "initialized")
+	assert.True(t, c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []any{map[string]any{"line": 3}},
+	}).Success)
+	assert.True(t, c.request("launch", map[string]any{"program": program, "stopOnEntry": true}).Success)
+	assert.True(t, c.request("configurationDone", nil).Success)
+
+	stopped := decodeBody[struct{ Reason string }](t, c.expect("event", "stopped"))
+	assert.Equal(t, "entry", stopped.Reason)
+	assert.True(t, c.request("continue", map[string]any{"threadId": 1}).Success)
+
+	stopped = decodeBody[struct{ Reason string }](t, c.expect("event", "stopped"))
+	assert.Equal(t, "breakpoint", stopped.Reason)
+	threads := decodeBody[struct{ Threads []struct{ Id int } }](t, c.request("threads", nil))
+	assert.Equal(t, 1, len(threads.Threads))
+	trace := decodeBody[struct {
+		StackFrames []struct {
+			Id   int
+			Name string
+			Line int
+		}
+	}](t, c.request("stackTrace", map[string]any{"threadId": 1}))
+	assert.Equal(t, 2, len(trace.StackFrames))
+	assert.Equal(t, "double", trace.StackFrames[0].Name)
+	assert.Equal(t, 3, trace.StackFrames[0].Line)
+	assert.Equal(t, "<main>", trace.StackFrames[1].Name)
+	assert.Equal(t, 7, trace.StackFrames[1].Line)
+
+	type variables struct {
+		Variables []struct {
+			Name               string
+			Value              string
+			Type               string
+			VariablesReference int
+		}
+	}
+	scopes := decodeBody[struct {
+		Scopes []struct {
+			Name               string
+			VariablesReference int
+		}
+	}](t, c.request("scopes", map[string]any{"frameId": 0}))
+	assert.Equal(t, 2, len(scopes.Scopes))
+	locals := decodeBody[variables](t, c.request("variables", map[string]any{
+		"variablesReference": scopes.Scopes[0].VariablesReference,
+	}))
+	assert.Equal(t, 2, len(locals.Variables))
+	assert.Equal(t, "n", locals.Variables[0].Name)
+	assert.Equal(t, "1", locals.Variables[0].Value)
+	assert.Equal(t, "result", locals.Variables[1].Name)
+	assert.Equal(t, "2", locals.Variables[1].Value)
+	assert.Equal(t, "Int", locals.Variables[1].Type)
+
+	scopes = decodeBody[struct {
+		Scopes []struct {
+			Name               string
+			VariablesReference int
+		}
+	}](t, c.request("scopes", map[string]any{"frameId": 1}))
+	assert.Equal(t, 1, len(scopes.Scopes))
+	globals := decodeBody[variables](t, c.request("variables", map[string]any{
+		"variablesReference": scopes.Scopes[0].VariablesReference,
+	}))
+	var numbersReference int
+	for _, global := range globals.Variables {
+		if global.Name == "numbers" {
+			assert.Equal(t, "[1, 2]", global.Value)
+			numbersReference = global.VariablesReference
+		}
+	}
+	assert.NotZero(t, numbersReference)
+	elements := decodeBody[variables](t, c.request("variables", map[string]any{"variablesReference": numbersReference}))
+	assert.Equal(t, 2, len(elements.Variables))
+	assert.Equal(t, "[1]", elements.Variables[1].Name)
+	assert.Equal(t, "2", elements.Variables[1].Value)
+
+	// Step out of double back to the loop, then run to the end
+	assert.True(t, c.request("stepOut", map[string]any{"threadId": 1}).Success)
+	stopped = decodeBody[struct{ Reason string }](t, c.expect("event", "stopped"))
+	assert.Equal(t, "step", stopped.Reason)
+	assert.True(t, c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []any{},
+	}).Success)
+	assert.True(t, c.request("continue", map[string]any{"threadId": 1}).Success)
+	exited := decodeBody[struct{ ExitCode int }](t, c.expect("event", "exited"))
+	assert.Equal(t, 0, exited.ExitCode)
+	c.expect("event", "terminated")
+	assert.Equal(t, "2\n4\n", c.output)
+	assert.False(t, c.request("continue", map[string]any{"threadId": 1}).Success)
+	assert.True(t, c.request("disconnect", nil).Success)
+	assert.Nil(t, <-served)
+}
+
+func TestServerLaunchErrors(t *testing.T) {
+	c, served := newClient(t)
+	c.request("initialize", nil)
+	response := c.request("launch", map[string]any{"program": filepath.Join(t.TempDir(), "missing.pm")})
+	assert.False(t, response.Success)
+	assert.NotEmpty(t, response.Message)
+	assert.False(t, c.request("launch", map[string]any{}).Success)
+	assert.False(t, c.request("unknown", nil).Success)
+	assert.True(t, c.request("disconnect", nil).Success)
+	assert.Nil(t, <-served)
+}
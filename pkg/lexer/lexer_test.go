@@ -39,3 +39,21 @@ func TestNumeric(t *testing.T) {
 func TestComplex(t *testing.T) {
 	test(t, complexSamples)
 }
+
+func TestLines(t *testing.T) {
+	lexer := NewLexer(reader2.NewStringReader("a = 1\n\nb = \"x\ny\"\n# comment\nif a\n\tprintln(a)\nend"))
+	lines := map[string]int{}
+	for lexer.HasNext() {
+		token, tokenizationError := lexer.Next()
+		assert.Nil(t, tokenizationError)
+		if token.Kind != Separator {
+			lines[token.String()] = token.Line
+		}
+	}
+	assert.Equal(t, 1, lines["1"])
+	assert.Equal(t, 3, lines["b"])
+	assert.Equal(t, 3, lines["\"x\ny\""])
+	assert.Equal(t, 6, lines["if"])
+	assert.Equal(t, 7, lines["println"])
+	assert.Equal(t, 8, lines["end"])
+}
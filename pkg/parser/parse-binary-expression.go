@@ -5,7 +5,15 @@ import (
 	"github.com/shoriwe/plasma/pkg/lexer"
 )
 
-func (parser *Parser) parseBinaryExpression(precedence lexer.DirectValue) (ast.Node, error) {
+func (parser *Parser) parseBinaryExpression(precedence lexer.DirectValue) (node ast.Node, err error) {
+	if parser.lines != nil && parser.currentToken != nil {
+		line := parser.currentToken.Line
+		defer func() {
+			if _, found := parser.lines[node]; err == nil && !found {
+				parser.lines[node] = line
+			}
+		}()
+	}
 	var leftHandSide ast.Node
 	var rightHandSide ast.Node
 	var parsingError error
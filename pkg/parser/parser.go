@@ -11,6 +11,22 @@ type Parser struct {
 	lexer        *lexer.Lexer
 	complete     bool
 	currentToken *lexer.Token
+	lines        map[ast.Node]int
+}
+
+/*
+TrackLines makes Parse record the line where every parsed expression and statement starts, the lines are
+returned by Lines
+*/
+func (parser *Parser) TrackLines() {
+	parser.lines = map[ast.Node]int{}
+}
+
+/*
+Lines returns the starting lines recorded since TrackLines was called, nil when lines are not tracked
+*/
+func (parser *Parser) Lines() map[ast.Node]int {
+	return parser.lines
 }
 
 func (parser *Parser) Parse() (*ast.Program, error) {
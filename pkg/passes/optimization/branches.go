@@ -0,0 +1,148 @@
+package optimization
+
+import (
+	"github.com/shoriwe/plasma/pkg/ast3"
+)
+
+func jumpTarget(node ast3.Node) (*ast3.Label, bool) {
+	switch n := node.(type) {
+	case *ast3.Jump:
+		return n.Target, true
+	case *ast3.ContinueJump:
+		return n.Target, true
+	case *ast3.BreakJump:
+		return n.Target, true
+	case *ast3.IfJump:
+		return n.Target, false
+	}
+	return nil, false
+}
+
+func retarget(node ast3.Node, target *ast3.Label) ast3.Node {
+	switch n := node.(type) {
+	case *ast3.Jump:
+		return &ast3.Jump{Target: target}
+	case *ast3.ContinueJump:
+		return &ast3.ContinueJump{Target: target}
+	case *ast3.BreakJump:
+		return &ast3.BreakJump{Target: target}
+	case *ast3.IfJump:
+		return &ast3.IfJump{Condition: n.Condition, Target: target}
+	}
+	return node
+}
+
+func terminates(node ast3.Node) bool {
+	switch node.(type) {
+	case *ast3.Return, *ast3.Yield:
+		return true
+	}
+	_, unconditional := jumpTarget(node)
+	return unconditional
+}
+
+/*
+threadTarget follows chains of labels that are immediately followed by unconditional jumps
+*/
+func threadTarget(body []ast3.Node, positions map[*ast3.Label]int, target *ast3.Label) *ast3.Label {
+	visited := map[*ast3.Label]struct{}{}
+	for {
+		visited[target] = struct{}{}
+		position, found := positions[target]
+		if !found {
+			return target
+		}
+		next := position + 1
+		for next < len(body) {
+			if _, isLabel := body[next].(*ast3.Label); !isLabel {
+				break
+			}
+			next++
+		}
+		if next == len(body) {
+			return target
+		}
+		nextTarget, unconditional := jumpTarget(body[next])
+		if !unconditional {
+			return target
+		}
+		if _, seen := visited[nextTarget]; seen {
+			return target
+		}
+		target = nextTarget
+	}
+}
+
+/*
+jumpsToNext reports if the jump at index only skips labels before reaching its target
+*/
+func jumpsToNext(body []ast3.Node, index int, target *ast3.Label) bool {
+	for next := index + 1; next < len(body); next++ {
+		label, isLabel := body[next].(*ast3.Label)
+		if !isLabel {
+			return false
+		}
+		if label == target {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Branches threads jumps to jumps, removes jumps to the next instruction, unreferenced labels
+and code that can never be reached
+*/
+func (optimize *optimizePass) Branches(body []ast3.Node) []ast3.Node {
+	for changed := true; changed; {
+		changed = false
+		positions := map[*ast3.Label]int{}
+		for index, node := range body {
+			if label, isLabel := node.(*ast3.Label); isLabel {
+				positions[label] = index
+			}
+		}
+		// Thread jumps and count references
+		references := map[*ast3.Label]int{}
+		for index, node := range body {
+			target, _ := jumpTarget(node)
+			if target == nil {
+				continue
+			}
+			if threaded := threadTarget(body, positions, target); threaded != target {
+				body[index] = retarget(node, threaded)
+				target = threaded
+				changed = true
+			}
+			references[target]++
+		}
+		// Remove useless jumps, unreferenced labels and unreachable code
+		result := make([]ast3.Node, 0, len(body))
+		reachable := true
+		for index, node := range body {
+			if label, isLabel := node.(*ast3.Label); isLabel {
+				if references[label] == 0 {
+					changed = true
+					continue
+				}
+				reachable = true
+			}
+			if !reachable {
+				if target, _ := jumpTarget(node); target != nil {
+					references[target]--
+				}
+				changed = true
+				continue
+			}
+			if target, unconditional := jumpTarget(node); unconditional && jumpsToNext(body, index, target) {
+				references[target]--
+				changed = true
+				continue
+			}
+			result = append(result, node)
+			reachable = !terminates(node)
+		}
+		body = result
+	}
+	return body
+}
@@ -0,0 +1,59 @@
+package optimization
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/ast3"
+	"reflect"
+)
+
+type optimizePass struct{}
+
+func (optimize *optimizePass) Node(node ast3.Node) ast3.Node {
+	switch n := node.(type) {
+	case ast3.Statement:
+		return optimize.Statement(n)
+	case ast3.Expression:
+		return optimize.Expression(n)
+	default:
+		panic(fmt.Sprintf("unknown node type %s", reflect.TypeOf(n).String()))
+	}
+}
+
+/*
+Body optimizes every node of the body and then removes the branches that can never be taken
+*/
+func (optimize *optimizePass) Body(body []ast3.Node) []ast3.Node {
+	result := make([]ast3.Node, 0, len(body))
+	for _, node := range body {
+		if node == nil {
+			continue
+		}
+		optimized := optimize.Node(node)
+		if optimized == nil {
+			continue
+		}
+		result = append(result, optimized)
+	}
+	return optimize.Branches(result)
+}
+
+/*
+Optimize folds constant expressions, removes dead branches and threads jumps to jumps
+*/
+func Optimize(program ast3.Program) (ast3.Program, error) {
+	resultChan := make(chan ast3.Program, 1)
+	errorChan := make(chan error, 1)
+	go func(rChan chan ast3.Program, eChan chan error) {
+		defer func() {
+			err := recover()
+			if err != nil {
+				rChan <- nil
+				eChan <- err.(error)
+			}
+		}()
+		optimize := optimizePass{}
+		rChan <- optimize.Body(program)
+		eChan <- nil
+	}(resultChan, errorChan)
+	return <-resultChan, <-errorChan
+}
@@ -0,0 +1,152 @@
+package optimization
+
+import (
+	"github.com/shoriwe/plasma/pkg/ast3"
+	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+	"math"
+)
+
+/*
+Call folds magic method calls on literals, mirroring the result the VM would compute at run time.
+Operations that could fail or whose result depends on the VM state are left untouched
+*/
+func (optimize *optimizePass) Call(call *ast3.Call) ast3.Expression {
+	result := &ast3.Call{
+		Function:  optimize.Expression(call.Function),
+		Arguments: optimize.Expressions(call.Arguments),
+	}
+	selector, ok := result.Function.(*ast3.Selector)
+	if !ok {
+		return result
+	}
+	var folded ast3.Expression
+	switch len(result.Arguments) {
+	case 0:
+		folded = foldUnary(selector.Identifier.Symbol, selector.X)
+	case 1:
+		folded = foldBinary(selector.Identifier.Symbol, selector.X, result.Arguments[0])
+	}
+	if folded != nil {
+		return folded
+	}
+	return result
+}
+
+/*
+Binary folds operations between literals, mirroring the result the VM would compute at run time
+*/
+func (optimize *optimizePass) Binary(binary *ast3.Binary) ast3.Expression {
+	result := &ast3.Binary{
+		Operator: binary.Operator,
+		Left:     optimize.Expression(binary.Left),
+		Right:    optimize.Expression(binary.Right),
+	}
+	if folded := foldBinary(result.Operator, result.Left, result.Right); folded != nil {
+		return folded
+	}
+	return result
+}
+
+func foldUnary(operator string, x ast3.Expression) ast3.Expression {
+	switch operator {
+	case magic_functions.Not:
+		switch x.(type) {
+		case *ast3.True:
+			return &ast3.False{}
+		case *ast3.False:
+			return &ast3.True{}
+		}
+	case magic_functions.Positive:
+		switch x.(type) {
+		case *ast3.Integer, *ast3.Float:
+			return x
+		}
+	case magic_functions.Negative:
+		switch value := x.(type) {
+		case *ast3.Integer:
+			return &ast3.Integer{Value: -value.Value}
+		case *ast3.Float:
+			return &ast3.Float{Value: -value.Value}
+		}
+	}
+	return nil
+}
+
+func foldBinary(operator string, left, right ast3.Expression) ast3.Expression {
+	switch l := left.(type) {
+	case *ast3.Integer:
+		switch r := right.(type) {
+		case *ast3.Integer:
+			return foldInteger(operator, l.Value, r.Value)
+		case *ast3.Float:
+			return foldFloat(operator, float64(l.Value), r.Value, false)
+		}
+	case *ast3.Float:
+		switch r := right.(type) {
+		case *ast3.Integer:
+			return foldFloat(operator, l.Value, float64(r.Value), true)
+		case *ast3.Float:
+			return foldFloat(operator, l.Value, r.Value, true)
+		}
+	case *ast3.String:
+		if r, isString := right.(*ast3.String); isString && operator == magic_functions.Add {
+			contents := make([]byte, 0, len(l.Contents)+len(r.Contents))
+			contents = append(contents, l.Contents...)
+			contents = append(contents, r.Contents...)
+			return &ast3.String{Contents: contents}
+		}
+	}
+	return nil
+}
+
+func foldInteger(operator string, left, right int64) ast3.Expression {
+	switch operator {
+	case magic_functions.Add:
+		return &ast3.Integer{Value: left + right}
+	case magic_functions.Sub:
+		return &ast3.Integer{Value: left - right}
+	case magic_functions.Mul:
+		return &ast3.Integer{Value: left * right}
+	case magic_functions.Div:
+		if right != 0 {
+			return &ast3.Float{Value: float64(left) / float64(right)}
+		}
+	case magic_functions.FloorDiv:
+		if right != 0 {
+			return &ast3.Integer{Value: left / right}
+		}
+	case magic_functions.Modulus:
+		if right != 0 {
+			return &ast3.Integer{Value: left % right}
+		}
+	}
+	return nil
+}
+
+/*
+foldFloat folds operations with at least one float operand, leftFloat reports if the receiver of the
+magic method is a Float, since Int receivers truncate floor divisions differently
+*/
+func foldFloat(operator string, left, right float64, leftFloat bool) ast3.Expression {
+	switch operator {
+	case magic_functions.Add:
+		return &ast3.Float{Value: left + right}
+	case magic_functions.Sub:
+		return &ast3.Float{Value: left - right}
+	case magic_functions.Mul:
+		return &ast3.Float{Value: left * right}
+	case magic_functions.Div:
+		if right != 0 {
+			return &ast3.Float{Value: left / right}
+		}
+	case magic_functions.FloorDiv:
+		if leftFloat && right != 0 {
+			return &ast3.Integer{Value: int64(left / right)}
+		}
+	case magic_functions.Modulus:
+		if right != 0 {
+			return &ast3.Float{Value: math.Mod(left, right)}
+		}
+	}
+	return nil
+}
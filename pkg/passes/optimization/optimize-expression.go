@@ -0,0 +1,79 @@
+package optimization
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/ast3"
+	"reflect"
+)
+
+func (optimize *optimizePass) Expressions(expressions []ast3.Expression) []ast3.Expression {
+	result := make([]ast3.Expression, 0, len(expressions))
+	for _, expression := range expressions {
+		result = append(result, optimize.Expression(expression))
+	}
+	return result
+}
+
+func (optimize *optimizePass) Assignable(assignable ast3.Assignable) ast3.Assignable {
+	switch a := assignable.(type) {
+	case *ast3.Identifier:
+		return a
+	case *ast3.Selector:
+		return &ast3.Selector{
+			X:          optimize.Expression(a.X),
+			Identifier: a.Identifier,
+		}
+	case *ast3.Index:
+		return &ast3.Index{
+			Source: optimize.Expression(a.Source),
+			Index:  optimize.Expression(a.Index),
+		}
+	default:
+		panic(fmt.Sprintf("unknown assignable type %s", reflect.TypeOf(a).String()))
+	}
+}
+
+func (optimize *optimizePass) Expression(expr ast3.Expression) ast3.Expression {
+	if expr == nil {
+		return nil
+	}
+	switch e := expr.(type) {
+	case *ast3.Function:
+		return &ast3.Function{
+			Name:      e.Name,
+			Arguments: e.Arguments,
+			Body:      optimize.Body(e.Body),
+		}
+	case *ast3.Class:
+		return &ast3.Class{
+			Bases: optimize.Expressions(e.Bases),
+			Body:  optimize.Body(e.Body),
+		}
+	case *ast3.Call:
+		return optimize.Call(e)
+	case *ast3.Binary:
+		return optimize.Binary(e)
+	case *ast3.Array:
+		return &ast3.Array{Values: optimize.Expressions(e.Values)}
+	case *ast3.Tuple:
+		return &ast3.Tuple{Values: optimize.Expressions(e.Values)}
+	case *ast3.Hash:
+		values := make([]*ast3.KeyValue, 0, len(e.Values))
+		for _, keyValue := range e.Values {
+			values = append(values, &ast3.KeyValue{
+				Key:   optimize.Expression(keyValue.Key),
+				Value: optimize.Expression(keyValue.Value),
+			})
+		}
+		return &ast3.Hash{Values: values}
+	case *ast3.Identifier, *ast3.Integer, *ast3.Float, *ast3.String, *ast3.Bytes,
+		*ast3.True, *ast3.False, *ast3.None:
+		return e
+	case *ast3.Selector, *ast3.Index:
+		return optimize.Assignable(e.(ast3.Assignable))
+	case *ast3.Super:
+		return &ast3.Super{X: optimize.Expression(e.X)}
+	default:
+		panic(fmt.Sprintf("unknown expression type %s", reflect.TypeOf(e).String()))
+	}
+}
@@ -0,0 +1,41 @@
+package optimization
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/ast3"
+	"reflect"
+)
+
+func (optimize *optimizePass) Statement(stmt ast3.Statement) ast3.Node {
+	switch s := stmt.(type) {
+	case *ast3.Assignment:
+		return &ast3.Assignment{
+			Left:  optimize.Assignable(s.Left),
+			Right: optimize.Expression(s.Right),
+		}
+	case *ast3.Label, *ast3.Line, *ast3.Jump, *ast3.ContinueJump, *ast3.BreakJump:
+		return s
+	case *ast3.IfJump:
+		condition := optimize.Expression(s.Condition)
+		switch condition.(type) {
+		case *ast3.True:
+			return &ast3.Jump{Target: s.Target}
+		case *ast3.False, *ast3.None:
+			return nil
+		}
+		return &ast3.IfJump{
+			Condition: condition,
+			Target:    s.Target,
+		}
+	case *ast3.Return:
+		return &ast3.Return{Result: optimize.Expression(s.Result)}
+	case *ast3.Yield:
+		return &ast3.Yield{Result: optimize.Expression(s.Result)}
+	case *ast3.Delete:
+		return &ast3.Delete{X: optimize.Assignable(s.X)}
+	case *ast3.Defer:
+		return &ast3.Defer{X: optimize.Expression(s.X)}
+	default:
+		panic(fmt.Sprintf("unknown type of statement %s", reflect.TypeOf(s).String()))
+	}
+}
@@ -0,0 +1,85 @@
+package optimization
+
+import (
+	"github.com/shoriwe/plasma/pkg/ast3"
+	"github.com/shoriwe/plasma/pkg/lexer"
+	"github.com/shoriwe/plasma/pkg/parser"
+	"github.com/shoriwe/plasma/pkg/passes/simplification"
+	transformations_1 "github.com/shoriwe/plasma/pkg/passes/transformations-1"
+	"github.com/shoriwe/plasma/pkg/reader"
+	"github.com/shoriwe/plasma/pkg/test-samples/basic"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func optimize(t *testing.T, sample string) ast3.Program {
+	l := lexer.NewLexer(reader.NewStringReader(sample))
+	p := parser.NewParser(l)
+	program, parseError := p.Parse()
+	assert.Nil(t, parseError)
+	simplified, simplificationError := simplification.Simplify(program)
+	assert.Nil(t, simplificationError)
+	transformed, transformError := transformations_1.Transform(simplified)
+	assert.Nil(t, transformError)
+	optimized, optimizeError := Optimize(transformed)
+	assert.Nil(t, optimizeError)
+	return optimized
+}
+
+func TestSampleScript(t *testing.T) {
+	for _, sample := range basic.Samples {
+		optimize(t, sample)
+	}
+}
+
+func TestFoldArithmetic(t *testing.T) {
+	program := optimize(t, "1 + 2 * 3")
+	assert.Equal(t, ast3.Program{&ast3.Integer{Value: 7}}, program)
+	program = optimize(t, "10 / 4 - 0.5")
+	assert.Equal(t, ast3.Program{&ast3.Float{Value: 2}}, program)
+	program = optimize(t, "'Hello' + ' ' + 'World'")
+	assert.Equal(t, ast3.Program{&ast3.String{Contents: []byte("Hello World")}}, program)
+}
+
+func TestFoldKeepsFailingOperations(t *testing.T) {
+	program := optimize(t, "1 // 0")
+	assert.Len(t, program, 1)
+	_, isBinary := program[0].(*ast3.Binary)
+	assert.True(t, isBinary)
+}
+
+func TestDeadBranches(t *testing.T) {
+	program := optimize(t, "if true\n\ta = 1\nelse\n\ta = 2\nend")
+	assert.Equal(t, ast3.Program{
+		&ast3.Assignment{
+			Left:  &ast3.Identifier{Symbol: "a"},
+			Right: &ast3.Integer{Value: 1},
+		},
+	}, program)
+	program = optimize(t, "if false\n\ta = 1\nelse\n\ta = 2\nend")
+	assert.Equal(t, ast3.Program{
+		&ast3.Assignment{
+			Left:  &ast3.Identifier{Symbol: "a"},
+			Right: &ast3.Integer{Value: 2},
+		},
+	}, program)
+}
+
+func TestThreadJumps(t *testing.T) {
+	first := &ast3.Label{Code: 1}
+	second := &ast3.Label{Code: 2}
+	pass := optimizePass{}
+	body := pass.Body([]ast3.Node{
+		&ast3.IfJump{Condition: &ast3.Identifier{Symbol: "a"}, Target: first},
+		&ast3.Identifier{Symbol: "b"},
+		first,
+		&ast3.Jump{Target: second},
+		&ast3.Identifier{Symbol: "c"},
+		second,
+	})
+	assert.Equal(t, []ast3.Node{
+		&ast3.IfJump{Condition: &ast3.Identifier{Symbol: "a"}, Target: second},
+		&ast3.Identifier{Symbol: "b"},
+		second,
+	}, body)
+}
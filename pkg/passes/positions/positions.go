@@ -0,0 +1,84 @@
+package positions
+
+import (
+	"github.com/shoriwe/plasma/pkg/ast"
+)
+
+/*
+Annotate inserts a LineStatement before the first statement of every source line found in the bodies of the
+program, lines are the starting lines recorded by the parser with TrackLines. Statements without a recorded
+line keep the line of the previous statement
+*/
+func Annotate(program *ast.Program, lines map[ast.Node]int) {
+	a := &annotator{lines: lines}
+	if program.Begin != nil {
+		program.Begin.Body = a.body(program.Begin.Body)
+	}
+	program.Body = a.body(program.Body)
+	if program.End != nil {
+		program.End.Body = a.body(program.End.Body)
+	}
+}
+
+type annotator struct {
+	lines map[ast.Node]int
+}
+
+func (a *annotator) body(body []ast.Node) []ast.Node {
+	if len(body) == 0 {
+		return body
+	}
+	result := make([]ast.Node, 0, 2*len(body))
+	lastLine := 0
+	for _, node := range body {
+		a.children(node)
+		if line, found := a.lines[node]; found && line != lastLine {
+			result = append(result, &ast.LineStatement{Line: line})
+			lastLine = line
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+func (a *annotator) children(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.DoWhileStatement:
+		n.Body = a.body(n.Body)
+	case *ast.WhileLoopStatement:
+		n.Body = a.body(n.Body)
+	case *ast.UntilLoopStatement:
+		n.Body = a.body(n.Body)
+	case *ast.ForLoopStatement:
+		n.Body = a.body(n.Body)
+	case *ast.IfStatement:
+		n.Body = a.body(n.Body)
+		for index := range n.ElifBlocks {
+			n.ElifBlocks[index].Body = a.body(n.ElifBlocks[index].Body)
+		}
+		n.Else = a.body(n.Else)
+	case *ast.UnlessStatement:
+		n.Body = a.body(n.Body)
+		for index := range n.ElifBlocks {
+			n.ElifBlocks[index].Body = a.body(n.ElifBlocks[index].Body)
+		}
+		n.Else = a.body(n.Else)
+	case *ast.SwitchStatement:
+		for _, caseBlock := range n.CaseBlocks {
+			caseBlock.Body = a.body(caseBlock.Body)
+		}
+		n.Default = a.body(n.Default)
+	case *ast.ModuleStatement:
+		n.Body = a.body(n.Body)
+	case *ast.FunctionDefinitionStatement:
+		n.Body = a.body(n.Body)
+	case *ast.GeneratorDefinitionStatement:
+		n.Body = a.body(n.Body)
+	case *ast.InterfaceStatement:
+		for _, method := range n.MethodDefinitions {
+			method.Body = a.body(method.Body)
+		}
+	case *ast.ClassStatement:
+		n.Body = a.body(n.Body)
+	}
+}
@@ -8,3 +8,7 @@ import (
 func (simplify *simplifyPass) Pass(pass *ast.PassStatement) *ast2.Pass {
 	return &ast2.Pass{}
 }
+
+func (simplify *simplifyPass) Line(line *ast.LineStatement) *ast2.Line {
+	return &ast2.Line{Number: line.Line}
+}
@@ -47,6 +47,8 @@ func (simplify *simplifyPass) Statement(stmt ast.Statement) ast2.Statement {
 		return simplify.Delete(s)
 	case *ast.DeferStatement:
 		return simplify.Defer(s)
+	case *ast.LineStatement:
+		return simplify.Line(s)
 	default:
 		panic("unknown statement type")
 	}
@@ -7,9 +7,10 @@ import (
 	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
 )
 
-func (transform *transformPass) Binary(binary *ast2.Binary) *ast3.Call {
+func (transform *transformPass) Binary(binary *ast2.Binary) ast3.Expression {
 	var (
 		function string
+		direct   bool
 	)
 	switch binary.Operator {
 	case ast2.And:
@@ -39,43 +40,68 @@ func (transform *transformPass) Binary(binary *ast2.Binary) *ast3.Call {
 		function = magic_functions.Implements
 	case ast2.Equals:
 		function = magic_functions.Equal
+		direct = true
 	case ast2.NotEqual:
 		function = magic_functions.NotEqual
+		direct = true
 	case ast2.GreaterThan:
 		function = magic_functions.GreaterThan
+		direct = true
 	case ast2.GreaterOrEqualThan:
 		function = magic_functions.GreaterOrEqualThan
+		direct = true
 	case ast2.LessThan:
 		function = magic_functions.LessThan
+		direct = true
 	case ast2.LessOrEqualThan:
 		function = magic_functions.LessOrEqualThan
+		direct = true
 	case ast2.BitwiseOr:
 		function = magic_functions.BitwiseOr
+		direct = true
 	case ast2.BitwiseXor:
 		function = magic_functions.BitwiseXor
+		direct = true
 	case ast2.BitwiseAnd:
 		function = magic_functions.BitwiseAnd
+		direct = true
 	case ast2.BitwiseLeft:
 		function = magic_functions.BitwiseLeft
+		direct = true
 	case ast2.BitwiseRight:
 		function = magic_functions.BitwiseRight
+		direct = true
 	case ast2.Add:
 		function = magic_functions.Add
+		direct = true
 	case ast2.Sub:
 		function = magic_functions.Sub
+		direct = true
 	case ast2.Mul:
 		function = magic_functions.Mul
+		direct = true
 	case ast2.Div:
 		function = magic_functions.Div
+		direct = true
 	case ast2.FloorDiv:
 		function = magic_functions.FloorDiv
+		direct = true
 	case ast2.Modulus:
 		function = magic_functions.Modulus
+		direct = true
 	case ast2.PowerOf:
 		function = magic_functions.PowerOf
+		direct = true
 	default:
 		panic(fmt.Sprintf("unknown binary operator %d", binary.Operator))
 	}
+	if direct {
+		return &ast3.Binary{
+			Operator: function,
+			Left:     transform.Expression(binary.Left),
+			Right:    transform.Expression(binary.Right),
+		}
+	}
 	return transform.Call(
 		&ast2.FunctionCall{
 			Expression: nil,
@@ -17,6 +17,7 @@ func (transform *transformPass) Function(function *ast2.FunctionDefinition) []as
 	return []ast3.Node{&ast3.Assignment{
 		Left: transform.Identifier(function.Name),
 		Right: &ast3.Function{
+			Name:      function.Name.Symbol,
 			Arguments: arguments,
 			Body:      body,
 		},
@@ -82,7 +82,7 @@ func (gt *generatorTransform) resolve(node ast3.Node, symbols map[string]struct{
 			Left:  gt.resolve(n.Left, symbolsCopy)[0].(ast3.Assignable),
 			Right: gt.resolve(n.Right, symbolsCopy)[0].(ast3.Expression),
 		}}
-	case *ast3.Label:
+	case *ast3.Label, *ast3.Line:
 		return []ast3.Node{n}
 	case *ast3.Jump:
 		return []ast3.Node{n}
@@ -140,6 +140,7 @@ func (gt *generatorTransform) resolve(node ast3.Node, symbols map[string]struct{
 			body = append(body, gt.resolve(child, symbolsCopy)...)
 		}
 		return []ast3.Node{&ast3.Function{
+			Name:      n.Name,
 			Arguments: n.Arguments,
 			Body:      body,
 		}}
@@ -165,6 +166,12 @@ func (gt *generatorTransform) resolve(node ast3.Node, symbols map[string]struct{
 			Function:  gt.resolve(n.Function, symbolsCopy)[0].(ast3.Expression),
 			Arguments: arguments,
 		}}
+	case *ast3.Binary:
+		return []ast3.Node{&ast3.Binary{
+			Operator: n.Operator,
+			Left:     gt.resolve(n.Left, symbolsCopy)[0].(ast3.Expression),
+			Right:    gt.resolve(n.Right, symbolsCopy)[0].(ast3.Expression),
+		}}
 	case *ast3.Array:
 		values := make([]ast3.Expression, 0, len(n.Values))
 		for _, value := range n.Values {
@@ -333,6 +340,7 @@ func (gt *generatorTransform) next(rawBody []ast3.Node) *ast3.Assignment {
 			Symbol: magic_functions.Next,
 		},
 		Right: &ast3.Function{
+			Name: magic_functions.Next,
 			Body: gt.setup(body),
 		},
 	}
@@ -350,6 +358,7 @@ func (gt *generatorTransform) hasNext() *ast3.Assignment {
 			Symbol: magic_functions.HasNext,
 		},
 		Right: &ast3.Function{
+			Name: magic_functions.HasNext,
 			Body: body,
 		},
 	}
@@ -16,3 +16,7 @@ func (transform *transformPass) Break(b *ast2.Break) []ast3.Node {
 func (transform *transformPass) Pass(p *ast2.Pass) []ast3.Node {
 	return nil
 }
+
+func (transform *transformPass) Line(l *ast2.Line) []ast3.Node {
+	return []ast3.Node{&ast3.Line{Number: l.Number}}
+}
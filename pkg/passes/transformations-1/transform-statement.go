@@ -39,6 +39,8 @@ func (transform *transformPass) Statement(stmt ast2.Statement) []ast3.Node {
 		return transform.Delete(s)
 	case *ast2.Defer:
 		return transform.Defer(s)
+	case *ast2.Line:
+		return transform.Line(s)
 	default:
 		panic(fmt.Sprintf("unknown statement type %s", reflect.TypeOf(s).String()))
 	}
@@ -26,11 +26,17 @@ func (s *StringReader) Line() int {
 }
 
 func (s *StringReader) Next() {
+	if s.index < s.length && s.content[s.index] == '\n' {
+		s.line++
+	}
 	s.index++
 }
 
 func (s *StringReader) Redo() {
 	s.index--
+	if s.content[s.index] == '\n' {
+		s.line--
+	}
 }
 
 func (s *StringReader) HasNext() bool {
@@ -42,11 +48,7 @@ func (s *StringReader) Index() int {
 }
 
 func (s *StringReader) Char() rune {
-	character := s.content[s.index]
-	if character == '\n' {
-		s.line++
-	}
-	return character
+	return s.content[s.index]
 }
 
 func NewStringReader(code string) Reader {
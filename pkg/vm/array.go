@@ -1,6 +1,7 @@
 package vm
 
 import (
+	gocontext "context"
 	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
 )
 
@@ -153,6 +154,9 @@ func (plasma *Plasma) NewArray(values []*Value) *Value {
 	result.Set(magic_functions.Set, plasma.NewBuiltInFunction(
 		result.vtable,
 		func(argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			switch argument[0].TypeId() {
 			case IntId:
 				result.GetValues()[argument[0].GetInt64()] = argument[1]
@@ -184,16 +188,26 @@ func (plasma *Plasma) NewArray(values []*Value) *Value {
 			))
 			return iter, nil
 		}))
-	result.Set(magic_functions.Append, plasma.NewBuiltInFunction(
+	result.Set(magic_functions.Append, plasma.NewBuiltInContextFunction(
 		result.vtable,
-		func(argument ...*Value) (*Value, error) {
-			result.SetAny(append(result.GetValues(), argument[0]))
+		func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
+			currentValues := result.GetValues()
+			if growthError := checkGrowth(ctx, int64(len(currentValues))+1); growthError != nil {
+				return nil, growthError
+			}
+			result.SetAny(append(currentValues, argument[0]))
 			return plasma.none, nil
 		},
 	))
 	result.Set(magic_functions.Clear, plasma.NewBuiltInFunction(
 		result.vtable,
 		func(argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			result.SetAny([]*Value{})
 			return plasma.none, nil
 		},
@@ -212,6 +226,9 @@ func (plasma *Plasma) NewArray(values []*Value) *Value {
 	result.Set(magic_functions.Pop, plasma.NewBuiltInFunction(
 		result.vtable,
 		func(argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			currentValues := result.GetValues()
 			r := currentValues[len(currentValues)-1]
 			currentValues = currentValues[:len(currentValues)-1]
@@ -219,12 +236,18 @@ func (plasma *Plasma) NewArray(values []*Value) *Value {
 			return r, nil
 		},
 	))
-	result.Set(magic_functions.Insert, plasma.NewBuiltInFunction(
+	result.Set(magic_functions.Insert, plasma.NewBuiltInContextFunction(
 		result.vtable,
-		func(argument ...*Value) (*Value, error) {
+		func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			index := Int[int64](argument[0])
 			value := argument[1]
 			currentValues := result.GetValues()
+			if growthError := checkGrowth(ctx, int64(len(currentValues))+1); growthError != nil {
+				return nil, growthError
+			}
 			newValues := make([]*Value, 0, 1+int64(len(currentValues)))
 			newValues = append(newValues, currentValues[:index]...)
 			newValues = append(newValues, value)
@@ -236,6 +259,9 @@ func (plasma *Plasma) NewArray(values []*Value) *Value {
 	result.Set(magic_functions.Remove, plasma.NewBuiltInFunction(
 		result.vtable,
 		func(argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			index := Int[int64](argument[0])
 			currentValues := result.GetValues()
 			newValues := make([]*Value, 0, 1+int64(len(currentValues)))
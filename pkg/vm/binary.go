@@ -0,0 +1,148 @@
+package vm
+
+import (
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"math"
+)
+
+/*
+fastBinary computes binary operations between primitive values without dispatching to their magic methods.
+The results mirror the builtin magic methods, combinations it does not handle report false and are resolved
+by calling the magic method of the left operand
+*/
+func (plasma *Plasma) fastBinary(op byte, left, right *Value) (*Value, bool) {
+	switch left.TypeId() {
+	case IntId:
+		switch right.TypeId() {
+		case IntId:
+			return plasma.intBinary(op, left.GetInt64(), right.GetInt64())
+		case FloatId:
+			return plasma.floatBinary(op, float64(left.GetInt64()), right.GetFloat64(), false)
+		}
+	case FloatId:
+		switch right.TypeId() {
+		case IntId:
+			return plasma.floatBinary(op, left.GetFloat64(), float64(right.GetInt64()), true)
+		case FloatId:
+			return plasma.floatBinary(op, left.GetFloat64(), right.GetFloat64(), true)
+		}
+	case StringId:
+		if right.TypeId() != StringId {
+			break
+		}
+		switch op {
+		case opcodes.Add:
+			l, r := left.GetBytes(), right.GetBytes()
+			s := make([]byte, 0, len(l)+len(r))
+			s = append(s, l...)
+			s = append(s, r...)
+			return plasma.NewString(s), true
+		case opcodes.Equal:
+			return plasma.NewBool(left.String() == right.String()), true
+		case opcodes.NotEqual:
+			return plasma.NewBool(left.String() != right.String()), true
+		}
+	case BoolId:
+		if right.TypeId() != BoolId {
+			break
+		}
+		switch op {
+		case opcodes.Equal:
+			return plasma.NewBool(left.GetBool() == right.GetBool()), true
+		case opcodes.NotEqual:
+			return plasma.NewBool(left.GetBool() != right.GetBool()), true
+		}
+	}
+	return nil, false
+}
+
+func (plasma *Plasma) intBinary(op byte, l, r int64) (*Value, bool) {
+	switch op {
+	case opcodes.Add:
+		return plasma.NewInt(l + r), true
+	case opcodes.Sub:
+		return plasma.NewInt(l - r), true
+	case opcodes.Mul:
+		return plasma.NewInt(l * r), true
+	case opcodes.Div:
+		return plasma.NewFloat(float64(l) / float64(r)), true
+	case opcodes.FloorDiv:
+		if r == 0 {
+			break
+		}
+		return plasma.NewInt(l / r), true
+	case opcodes.Modulus:
+		if r == 0 {
+			break
+		}
+		return plasma.NewInt(l % r), true
+	case opcodes.BitwiseOr:
+		return plasma.NewInt(l | r), true
+	case opcodes.BitwiseXor:
+		return plasma.NewInt(l ^ r), true
+	case opcodes.BitwiseAnd:
+		return plasma.NewInt(l & r), true
+	case opcodes.BitwiseLeft:
+		if r < 0 {
+			break
+		}
+		return plasma.NewInt(l << r), true
+	case opcodes.BitwiseRight:
+		if r < 0 {
+			break
+		}
+		return plasma.NewInt(l >> r), true
+	case opcodes.Equal:
+		return plasma.NewBool(l == r), true
+	case opcodes.NotEqual:
+		return plasma.NewBool(l != r), true
+	case opcodes.GreaterThan:
+		return plasma.NewBool(l > r), true
+	case opcodes.GreaterOrEqualThan:
+		return plasma.NewBool(l >= r), true
+	case opcodes.LessThan:
+		return plasma.NewBool(l < r), true
+	case opcodes.LessOrEqualThan:
+		return plasma.NewBool(l <= r), true
+	}
+	return nil, false
+}
+
+/*
+floatBinary handles operations where at least one operand is a Float, floatReceiver reports if the left
+operand is the Float, since Int and Float receivers differ on floor division and bitwise operations
+*/
+func (plasma *Plasma) floatBinary(op byte, l, r float64, floatReceiver bool) (*Value, bool) {
+	switch op {
+	case opcodes.Add:
+		return plasma.NewFloat(l + r), true
+	case opcodes.Sub:
+		return plasma.NewFloat(l - r), true
+	case opcodes.Mul:
+		return plasma.NewFloat(l * r), true
+	case opcodes.Div:
+		return plasma.NewFloat(l / r), true
+	case opcodes.FloorDiv:
+		if !floatReceiver {
+			break
+		}
+		return plasma.NewInt(int64(l / r)), true
+	case opcodes.Modulus:
+		return plasma.NewFloat(math.Mod(l, r)), true
+	case opcodes.PowerOf:
+		return plasma.NewFloat(math.Pow(l, r)), true
+	case opcodes.Equal:
+		return plasma.NewBool(l == r), true
+	case opcodes.NotEqual:
+		return plasma.NewBool(l != r), true
+	case opcodes.GreaterThan:
+		return plasma.NewBool(l > r), true
+	case opcodes.GreaterOrEqualThan:
+		return plasma.NewBool(l >= r), true
+	case opcodes.LessThan:
+		return plasma.NewBool(l < r), true
+	case opcodes.LessOrEqualThan:
+		return plasma.NewBool(l <= r), true
+	}
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var binaryOperators = map[string]string{
+	"+":  magic_functions.Add,
+	"-":  magic_functions.Sub,
+	"*":  magic_functions.Mul,
+	"/":  magic_functions.Div,
+	"//": magic_functions.FloorDiv,
+	"%":  magic_functions.Modulus,
+	"**": magic_functions.PowerOf,
+	"|":  magic_functions.BitwiseOr,
+	"^":  magic_functions.BitwiseXor,
+	"&":  magic_functions.BitwiseAnd,
+	"<<": magic_functions.BitwiseLeft,
+	">>": magic_functions.BitwiseRight,
+	"==": magic_functions.Equal,
+	"!=": magic_functions.NotEqual,
+	">":  magic_functions.GreaterThan,
+	">=": magic_functions.GreaterOrEqualThan,
+	"<":  magic_functions.LessThan,
+	"<=": magic_functions.LessOrEqualThan,
+}
+
+func runBinary(code string) (string, error) {
+	out := &bytes.Buffer{}
+	p := NewVM(nil, out, nil)
+	_, errCh, _ := p.ExecuteString(code)
+	err := <-errCh
+	return out.String(), err
+}
+
+func TestFastBinaryMatchesMagicMethods(t *testing.T) {
+	operands := []string{"0", "7", "-3", "2.5", "0.0", "'a'", "'b'", "true", "false", "none"}
+	for operator, method := range binaryOperators {
+		for _, left := range operands {
+			for _, right := range operands {
+				setup := fmt.Sprintf("l = %s\nr = %s\n", left, right)
+				expected, expectedError := runBinary(setup + fmt.Sprintf("println(l.%s(r))", method))
+				result, resultError := runBinary(setup + fmt.Sprintf("println(l %s r)", operator))
+				message := fmt.Sprintf("%s %s %s", left, operator, right)
+				assert.Equal(t, expectedError == nil, resultError == nil, message)
+				assert.Equal(t, expected, result, message)
+			}
+		}
+	}
+}
+
+func TestBinaryOverloading(t *testing.T) {
+	result, err := runBinary(`
+class Vector
+	def __init__(x, y)
+		self.x = x
+		self.y = y
+	end
+	def __add__(other)
+		return Vector(self.x + other.x, self.y + other.y)
+	end
+	def __less_than__(other)
+		return self.x < other.x
+	end
+end
+v = Vector(1, 2) + Vector(3, 4)
+println(v.x, v.y)
+println(Vector(1, 0) < Vector(2, 0))
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "4 6\ntrue\n", result)
+}
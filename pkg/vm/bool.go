@@ -89,5 +89,6 @@ func (plasma *Plasma) NewBool(b bool) *Value {
 			return result, nil
 		},
 	))
+	result.frozen = true
 	return result
 }
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	symbolsVersion struct {
+		symbols *Symbols
+		version uint64
+	}
+	/*
+		selectorCache is the result of a lookup shared by the receivers with the same parent table, like the
+		instances of a class. Symbols found in the own table of the receiver are read from it again, the
+		others are cached while the receiver lacks the symbol and the parent tables walked stay unchanged
+	*/
+	selectorCache struct {
+		parent *Symbols
+		own    bool // Found in the own table of the receiver
+		chain  []symbolsVersion
+		result *Value
+	}
+	/*
+		inlineCaches stores per instruction lookup results and materialized literal constants of a
+		piece of bytecode, indexed by the instruction offset. Entries are immutable, a new one replaces
+		the old on every miss
+	*/
+	inlineCaches struct {
+		hits      uint64 // Selector lookups answered by the cache, keep it first for 64-bit atomic alignment
+		selectors sync.Map
+		constants sync.Map
+	}
+)
+
+func newInlineCaches() *inlineCaches {
+	return &inlineCaches{}
+}
+
+/*
+get returns the result of the lookup of the symbol in the virtual table when the cache still knows it
+*/
+func (cache *selectorCache) get(vtable *Symbols, symbol string) (*Value, bool) {
+	vtable.mutex.Lock()
+	value, found := vtable.values[symbol]
+	vtable.mutex.Unlock()
+	switch {
+	case found && cache.own:
+		if vtable.fork != nil {
+			value = vtable.fork.resolve(symbol, value)
+		}
+		return value, true
+	case found || cache.own || vtable.Parent != cache.parent:
+		return nil, false
+	}
+	for _, entry := range cache.chain {
+		if atomic.LoadUint64(&entry.symbols.version) != entry.version {
+			return nil, false
+		}
+	}
+	return cache.result, true
+}
+
+/*
+selector resolves the symbol in the receiver, reusing the result of the previous execution of the
+instruction while the receiver has the same parent table and the symbol tables walked to find it stay
+unchanged, so new instances of a class hit the entry of the previous ones
+*/
+func (caches *inlineCaches) selector(rip int64, receiver *Value, symbol string) (*Value, error) {
+	if caches == nil || receiver.proxy != nil {
+		// Go struct fields can change outside the VM
+		return receiver.Get(symbol)
+	}
+	if cached, found := caches.selectors.Load(rip); found {
+		if result, hit := cached.(*selectorCache).get(receiver.vtable, symbol); hit {
+			atomic.AddUint64(&caches.hits, 1)
+			return result, nil
+		}
+	}
+	result, chain, found := receiver.vtable.lookup(symbol)
+	if !found {
+		// Missing symbols may be generated on demand, those are stored in the receiver virtual table
+		var getError error
+		result, getError = receiver.Get(symbol)
+		if getError != nil {
+			return nil, getError
+		}
+		result, chain, found = receiver.vtable.lookup(symbol)
+		if !found {
+			return result, nil
+		}
+	}
+	cache := &selectorCache{
+		parent: receiver.vtable.Parent,
+		own:    len(chain) == 1,
+		chain:  chain[1:],
+	}
+	if !cache.own {
+		cache.result = result
+	}
+	caches.selectors.Store(rip, cache)
+	return result, nil
+}
+
+/*
+constant returns the value of the literal loaded by the instruction, materializing it only the first time
+the instruction runs. The value is frozen and shared since every execution of the bytecode uses it
+*/
+func (caches *inlineCaches) constant(rip int64, materialize func() *Value) *Value {
+	if caches == nil {
+		return materialize()
+	}
+	if cached, found := caches.constants.Load(rip); found {
+		return cached.(*Value)
+	}
+	value := materialize()
+	if !value.shared {
+		value.frozen, value.shared = true, true
+	}
+	result, _ := caches.constants.LoadOrStore(rip, value)
+	return result.(*Value)
+}
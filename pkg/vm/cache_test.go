@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInlineCaches_SelectorInvalidation(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	caches := newInlineCaches()
+	parent := p.NewValue(p.RootSymbols(), ValueId, p.ValueClass())
+	parent.Set("x", p.NewInt(1))
+	child := p.NewValue(parent.VirtualTable(), ValueId, p.ValueClass())
+	// Miss, then hit
+	for i := 0; i < 2; i++ {
+		result, err := caches.selector(0, child, "x")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), result.GetInt64())
+	}
+	// Set in the table that owns the symbol
+	parent.Set("x", p.NewInt(2))
+	result, err := caches.selector(0, child, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.GetInt64())
+	// Shadow in the receiver
+	child.Set("x", p.NewInt(3))
+	result, err = caches.selector(0, child, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), result.GetInt64())
+	// Del from the receiver
+	assert.Nil(t, child.Del("x"))
+	result, err = caches.selector(0, child, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.GetInt64())
+	// Different receiver
+	other := p.NewValue(p.RootSymbols(), ValueId, p.ValueClass())
+	other.Set("x", p.NewInt(4))
+	result, err = caches.selector(0, other, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), result.GetInt64())
+	// On demand symbols
+	result, err = caches.selector(1, other, "__class__")
+	assert.Nil(t, err)
+	assert.Equal(t, BuiltInFunctionId, result.TypeId())
+}
+
+func TestInlineCaches_Script(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := NewVM(nil, out, nil)
+	_, errCh, _ := p.ExecuteString(`
+a = Value()
+a.f = 0
+def show()
+	println(a.f)
+end
+for i in range(0, 3)
+	show()
+	a.f = a.f + 1
+end
+delete a.f
+a.f = "deleted"
+show()
+`)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, "0\n1\n2\ndeleted\n", out.String())
+}
+
+func TestInlineCaches_NewInstances(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	caches := newInlineCaches()
+	class := p.NewValue(p.RootSymbols(), ValueId, p.ValueClass())
+	class.Set("scale", p.NewInt(2))
+	for i := int64(0); i < 100; i++ {
+		instance := p.NewValue(class.VirtualTable(), ValueId, p.ValueClass())
+		instance.Set("x", p.NewInt(i))
+		x, err := caches.selector(0, instance, "x")
+		assert.Nil(t, err)
+		assert.Equal(t, i, x.GetInt64())
+		scale, err := caches.selector(1, instance, "scale")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), scale.GetInt64())
+	}
+	// Every instance after the first one hits both entries
+	assert.Equal(t, uint64(2*99), atomic.LoadUint64(&caches.hits))
+	// Shadowing the attribute of the class misses once
+	instance := p.NewValue(class.VirtualTable(), ValueId, p.ValueClass())
+	instance.Set("scale", p.NewInt(3))
+	scale, err := caches.selector(1, instance, "scale")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), scale.GetInt64())
+	assert.Equal(t, uint64(2*99), atomic.LoadUint64(&caches.hits))
+}
+
+func TestInlineCaches_Fork(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, `
+class Point
+	def __init__(x)
+		self.x = x
+	end
+end
+def total(n)
+	result = 0
+	for i in range(0, n)
+		result = result + Point(i).x
+	end
+	return result
+end
+`)
+	total, getError := p.RootSymbols().Get("total")
+	assert.Nil(t, getError)
+	point, getError := p.RootSymbols().Get("Point")
+	assert.Nil(t, getError)
+	fork := p.Fork()
+	forkedTotal, getError := fork.RootSymbols().Get("total")
+	assert.Nil(t, getError)
+	forkedPoint, getError := fork.RootSymbols().Get("Point")
+	assert.Nil(t, getError)
+	// Forks fill caches of their own
+	assert.NotSame(t, total.GetFuncInfo().caches, forkedTotal.GetFuncInfo().caches)
+	assert.NotSame(t, point.GetClassInfo().caches, forkedPoint.GetClassInfo().caches)
+	for vm, function := range map[*Plasma]*Value{p: total, fork: forkedTotal} {
+		result, callError := vm.CallValue(function, vm.NewInt(10))
+		assert.Nil(t, callError)
+		assert.Equal(t, int64(45), result.GetInt64())
+	}
+}
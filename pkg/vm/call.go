@@ -0,0 +1,117 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/shoriwe/plasma/pkg/common"
+	"reflect"
+)
+
+/*
+CallValue calls the function with the arguments and waits for its result. It works with built-in functions,
+script functions, classes and any value implementing __call__. Script code runs on a fresh context whose
+caller symbols are the root symbols of the VM
+*/
+func (plasma *Plasma) CallValue(function *Value, arguments ...*Value) (*Value, error) {
+	return plasma.CallValueContext(gocontext.Background(), function, arguments...)
+}
+
+/*
+CallValueContext is CallValue aborting the call when the context.Context is done, like ExecuteContext does
+*/
+func (plasma *Plasma) CallValueContext(goContext gocontext.Context, function *Value, arguments ...*Value) (*Value, error) {
+	return plasma.callIn(goContext, plasma.rootSymbols, function, arguments)
+}
+
+/*
+callIn runs the call on a fresh context whose caller symbols are the symbols
+*/
+func (plasma *Plasma) callIn(goContext gocontext.Context, symbols *Symbols, function *Value, arguments []*Value) (*Value, error) {
+	if goContext.Err() != nil {
+		return nil, cancellationError(goContext)
+	}
+	ctx := &context{
+		code:           &common.ListStack[*contextCode]{},
+		stack:          &common.ListStack[*Value]{},
+		register:       nil,
+		currentSymbols: symbols,
+		goContext:      goContext,
+		limits:         newExecutionLimits(plasma.limits),
+		stopped:        plasma.stopped,
+		hooks:          plasma.Hooks(),
+		debugger:       plasma.Debugger(),
+		opcode:         opcodes.Call,
+	}
+	runError := func() (callError error) {
+		defer func() {
+			err := recover()
+			if err != nil {
+				callError = executionError(err)
+			}
+		}()
+		plasma.call(ctx, function, arguments)
+		return nil
+	}()
+	if runError == nil {
+		runError = plasma.run(ctx)
+	}
+	if runError != nil {
+		return nil, runError
+	}
+	if ctx.register == nil {
+		return plasma.none, nil
+	}
+	return ctx.register, nil
+}
+
+/*
+Call converts the arguments with ToValue, calls the function with CallValue and converts its result to T.
+Arguments that already are *Value are passed untouched, the same applies for the result only when T is *Value,
+interface types like any get the result of FromValue
+*/
+func Call[T any](plasma *Plasma, function *Value, arguments ...any) (T, error) {
+	var zero T
+	callArguments, toValueError := plasma.toArguments(arguments)
+	if toValueError != nil {
+		return zero, toValueError
+	}
+	result, callError := plasma.CallValue(function, callArguments...)
+	if callError != nil {
+		return zero, callError
+	}
+	if reflect.TypeOf(&zero).Elem() == valueType {
+		return any(result).(T), nil
+	}
+	goValue, fromValueError := plasma.FromValue(result)
+	if fromValueError != nil {
+		return zero, fromValueError
+	}
+	if goValue == nil {
+		return zero, nil
+	}
+	converted, convertError := reflectConvert(reflect.ValueOf(goValue), reflect.TypeOf(&zero).Elem())
+	if convertError != nil {
+		return zero, convertError
+	}
+	return converted.Interface().(T), nil
+}
+
+/*
+toArguments converts the arguments with ToValue, *Value arguments are passed untouched
+*/
+func (plasma *Plasma) toArguments(arguments []any) ([]*Value, error) {
+	callArguments := make([]*Value, 0, len(arguments))
+	for index, argument := range arguments {
+		if value, isValue := argument.(*Value); isValue {
+			callArguments = append(callArguments, value)
+			continue
+		}
+		value, toValueError := plasma.ToValue(plasma.rootSymbols, argument)
+		if toValueError != nil {
+			return nil, fmt.Errorf("argument %d: %w", index, toValueError)
+		}
+		callArguments = append(callArguments, value)
+	}
+	return callArguments, nil
+}
@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func loadScript(t *testing.T, p *Plasma, script string) {
+	_, errCh, _ := p.ExecuteString(script)
+	assert.Nil(t, <-errCh)
+}
+
+func TestPlasma_CallValue(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := NewVM(nil, out, nil)
+	loadScript(t, p, `
+state = Value()
+state.events = 0
+def handle_event(name, value)
+	state.events += 1
+	println(name)
+	return value * 2
+end
+class Event
+	def __init__(name)
+		self.name = name
+	end
+end
+`)
+	handleEvent, getError := p.RootSymbols().Get("handle_event")
+	assert.Nil(t, getError)
+	result, callError := p.CallValue(handleEvent, p.NewString([]byte("click")), p.NewInt(21))
+	assert.Nil(t, callError)
+	assert.Equal(t, int64(42), result.GetInt64())
+	assert.Equal(t, "click\n", out.String())
+	state, _ := p.RootSymbols().Get("state")
+	events, _ := state.Get("events")
+	assert.Equal(t, int64(1), events.GetInt64())
+	// Classes
+	event, _ := p.RootSymbols().Get("Event")
+	object, callError := p.CallValue(event, p.NewString([]byte("hover")))
+	assert.Nil(t, callError)
+	name, _ := object.Get("name")
+	assert.Equal(t, "hover", name.String())
+	// Built-ins
+	result, callError = p.CallValue(p.IntClass(), p.NewFloat(6.5))
+	assert.Nil(t, callError)
+	assert.Equal(t, int64(6), result.GetInt64())
+}
+
+func TestPlasma_CallValueErrors(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, `
+def fail()
+	return undefined_symbol
+end
+def one(a)
+	return a
+end
+`)
+	fail, _ := p.RootSymbols().Get("fail")
+	_, callError := p.CallValue(fail)
+	assert.NotNil(t, callError)
+	one, _ := p.RootSymbols().Get("one")
+	_, callError = p.CallValue(one)
+	assert.NotNil(t, callError)
+	_, callError = p.CallValue(p.NewInt(1))
+	assert.NotNil(t, callError)
+	// The VM keeps working after failed calls
+	result, callError := p.CallValue(one, p.NewInt(1))
+	assert.Nil(t, callError)
+	assert.Equal(t, int64(1), result.GetInt64())
+}
+
+func TestCall(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, `
+def add(a, b)
+	return a + b
+end
+def greet(name)
+	return "Hello " + name
+end
+def nothing()
+	return none
+end
+`)
+	add, _ := p.RootSymbols().Get("add")
+	sum, callError := Call[int](p, add, 1, 2)
+	assert.Nil(t, callError)
+	assert.Equal(t, 3, sum)
+	f, callError := Call[float64](p, add, 1, 0.5)
+	assert.Nil(t, callError)
+	assert.Equal(t, 1.5, f)
+	greet, _ := p.RootSymbols().Get("greet")
+	greeting, callError := Call[string](p, greet, p.NewString([]byte("Plasma")))
+	assert.Nil(t, callError)
+	assert.Equal(t, "Hello Plasma", greeting)
+	value, callError := Call[*Value](p, greet, "Go")
+	assert.Nil(t, callError)
+	assert.Equal(t, "Hello Go", value.String())
+	// Interfaces get the Go value, not the *Value
+	anything, callError := Call[any](p, greet, "Go")
+	assert.Nil(t, callError)
+	assert.Equal(t, "Hello Go", anything)
+	anything, callError = Call[interface{}](p, add, 1, 2)
+	assert.Nil(t, callError)
+	assert.Equal(t, int64(3), anything)
+	nothing, _ := p.RootSymbols().Get("nothing")
+	anything, callError = Call[any](p, nothing)
+	assert.Nil(t, callError)
+	assert.Nil(t, anything)
+	zero, callError := Call[int](p, nothing)
+	assert.Nil(t, callError)
+	assert.Equal(t, 0, zero)
+	_, callError = Call[int](p, greet, "Go")
+	assert.NotNil(t, callError)
+}
+
+func TestCallValueFromBuiltIn(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := NewVM(nil, out, nil)
+	p.Load("apply", func(plasma *Plasma) *Value {
+		return plasma.NewBuiltInFunction(plasma.RootSymbols(), func(argument ...*Value) (*Value, error) {
+			return plasma.CallValue(argument[0], argument[1])
+		})
+	})
+	loadScript(t, p, `
+def double(x)
+	return x * 2
+end
+println(apply(double, 4))
+`)
+	assert.Equal(t, "8\n", out.String())
+}
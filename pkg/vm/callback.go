@@ -0,0 +1,46 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+)
+
+/*
+NewCallback holds the script callable so Go can call it later, for example a lambda received by a built-in
+subscribing to events. Every call runs on its own context with the symbols the callable was defined in as
+caller symbols, so the callback can be called from any goroutine, even while other executions of the VM run.
+The arguments are converted with ToValue and the result with FromValue, *Value arguments are passed untouched.
+Calls honor the limits set with WithLimits and fail with ErrStopped after Plasma.Stop
+*/
+func (plasma *Plasma) NewCallback(function *Value) (PlasmaCallback, error) {
+	return plasma.NewCallbackContext(gocontext.Background(), function)
+}
+
+/*
+NewCallbackContext is NewCallback whose calls are aborted when the context.Context is done
+*/
+func (plasma *Plasma) NewCallbackContext(goContext gocontext.Context, function *Value) (PlasmaCallback, error) {
+	switch function.TypeId() {
+	case FunctionId, BuiltInFunctionId, BuiltInClassId, ClassId:
+	default:
+		if _, getError := function.Get(magic_functions.Call); getError != nil {
+			return nil, fmt.Errorf("%w: %s is not callable", ErrTypeMismatch, function.TypeId())
+		}
+	}
+	symbols := function.VirtualTable()
+	if symbols == nil {
+		symbols = plasma.rootSymbols
+	}
+	return func(arguments ...any) (any, error) {
+		callArguments, toValueError := plasma.toArguments(arguments)
+		if toValueError != nil {
+			return nil, toValueError
+		}
+		result, callError := plasma.callIn(goContext, symbols, function, callArguments)
+		if callError != nil {
+			return nil, callError
+		}
+		return plasma.FromValue(result)
+	}, nil
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestPlasma_NewCallback(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	handlers := map[string]PlasmaCallback{}
+	p.Load("on", func(plasma *Plasma) *Value {
+		return plasma.NewBuiltInFunction(plasma.RootSymbols(), func(argument ...*Value) (*Value, error) {
+			callback, callbackError := plasma.NewCallback(argument[1])
+			if callbackError != nil {
+				return nil, callbackError
+			}
+			handlers[argument[0].String()] = callback
+			return plasma.None(), nil
+		})
+	})
+	loadScript(t, p, `
+def subscribe(prefix)
+	on("order.created", lambda order: prefix + order["id"])
+end
+subscribe("order ")
+on("order.total", lambda order: order["price"] * order["amount"])`)
+	// Callbacks run after the execution finished, from many goroutines
+	var wait sync.WaitGroup
+	for index := 0; index < 10; index++ {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			result, callError := handlers["order.created"](map[string]any{"id": fmt.Sprint(index)})
+			assert.Nil(t, callError)
+			assert.Equal(t, fmt.Sprintf("order %d", index), result)
+			result, callError = handlers["order.total"](map[string]any{"price": 3, "amount": index})
+			assert.Nil(t, callError)
+			assert.Equal(t, int64(3*index), result)
+		}(index)
+	}
+	wait.Wait()
+	// Errors of the script are returned
+	_, callError := handlers["order.created"](map[string]any{})
+	assert.NotNil(t, callError)
+	_, callError = handlers["order.created"](1, 2)
+	assert.NotNil(t, callError)
+	_, callbackError := p.NewCallback(p.NewInt(1))
+	assert.ErrorIs(t, callbackError, ErrTypeMismatch)
+}
+
+func TestPlasma_NewCallbackLimits(t *testing.T) {
+	p := NewVM(nil, nil, nil, WithLimits(Limits{MaxInstructions: 1000}))
+	loadScript(t, p, `
+def forever()
+	while true
+		pass
+	end
+end`)
+	forever, _ := p.RootSymbols().Get("forever")
+	callback, callbackError := p.NewCallback(forever)
+	assert.Nil(t, callbackError)
+	_, callError := callback()
+	assert.ErrorIs(t, callError, ErrInstructionLimit)
+	// Executions use the limits of the VM too
+	_, errCh, _ := p.ExecuteString("forever()")
+	assert.ErrorIs(t, <-errCh, ErrInstructionLimit)
+}
+
+func TestPlasma_Stop(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, `
+def forever()
+	while true
+		pass
+	end
+end`)
+	forever, _ := p.RootSymbols().Get("forever")
+	callback, callbackError := p.NewCallback(forever)
+	assert.Nil(t, callbackError)
+	called := make(chan error)
+	go func() {
+		_, callError := callback()
+		called <- callError
+	}()
+	_, errCh, _ := p.ExecuteString("forever()")
+	p.Stop()
+	assert.ErrorIs(t, <-called, ErrStopped)
+	assert.ErrorIs(t, <-errCh, ErrStopped)
+	// Later calls fail immediately
+	_, callError := callback()
+	assert.ErrorIs(t, callError, ErrStopped)
+	p.Stop()
+}
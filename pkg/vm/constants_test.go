@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestPlasma_NewIntInterned(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	for _, i := range []int64{minSmallInt, -1, 0, 1, maxSmallInt} {
+		assert.Same(t, p.NewInt(i), p.NewInt(i))
+		assert.True(t, p.NewInt(i).Frozen())
+		assert.Equal(t, i, p.NewInt(i).GetInt64())
+	}
+	for _, i := range []int64{minSmallInt - 1, maxSmallInt + 1} {
+		assert.NotSame(t, p.NewInt(i), p.NewInt(i))
+		assert.False(t, p.NewInt(i).Frozen())
+	}
+	// Interned values are per VM
+	assert.NotSame(t, p.NewInt(1), NewVM(nil, nil, nil).NewInt(1))
+}
+
+func TestConstantsMaterializedOnce(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	rCh, errCh, _ := p.ExecuteString(`
+def constants()
+	return (5000, 1.5, "Plasma", b"Plasma")
+end
+(constants(), constants())
+`)
+	assert.Nil(t, <-errCh)
+	results := (<-rCh).GetValues()
+	first, second := results[0].GetValues(), results[1].GetValues()
+	for index := range first {
+		assert.Same(t, first[index], second[index])
+		assert.True(t, first[index].Frozen())
+	}
+}
+
+func TestConstantsCopiedOnWrite(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := NewVM(nil, out, nil)
+	_, errCh, _ := p.ExecuteString(`
+def literal()
+	return 5
+end
+a = 5
+a.x = 1
+b = 'Plasma'
+b.x = 2
+holder = Value()
+holder.value = 500 + 500
+holder.value.x = 3
+c = 1.5
+delete c.__add__
+println(a.x, b.x, holder.value.x, literal() + 0, 2 + 3)
+println(literal().x)
+`)
+	err := <-errCh
+	assert.NotNil(t, err)
+	// Attributes go to a copy bound to the variable, the shared values stay untouched
+	assert.Equal(t, "1 2 3 5 5\n", out.String())
+	assert.Contains(t, err.Error(), "x")
+	assert.Equal(t, int64(5), p.NewInt(5).GetInt64())
+	_, getError := p.NewInt(5).Get("x")
+	assert.NotNil(t, getError)
+	_, getError = p.NewInt(1000).Get("x")
+	assert.NotNil(t, getError)
+	for _, script := range []string{
+		"true.x = 1",
+		"delete none.__string__",
+		"numbers = [5]\nnumbers[0].x = 1",
+		"literal().x = 1",
+	} {
+		_, errCh, _ := p.ExecuteString(script)
+		err := <-errCh
+		assert.NotNil(t, err, script)
+		assert.Contains(t, err.Error(), ErrImmutableValue.Error(), script)
+	}
+}
+
+/*
+TestConstantsConcurrent is meant to be run with the race detector, executions share the interned
+integers of the VM and the constants of the function
+*/
+func TestConstantsConcurrent(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	_, errCh, _ := p.ExecuteString(`
+def sum(n)
+	result = 0
+	for i in range(0, n)
+		result = result + i * 2 - 1 + 1.5 - 1.5
+	end
+	return result.__string__() + " done"
+end
+`)
+	assert.Nil(t, <-errCh)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rCh, errCh, _ := p.ExecuteString(fmt.Sprintf("sum(%d)", 10+worker))
+			assert.Nil(t, <-errCh)
+			n := int64(10 + worker)
+			assert.Equal(t, fmt.Sprintf("%f done", float64(n*(n-1)-n)), (<-rCh).String())
+			for i := minSmallInt; i <= maxSmallInt; i++ {
+				assert.Equal(t, i, p.NewInt(i).GetInt64())
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
@@ -1,6 +1,8 @@
 package vm
 
 import (
+	gocontext "context"
+	"errors"
 	"github.com/shoriwe/plasma/pkg/common"
 )
 
@@ -9,6 +11,20 @@ type (
 		bytecode []byte
 		rip      int64
 		onExit   *common.ListStack[[]byte]
+		caches   *inlineCaches
+		function string // Name of the function the code belongs to
+		call     bool   // Code pushed by a call, its end returns to the caller
+		line     int    // Source line of the running statement, only known when the bytecode records positions
+	}
+	/*
+		loadedSymbol is the symbol read by the last Identifier or Selector instruction, so a shared value it
+		produced can be replaced by a private copy when the following instruction modifies its attributes
+	*/
+	loadedSymbol struct {
+		code     *contextCode
+		next     int64  // Offset of the instruction after the load
+		receiver *Value // nil for identifiers
+		name     string
 	}
 	context struct {
 		result         chan *Value
@@ -18,6 +34,18 @@ type (
 		stack          *common.ListStack[*Value]
 		register       *Value
 		currentSymbols *Symbols
+		goContext      gocontext.Context
+		limits         *executionLimits
+		stopped        <-chan struct{} // Closed by Plasma.Stop
+		suspend        <-chan struct{} // Signaled by Execution.Suspend, nil for other executions
+		suspended      bool            // Set when a built-in returned ErrSuspended or a Pending
+		pending        *Pending
+		hooks          *Hooks
+		debugger       *Debugger
+		instruction    int64 // Offset of the running instruction, only tracked when hooks are installed
+		opcode         byte
+		loaded         loadedSymbol
+		bytecodeError  error // Returned by run when the bytecode has no valid format header or fails the Verify option
 	}
 )
 
@@ -33,12 +61,17 @@ func (ctx *context) hasNext() bool {
 	return false
 }
 
-func (plasma *Plasma) newContext(bytecode []byte) *context {
+/*
+newContext prepares the execution of the program, its format header is checked by run
+*/
+func (plasma *Plasma) newContext(program []byte) *context {
+	bytecode, headerError := programBody(program)
 	codeStack := &common.ListStack[*contextCode]{}
 	codeStack.Push(&contextCode{
 		bytecode: bytecode,
 		rip:      0,
 		onExit:   &common.ListStack[[]byte]{},
+		caches:   newInlineCaches(),
 	})
 	return &context{
 		result:         nil,
@@ -48,5 +81,21 @@ func (plasma *Plasma) newContext(bytecode []byte) *context {
 		stack:          &common.ListStack[*Value]{},
 		register:       nil,
 		currentSymbols: plasma.rootSymbols,
+		goContext:      gocontext.Background(),
+		limits:         newExecutionLimits(plasma.limits),
+		stopped:        plasma.stopped,
+		hooks:          plasma.Hooks(),
+		debugger:       plasma.Debugger(),
+		bytecodeError:  headerError,
+	}
+}
+
+/*
+cancellationError translates the reason the context.Context finished to the error reported by the execution
+*/
+func cancellationError(goContext gocontext.Context) error {
+	if errors.Is(goContext.Err(), gocontext.DeadlineExceeded) {
+		return gocontext.DeadlineExceeded
 	}
+	return ErrCancelled
 }
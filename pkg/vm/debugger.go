@@ -0,0 +1,295 @@
+package vm
+
+import (
+	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
+	"sync"
+)
+
+const (
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+const (
+	debuggerRunning debuggerMode = iota
+	debuggerPausing
+	debuggerStepIn
+	debuggerStepOver
+	debuggerStepOut
+)
+
+type (
+	/*
+		StopReason explains why the execution stopped
+	*/
+	StopReason   string
+	debuggerMode int
+	/*
+		Frame is a function being executed when the execution stopped. Locals are the symbols assigned by the
+		function, for the top level code they are the globals without the built-ins. Self is nil outside methods
+	*/
+	Frame struct {
+		Function string
+		Line     int
+		Locals   map[string]*Value
+		Self     *Value
+	}
+	/*
+		Stop describes a stopped execution, Frames start with the innermost function and Stack with the top
+		of the operand stack
+	*/
+	Stop struct {
+		Reason StopReason
+		Line   int
+		Frames []Frame
+		Stack  []*Value
+	}
+	/*
+		Debugger stops the executions of a VM at line breakpoints and steps through them, the bytecode must be
+		compiled with compiler.Options.SourcePositions. A debugger serves one execution at a time
+	*/
+	Debugger struct {
+		mutex       sync.Mutex
+		breakpoints map[int]struct{}
+		mode        debuggerMode
+		depth       int
+		paused      bool
+		stops       chan *Stop
+		resume      chan struct{}
+	}
+)
+
+/*
+NewDebugger creates a debugger without breakpoints, attach it to a VM with SetDebugger
+*/
+func NewDebugger() *Debugger {
+	return &Debugger{
+		breakpoints: map[int]struct{}{},
+		stops:       make(chan *Stop),
+		resume:      make(chan struct{}, 1),
+	}
+}
+
+/*
+SetDebugger attaches the debugger to the executions started after the call, nil detaches it.
+Executions without a debugger do not pay for it
+*/
+func (plasma *Plasma) SetDebugger(debugger *Debugger) {
+	plasma.debugger.Store(debugger)
+}
+
+/*
+Debugger returns the attached debugger, nil when there is none
+*/
+func (plasma *Plasma) Debugger() *Debugger {
+	debugger, _ := plasma.debugger.Load().(*Debugger)
+	return debugger
+}
+
+/*
+Stops receives every stop of the debugged execution, the execution waits until the stop is received and
+then until Continue or one of the step methods is called
+*/
+func (debugger *Debugger) Stops() <-chan *Stop {
+	return debugger.stops
+}
+
+/*
+SetBreakpoints replaces the breakpoints with the lines
+*/
+func (debugger *Debugger) SetBreakpoints(lines ...int) {
+	debugger.mutex.Lock()
+	defer debugger.mutex.Unlock()
+	debugger.breakpoints = make(map[int]struct{}, len(lines))
+	for _, line := range lines {
+		debugger.breakpoints[line] = struct{}{}
+	}
+}
+
+/*
+ClearBreakpoints removes every breakpoint
+*/
+func (debugger *Debugger) ClearBreakpoints() {
+	debugger.SetBreakpoints()
+}
+
+/*
+Continue resumes the stopped execution until the next breakpoint
+*/
+func (debugger *Debugger) Continue() {
+	debugger.command(debuggerRunning)
+}
+
+/*
+StepIn resumes the stopped execution until the next line, entering called functions
+*/
+func (debugger *Debugger) StepIn() {
+	debugger.command(debuggerStepIn)
+}
+
+/*
+StepOver resumes the stopped execution until the next line of the same function or its callers
+*/
+func (debugger *Debugger) StepOver() {
+	debugger.command(debuggerStepOver)
+}
+
+/*
+StepOut resumes the stopped execution until the next line of the caller
+*/
+func (debugger *Debugger) StepOut() {
+	debugger.command(debuggerStepOut)
+}
+
+/*
+Pause stops the running execution at the next line, calling it before the execution starts stops it at
+its first line
+*/
+func (debugger *Debugger) Pause() {
+	debugger.mutex.Lock()
+	defer debugger.mutex.Unlock()
+	if !debugger.paused {
+		debugger.mode = debuggerPausing
+	}
+}
+
+func (debugger *Debugger) command(mode debuggerMode) {
+	debugger.mutex.Lock()
+	defer debugger.mutex.Unlock()
+	debugger.mode = mode
+	if debugger.paused {
+		debugger.paused = false
+		debugger.resume <- struct{}{}
+	}
+}
+
+/*
+callDepth counts the functions being executed, the top level code is the first
+*/
+func (ctx *context) callDepth() int {
+	depth := 1
+	for current := ctx.code.Top; current != nil; current = current.Next {
+		if current.Value.(*contextCode).call {
+			depth++
+		}
+	}
+	return depth
+}
+
+/*
+reason decides if the execution stops at the line, depth is the call depth of the line
+*/
+func (debugger *Debugger) reason(line, depth int) (StopReason, bool) {
+	debugger.mutex.Lock()
+	defer debugger.mutex.Unlock()
+	switch {
+	case debugger.mode == debuggerPausing:
+		return StopPause, true
+	case debugger.mode == debuggerStepIn,
+		debugger.mode == debuggerStepOver && depth <= debugger.depth,
+		debugger.mode == debuggerStepOut && depth < debugger.depth:
+		return StopStep, true
+	}
+	_, found := debugger.breakpoints[line]
+	return StopBreakpoint, found
+}
+
+/*
+line is called before running the statements of a source line, it blocks the execution while it is stopped
+*/
+func (debugger *Debugger) line(ctx *context, line int) {
+	depth := ctx.callDepth()
+	reason, stop := debugger.reason(line, depth)
+	if !stop {
+		return
+	}
+	snapshot := ctx.snapshot(reason, line)
+	debugger.mutex.Lock()
+	debugger.mode = debuggerRunning
+	debugger.depth = depth
+	debugger.paused = true
+	debugger.mutex.Unlock()
+	select {
+	case debugger.stops <- snapshot:
+	case <-ctx.stop:
+		debugger.abort(ctx, true)
+		return
+	case <-ctx.goContext.Done():
+		debugger.abort(ctx, false)
+		return
+	case <-ctx.stopped:
+		debugger.abort(ctx, false)
+		return
+	}
+	select {
+	case <-debugger.resume:
+	case <-ctx.stop:
+		debugger.abort(ctx, true)
+	case <-ctx.goContext.Done():
+		debugger.abort(ctx, false)
+	case <-ctx.stopped:
+		debugger.abort(ctx, false)
+	}
+}
+
+/*
+abort releases the stopped execution when it is stopped or cancelled, the stop request of the execution is kept
+for the run loop when resend is set
+*/
+func (debugger *Debugger) abort(ctx *context, resend bool) {
+	debugger.mutex.Lock()
+	debugger.paused = false
+	debugger.mutex.Unlock()
+	if resend {
+		ctx.stop <- struct{}{}
+	}
+}
+
+/*
+snapshot describes the frames and the operand stack of the context
+*/
+func (ctx *context) snapshot(reason StopReason, line int) *Stop {
+	stop := &Stop{
+		Reason: reason,
+		Line:   line,
+	}
+	for current := ctx.stack.Top; current != nil; current = current.Next {
+		stop.Stack = append(stop.Stack, current.Value.(*Value))
+	}
+	symbols := ctx.currentSymbols
+	for current := ctx.code.Top; current != nil; {
+		code := current.Value.(*contextCode)
+		frame := Frame{
+			Function: code.function,
+			Line:     code.line,
+			Locals:   map[string]*Value{},
+		}
+		// The frame owns the codes pushed since its call
+		for current != nil && !current.Value.(*contextCode).call {
+			current = current.Next
+		}
+		if current != nil {
+			current = current.Next
+		}
+		if self, getError := symbols.Get(special_symbols.Self); getError == nil {
+			frame.Self = self
+		}
+		for symbols != nil {
+			for name, value := range symbols.Values() {
+				if _, shadowed := frame.Locals[name]; shadowed || value.TypeId() == BuiltInFunctionId ||
+					value.TypeId() == BuiltInClassId {
+					continue
+				}
+				frame.Locals[name] = value
+			}
+			if symbols.call != nil {
+				symbols = symbols.call
+				break
+			}
+			symbols = symbols.Parent
+		}
+		stop.Frames = append(stop.Frames, frame)
+	}
+	return stop
+}
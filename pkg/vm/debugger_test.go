@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"github.com/shoriwe/plasma/pkg/test-samples/success"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const debuggedScript = `def double(n)
+	result = n * 2
+	return result
+end
+total = 0
+for i in range(0, 3)
+	total = total + double(i)
+end
+total`
+
+func debug(t *testing.T, script string, debugger *Debugger) (*Plasma, chan error, chan struct{}) {
+	bytecode, compileError := compiler.CompileWithOptions(script, compiler.Options{SourcePositions: true})
+	assert.Nil(t, compileError)
+	p := NewVM(nil, nil, nil)
+	p.SetDebugger(debugger)
+	assert.Same(t, debugger, p.Debugger())
+	_, errCh, stop := p.Execute(bytecode)
+	return p, errCh, stop
+}
+
+func TestSourcePositionsSampleScripts(t *testing.T) {
+	for index := 1; index <= len(success.Samples); index++ {
+		script := success.Samples[fmt.Sprintf("sample-%d.pm", index)]
+		// Alternate the optimizations, the markers must survive both pipelines
+		bytecode, compileError := compiler.CompileWithOptions(script.Code, compiler.Options{
+			Optimize:        index%2 == 0,
+			SourcePositions: true,
+		})
+		assert.Nil(t, compileError, index)
+		assert.Nil(t, Verify(bytecode), index)
+		out := &bytes.Buffer{}
+		rCh, errCh, _ := NewVM(nil, out, nil).Execute(bytecode)
+		assert.Nil(t, <-errCh, index)
+		<-rCh
+		assert.Equal(t, script.Result, out.String(), index)
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	debugger := NewDebugger()
+	debugger.SetBreakpoints(3)
+	_, errCh, _ := debug(t, debuggedScript, debugger)
+	for n := int64(0); n < 3; n++ {
+		stop := <-debugger.Stops()
+		assert.Equal(t, StopBreakpoint, stop.Reason)
+		assert.Equal(t, 3, stop.Line)
+		assert.Equal(t, 2, len(stop.Frames))
+		assert.Equal(t, "double", stop.Frames[0].Function)
+		assert.Equal(t, 3, stop.Frames[0].Line)
+		assert.Equal(t, n, stop.Frames[0].Locals["n"].GetInt64())
+		assert.Equal(t, 2*n, stop.Frames[0].Locals["result"].GetInt64())
+		assert.NotContains(t, stop.Frames[0].Locals, "total")
+		assert.Nil(t, stop.Frames[0].Self)
+		assert.Equal(t, "", stop.Frames[1].Function)
+		assert.Equal(t, 7, stop.Frames[1].Line)
+		assert.Equal(t, n, stop.Frames[1].Locals["i"].GetInt64())
+		assert.Contains(t, stop.Frames[1].Locals, "double")
+		assert.NotContains(t, stop.Frames[1].Locals, "println")
+		if n == 2 {
+			debugger.ClearBreakpoints()
+		}
+		debugger.Continue()
+	}
+	assert.Nil(t, <-errCh)
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	debugger := NewDebugger()
+	debugger.SetBreakpoints(7)
+	_, errCh, _ := debug(t, debuggedScript, debugger)
+	expect := func(reason StopReason, line int, function string) *Stop {
+		stop := <-debugger.Stops()
+		assert.Equal(t, reason, stop.Reason)
+		assert.Equal(t, line, stop.Line)
+		assert.Equal(t, function, stop.Frames[0].Function)
+		return stop
+	}
+	expect(StopBreakpoint, 7, "")
+	debugger.ClearBreakpoints()
+	debugger.StepIn()
+	expect(StopStep, 2, "double")
+	debugger.StepOver()
+	stop := expect(StopStep, 3, "double")
+	// The operand stack is empty between statements
+	assert.Empty(t, stop.Stack)
+	debugger.StepOut()
+	stop = expect(StopStep, 7, "")
+	assert.Equal(t, int64(1), stop.Frames[0].Locals["i"].GetInt64())
+	assert.Equal(t, int64(0), stop.Frames[0].Locals["total"].GetInt64())
+	debugger.StepOver()
+	stop = expect(StopStep, 7, "")
+	assert.Equal(t, int64(2), stop.Frames[0].Locals["total"].GetInt64())
+	debugger.StepOver()
+	expect(StopStep, 9, "")
+	debugger.Continue()
+	assert.Nil(t, <-errCh)
+}
+
+func TestDebuggerPause(t *testing.T) {
+	debugger := NewDebugger()
+	debugger.Pause()
+	_, errCh, stopCh := debug(t, `class Counter
+	def __init__()
+		self.count = 0
+	end
+end
+counter = Counter()
+while true
+	counter.count += 1
+end`, debugger)
+	stop := <-debugger.Stops()
+	assert.Equal(t, StopPause, stop.Reason)
+	assert.Equal(t, 1, stop.Line)
+	debugger.SetBreakpoints(3)
+	debugger.Continue()
+	stop = <-debugger.Stops()
+	assert.Equal(t, StopBreakpoint, stop.Reason)
+	assert.Equal(t, "__init__", stop.Frames[0].Function)
+	assert.NotNil(t, stop.Frames[0].Self)
+	debugger.ClearBreakpoints()
+	debugger.Continue()
+	// The endless loop is paused at its body once it incremented the counter
+	for {
+		debugger.Pause()
+		stop = <-debugger.Stops()
+		assert.Equal(t, StopPause, stop.Reason)
+		if counter, found := stop.Frames[0].Locals["counter"]; found && stop.Line == 8 {
+			if count, _ := counter.Get("count"); count.GetInt64() > 0 {
+				break
+			}
+		}
+		debugger.Continue()
+	}
+	// Stopping the execution releases it
+	stopCh <- struct{}{}
+	assert.Nil(t, <-errCh)
+}
+
+func TestHooksPositionLine(t *testing.T) {
+	bytecode, compileError := compiler.CompileWithOptions("a = 1\n\nb = a + 1\n", compiler.Options{SourcePositions: true})
+	assert.Nil(t, compileError)
+	p := NewVM(nil, nil, nil)
+	var lines []int
+	p.SetHooks(&Hooks{
+		OnSymbolSet: func(event SymbolSetEvent) {
+			lines = append(lines, event.Position.Line)
+		},
+	})
+	_, errCh, _ := p.Execute(bytecode)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, []int{1, 3}, lines)
+}
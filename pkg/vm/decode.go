@@ -0,0 +1,366 @@
+package vm
+
+import (
+	"fmt"
+	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	/*
+		DecodeError reports a value that could not be decoded, Path locates it inside the decoded value
+		using the plasma names of the fields, for example servers[2].port. Err is the cause: ErrTypeMismatch for
+		values of the wrong type, strconv.ErrRange for integers that overflow and the error of time.ParseDuration
+		for invalid durations
+	*/
+	DecodeError struct {
+		Path    string
+		Message string
+		Err     error
+	}
+	decodedPointer struct {
+		value *Value
+		t     reflect.Type
+	}
+	decoder struct {
+		pointers map[decodedPointer]reflect.Value
+	}
+)
+
+var (
+	valueType    = reflect.TypeOf((*Value)(nil))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func (decodeError *DecodeError) Error() string {
+	if decodeError.Path == "" {
+		return decodeError.Message
+	}
+	return decodeError.Path + ": " + decodeError.Message
+}
+
+func (decodeError *DecodeError) Unwrap() error {
+	if decodeError.Err == nil {
+		return ErrTypeMismatch
+	}
+	return decodeError.Err
+}
+
+/*
+Decode stores the value in the Go value target points to. Structs are filled from objects and hashes using the
+field names resolved by their "plasma" or "json" tags, slices and arrays from arrays and tuples, maps from hashes
+and objects, time.Duration from integers (nanoseconds) or strings like "1m30s". Pointers are allocated when
+needed, none leaves the zero value and *Value targets receive the value untouched.
+The same object decoded twice into the same pointer type results in the same pointer, preserving cycles
+*/
+func Decode(value *Value, target any) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Pointer || targetValue.IsNil() {
+		return fmt.Errorf("decode target must be a non nil pointer, got %T", target)
+	}
+	return (&decoder{}).decode(value, targetValue.Elem(), "")
+}
+
+/*
+As decodes the value into a new T, see Decode
+*/
+func As[T any](value *Value) (T, error) {
+	var result T
+	err := Decode(value, &result)
+	return result, err
+}
+
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func mismatch(path, expected string, got *Value) error {
+	return &DecodeError{
+		Path:    path,
+		Message: fmt.Sprintf("expected %s, got %s", expected, got.TypeId()),
+	}
+}
+
+/*
+expectedName names the plasma type a Go type is decoded from
+*/
+func expectedName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return special_symbols.Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return special_symbols.Int
+	case reflect.Float32, reflect.Float64:
+		return special_symbols.Float
+	case reflect.String:
+		return special_symbols.String
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return special_symbols.Bytes
+		}
+		return special_symbols.Array
+	case reflect.Array:
+		return special_symbols.Array
+	case reflect.Map:
+		return special_symbols.Hash
+	case reflect.Struct:
+		return special_symbols.Value
+	case reflect.Pointer:
+		return expectedName(t.Elem())
+	}
+	return t.String()
+}
+
+/*
+ownSymbols returns a copy of the symbols defined in the object itself, ignoring its parents
+*/
+func ownSymbols(value *Value) map[string]*Value {
+	value.vtable.mutex.Lock()
+	defer value.vtable.mutex.Unlock()
+	symbols := make(map[string]*Value, len(value.vtable.values))
+	for name, symbol := range value.vtable.values {
+		symbols[name] = symbol
+	}
+	return symbols
+}
+
+/*
+stringKeys returns the entries of the hash indexed by their string keys, other keys are ignored
+*/
+func stringKeys(value *Value) map[string]*Value {
+	hash := value.GetHash()
+	hash.mutex.Lock()
+	defer hash.mutex.Unlock()
+	entries := make(map[string]*Value, len(hash.internalMap))
+	for _, keyValue := range hash.internalMap {
+		if keyValue.Key.TypeId() == StringId {
+			entries[keyValue.Key.String()] = keyValue.Value
+		}
+	}
+	return entries
+}
+
+func (d *decoder) decode(value *Value, target reflect.Value, path string) error {
+	t := target.Type()
+	if t == valueType {
+		target.Set(reflect.ValueOf(value))
+		return nil
+	}
+	typeId := value.TypeId()
+	if typeId == NoneId {
+		target.Set(reflect.Zero(t))
+		return nil
+	}
+	if value.proxy != nil {
+		switch {
+		case value.proxy.pointer.Type() == t:
+			target.Set(value.proxy.pointer)
+			return nil
+		case value.proxy.pointer.Type().Elem() == t:
+			target.Set(value.proxy.pointer.Elem())
+			return nil
+		case t.Kind() == reflect.Interface && value.proxy.pointer.Type().Implements(t):
+			target.Set(value.proxy.pointer)
+			return nil
+		}
+	}
+	if t == durationType {
+		return d.decodeDuration(value, target, path)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if typeId == BoolId {
+			target.SetBool(value.GetBool())
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if typeId == IntId {
+			i := value.GetInt64()
+			if target.OverflowInt(i) {
+				return &DecodeError{Path: path, Message: fmt.Sprintf("%d overflows %s", i, t), Err: strconv.ErrRange}
+			}
+			target.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if typeId == IntId {
+			i := value.GetInt64()
+			if i < 0 || target.OverflowUint(uint64(i)) {
+				return &DecodeError{Path: path, Message: fmt.Sprintf("%d overflows %s", i, t), Err: strconv.ErrRange}
+			}
+			target.SetUint(uint64(i))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch typeId {
+		case IntId:
+			target.SetFloat(float64(value.GetInt64()))
+			return nil
+		case FloatId:
+			target.SetFloat(value.GetFloat64())
+			return nil
+		}
+	case reflect.String:
+		if typeId == StringId {
+			target.SetString(value.String())
+			return nil
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && (typeId == BytesId || typeId == StringId) {
+			target.SetBytes(append([]byte(nil), value.GetBytes()...))
+			return nil
+		}
+		if typeId == ArrayId || typeId == TupleId {
+			values := value.GetValues()
+			slice := reflect.MakeSlice(t, len(values), len(values))
+			for index, element := range values {
+				elementError := d.decode(element, slice.Index(index), fmt.Sprintf("%s[%d]", path, index))
+				if elementError != nil {
+					return elementError
+				}
+			}
+			target.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if typeId == ArrayId || typeId == TupleId {
+			values := value.GetValues()
+			if len(values) != t.Len() {
+				return &DecodeError{Path: path, Message: fmt.Sprintf("expected %d elements, got %d", t.Len(), len(values))}
+			}
+			for index, element := range values {
+				elementError := d.decode(element, target.Index(index), fmt.Sprintf("%s[%d]", path, index))
+				if elementError != nil {
+					return elementError
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		return d.decodeMap(value, target, path)
+	case reflect.Struct:
+		var symbols map[string]*Value
+		switch typeId {
+		case ValueId:
+			symbols = ownSymbols(value)
+		case HashId:
+			symbols = stringKeys(value)
+		default:
+			return mismatch(path, expectedName(t), value)
+		}
+		for name, index := range decodeFields(t) {
+			symbol, found := symbols[name]
+			if !found {
+				continue
+			}
+			fieldError := d.decode(symbol, target.Field(index), fieldPath(path, name))
+			if fieldError != nil {
+				return fieldError
+			}
+		}
+		return nil
+	case reflect.Pointer:
+		key := decodedPointer{value: value, t: t}
+		if pointer, found := d.pointers[key]; found {
+			target.Set(pointer)
+			return nil
+		}
+		pointer := reflect.New(t.Elem())
+		if d.pointers == nil {
+			d.pointers = map[decodedPointer]reflect.Value{}
+		}
+		d.pointers[key] = pointer
+		elemError := d.decode(value, pointer.Elem(), path)
+		if elemError != nil {
+			return elemError
+		}
+		target.Set(pointer)
+		return nil
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			break
+		}
+		goValue, err := fromValue(value)
+		if err != nil {
+			return &DecodeError{Path: path, Message: err.Error(), Err: err}
+		}
+		if goValue != nil {
+			target.Set(reflect.ValueOf(goValue))
+		}
+		return nil
+	}
+	return mismatch(path, expectedName(t), value)
+}
+
+func (d *decoder) decodeMap(value *Value, target reflect.Value, path string) error {
+	t := target.Type()
+	result := reflect.MakeMap(t)
+	switch value.TypeId() {
+	case ValueId:
+		if t.Key().Kind() != reflect.String {
+			return mismatch(path, expectedName(t), value)
+		}
+		for name, symbol := range ownSymbols(value) {
+			element := reflect.New(t.Elem()).Elem()
+			elementError := d.decode(symbol, element, fieldPath(path, name))
+			if elementError != nil {
+				return elementError
+			}
+			result.SetMapIndex(reflect.ValueOf(name).Convert(t.Key()), element)
+		}
+	case HashId:
+		hash := value.GetHash()
+		hash.mutex.Lock()
+		entries := make([]HashKeyValue, 0, len(hash.internalMap))
+		for _, keyValue := range hash.internalMap {
+			entries = append(entries, keyValue)
+		}
+		hash.mutex.Unlock()
+		for _, keyValue := range entries {
+			var keyPath string
+			if keyValue.Key.TypeId() == StringId {
+				keyPath = fmt.Sprintf("%s[%q]", path, keyValue.Key.String())
+			} else {
+				keyPath = fmt.Sprintf("%s[%s]", path, keyValue.Key.String())
+			}
+			key := reflect.New(t.Key()).Elem()
+			keyError := d.decode(keyValue.Key, key, keyPath)
+			if keyError != nil {
+				return keyError
+			}
+			element := reflect.New(t.Elem()).Elem()
+			elementError := d.decode(keyValue.Value, element, keyPath)
+			if elementError != nil {
+				return elementError
+			}
+			result.SetMapIndex(key, element)
+		}
+	default:
+		return mismatch(path, expectedName(t), value)
+	}
+	target.Set(result)
+	return nil
+}
+
+func (d *decoder) decodeDuration(value *Value, target reflect.Value, path string) error {
+	switch value.TypeId() {
+	case IntId:
+		target.SetInt(value.GetInt64())
+		return nil
+	case StringId:
+		duration, parseError := time.ParseDuration(value.String())
+		if parseError != nil {
+			return &DecodeError{Path: path, Message: strings.TrimPrefix(parseError.Error(), "time: "), Err: parseError}
+		}
+		target.SetInt(int64(duration))
+		return nil
+	}
+	return mismatch(path, "Int or String", value)
+}
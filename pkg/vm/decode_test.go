@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type (
+	decodeServer struct {
+		Host    string `json:"host"`
+		Port    uint16 `plasma:"port" json:"-"`
+		Weights []float64
+	}
+	decodeConfig struct {
+		Name     string                   `plasma:"name"`
+		Timeout  time.Duration            `plasma:"timeout"`
+		Retry    *time.Duration           `plasma:"retry"`
+		Servers  []decodeServer           `plasma:"servers"`
+		Primary  *decodeServer            `plasma:"primary"`
+		Limits   map[string]int           `plasma:"limits"`
+		Ids      map[int]bool             `plasma:"ids"`
+		Extra    any                      `plasma:"extra"`
+		Raw      *Value                   `plasma:"raw"`
+		Pair     [2]string                `plasma:"pair"`
+		Data     []byte                   `plasma:"data"`
+		Lookup   map[string]*decodeServer `plasma:"lookup"`
+		Ignored  string                   `plasma:"-"`
+		Optional *string                  `plasma:"optional"`
+	}
+)
+
+func execute(t *testing.T, p *Plasma, script string) *Value {
+	rCh, errCh, _ := p.ExecuteString(script)
+	assert.Nil(t, <-errCh)
+	return <-rCh
+}
+
+func TestDecode(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	value := execute(t, p, `
+config = Value()
+config.name = "production"
+config.timeout = "1m30s"
+config.retry = 500
+first = Value()
+first.host = "a.example.com"
+first.port = 80
+first.Weights = [1, 0.5]
+config.servers = [first, {"host": "b.example.com", "port": 443}]
+config.primary = first
+config.limits = {"cpu": 2, "memory": 1024}
+config.ids = {1: true, 2: false}
+config.extra = {"nested": [1, "two"]}
+config.raw = "kept"
+config.pair = ("left", "right")
+config.data = "bytes"
+config.lookup = {"first": first}
+config.Ignored = "nope"
+config.optional = none
+config
+`)
+	var config decodeConfig
+	assert.Nil(t, Decode(value, &config))
+	retry := 500 * time.Nanosecond
+	assert.Equal(t, "production", config.Name)
+	assert.Equal(t, 90*time.Second, config.Timeout)
+	assert.Equal(t, &retry, config.Retry)
+	assert.Equal(t, []decodeServer{
+		{Host: "a.example.com", Port: 80, Weights: []float64{1, 0.5}},
+		{Host: "b.example.com", Port: 443},
+	}, config.Servers)
+	assert.Equal(t, config.Servers[0], *config.Primary)
+	assert.Equal(t, map[string]int{"cpu": 2, "memory": 1024}, config.Limits)
+	assert.Equal(t, map[int]bool{1: true, 2: false}, config.Ids)
+	assert.Equal(t, map[any]any{"nested": []any{int64(1), "two"}}, config.Extra)
+	assert.Equal(t, "kept", config.Raw.String())
+	assert.Equal(t, [2]string{"left", "right"}, config.Pair)
+	assert.Equal(t, []byte("bytes"), config.Data)
+	// The same object decoded into the same pointer type is the same pointer
+	assert.Same(t, config.Primary, config.Lookup["first"])
+	assert.Equal(t, "", config.Ignored)
+	assert.Nil(t, config.Optional)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	for _, test := range []struct {
+		script   string
+		expected string
+		cause    error
+	}{
+		{"{'servers': [{}, {}, {'port': '80'}]}", "servers[2].port: expected Int, got String", ErrTypeMismatch},
+		{"{'servers': [{}, {'port': 65536}]}", "servers[1].port: 65536 overflows uint16", strconv.ErrRange},
+		{"{'servers': [{'Weights': ['heavy']}]}", "servers[0].Weights[0]: expected Float, got String", ErrTypeMismatch},
+		{"{'timeout': 'soon'}", "timeout: invalid duration \"soon\"", nil},
+		{"{'timeout': 1.5}", "timeout: expected Int or String, got Float", ErrTypeMismatch},
+		{"{'limits': {'cpu': 'all'}}", "limits[\"cpu\"]: expected Int, got String", ErrTypeMismatch},
+		{"{'ids': {'one': true}}", "ids[\"one\"]: expected Int, got String", ErrTypeMismatch},
+		{"{'pair': ('one',)}", "pair: expected 2 elements, got 1", ErrTypeMismatch},
+		{"{'primary': 1}", "primary: expected Value, got Int", ErrTypeMismatch},
+		{"[]", "expected Value, got Array", ErrTypeMismatch},
+	} {
+		var config decodeConfig
+		err := Decode(execute(t, p, test.script), &config)
+		assert.NotNil(t, err, test.script)
+		if err == nil {
+			continue
+		}
+		assert.Equal(t, test.expected, err.Error(), test.script)
+		if test.cause != nil {
+			assert.ErrorIs(t, err, test.cause, test.script)
+		} else {
+			// Errors of time.ParseDuration are not comparable, they are wrapped untouched
+			assert.Equal(t, "time: invalid duration \"soon\"", errors.Unwrap(err).Error(), test.script)
+		}
+		var decodeError *DecodeError
+		assert.True(t, errors.As(err, &decodeError), test.script)
+	}
+	var config decodeConfig
+	assert.NotNil(t, Decode(p.None(), config))
+	assert.NotNil(t, Decode(p.None(), nil))
+}
+
+func TestAs(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	numbers, err := As[[]int](execute(t, p, "[1, 2, 3]"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3}, numbers)
+	names, err := As[map[string][]string](execute(t, p, "{'a': ['x'], 'b': ('y', 'z')}"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"a": {"x"}, "b": {"y", "z"}}, names)
+	zero, err := As[int](p.None())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, zero)
+	_, err = As[string](execute(t, p, "1"))
+	assert.Equal(t, "expected String, got Int", err.Error())
+	// Cycles are preserved
+	type node struct {
+		Name string
+		Next *node
+	}
+	first, err := As[*node](execute(t, p, "a = Value()\na.Name = 'a'\nb = Value()\nb.Name = 'b'\na.Next = b\nb.Next = a\na"))
+	assert.Nil(t, err)
+	assert.Equal(t, "b", first.Next.Name)
+	assert.Same(t, first, first.Next.Next)
+}
@@ -8,12 +8,27 @@ import (
 	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
 )
 
-func (ctx *context) pushCode(bytecode []byte) {
+/*
+pushCode runs the bytecode on top of the current code, it belongs to the same function and line unless the caller renames it
+*/
+func (ctx *context) pushCode(bytecode []byte, caches *inlineCaches) {
+	ctx.checkCallDepth()
+	var (
+		function string
+		line     int
+	)
+	if ctx.code.HasNext() {
+		function = ctx.code.Peek().function
+		line = ctx.code.Peek().line
+	}
 	ctx.code.Push(
 		&contextCode{
 			bytecode: bytecode,
 			rip:      0,
 			onExit:   &common.ListStack[[]byte]{},
+			caches:   caches,
+			function: function,
+			line:     line,
 		},
 	)
 }
@@ -22,22 +37,26 @@ func (ctx *context) popCode() {
 	if ctxCode := ctx.code.Peek(); ctxCode.onExit.HasNext() {
 		ctxCode.rip = int64(len(ctxCode.bytecode)) + 1
 		if ctx.register != nil {
+			ctx.checkStackSize(1)
 			ctx.stack.Push(ctx.register)
-			ctx.pushCode([]byte{opcodes.Return})
+			ctx.pushCode([]byte{opcodes.Return}, nil)
 			ctx.currentSymbols = NewSymbols(ctx.currentSymbols)
 		}
 		for ctxCode.onExit.HasNext() {
-			ctx.pushCode(ctxCode.onExit.Pop())
+			ctx.pushCode(ctxCode.onExit.Pop(), nil)
 			ctx.currentSymbols = NewSymbols(ctx.currentSymbols)
 		}
 		return
 	}
-	ctx.code.Pop()
+	popped := ctx.code.Pop()
 	if ctx.currentSymbols.call != nil {
 		ctx.currentSymbols = ctx.currentSymbols.call
 	} else {
 		ctx.currentSymbols = ctx.currentSymbols.Parent
 	}
+	if popped.call && ctx.hooks != nil {
+		ctx.hooks.ret(ctx, popped.function)
+	}
 }
 
 func (plasma *Plasma) prepareClassInitCode(classInfo *ClassInfo) {
@@ -57,14 +76,135 @@ func (plasma *Plasma) prepareClassInitCode(classInfo *ClassInfo) {
 	classInfo.Bytecode = result
 }
 
+/*
+call invokes the function with the arguments, builtins write their result to the register immediately
+while functions and classes push their code to the context
+*/
+func (plasma *Plasma) call(ctx *context, function *Value, arguments []*Value) {
+	var callError error
+	tries := 0
+doCall:
+	if tries == MaxDoCallSearch {
+		panic("infinite nested __call__")
+	}
+	if ctx.hooks != nil {
+		ctx.hooks.call(ctx, function, arguments)
+	}
+	switch function.TypeId() {
+	case BuiltInFunctionId, BuiltInClassId:
+		ctx.allocate()
+		ctx.register, callError = function.GetContextCallback()(withLimits(ctx.goContext, ctx.limits), arguments...)
+		if ctx.suspend != nil {
+			pending, isPending := callError.(*Pending)
+			if isPending || callError == ErrSuspended {
+				// The result of the built-in is provided by Execution.Resume
+				ctx.register = plasma.none
+				ctx.suspended = true
+				ctx.pending = pending
+				break
+			}
+		}
+		if callError != nil {
+			panic(callError)
+		}
+	case FunctionId:
+		funcInfo := function.GetFuncInfo()
+		// Push new symbol table based on the function
+		newSymbols := NewSymbols(function.vtable)
+		newSymbols.call = ctx.currentSymbols
+		ctx.currentSymbols = newSymbols
+		if len(funcInfo.Arguments) != len(arguments) {
+			panic("invalid number of argument for function call")
+		}
+		// Load arguments
+		for index, argument := range funcInfo.Arguments {
+			ctx.currentSymbols.Set(argument, arguments[index])
+		}
+		// Push code
+		ctx.pushCode(funcInfo.Bytecode, funcInfo.caches)
+		ctx.code.Peek().function = funcInfo.Name
+		ctx.code.Peek().call = true
+	case ClassId:
+		classInfo := function.GetClassInfo()
+		if !classInfo.prepared {
+			plasma.prepareClassInitCode(classInfo)
+		}
+		// Instantiate object
+		ctx.allocate()
+		object := plasma.NewValue(function.vtable, ValueId, plasma.value)
+		object.class = function
+		object.Set(special_symbols.Self, object)
+		// Push object
+		ctx.checkStackSize(1 + len(arguments))
+		ctx.stack.Push(object)
+		for _, argument := range arguments {
+			ctx.stack.Push(argument)
+		}
+		// Push class code
+		classCode := make([]byte, 0, len(classInfo.Bytecode))
+		classCode = append(classCode, classInfo.Bytecode...)
+		// inject init code: object.__init__(arguments...)
+		classCode = append(classCode, opcodes.Identifier)
+		classCode = append(classCode, common.IntToBytes(len(magic_functions.Init))...)
+		classCode = append(classCode, magic_functions.Init...)
+		classCode = append(classCode, opcodes.Push)
+		classCode = append(classCode, opcodes.Call)
+		classCode = append(classCode, common.IntToBytes(len(arguments))...)
+		// Inject pop object to register
+		classCode = append(classCode, opcodes.Pop)
+		// Load code
+		ctx.pushCode(classCode, classInfo.caches)
+		ctx.code.Peek().function = ""
+		ctx.code.Peek().call = true
+		newSymbols := object.vtable
+		newSymbols.call = ctx.currentSymbols
+		ctx.currentSymbols = newSymbols
+	default: // __call__
+		call, getError := function.Get(magic_functions.Call)
+		if getError != nil {
+			panic(getError)
+		}
+		function = call
+		tries++
+		goto doCall
+	}
+}
+
+/*
+writable returns the value whose attributes the instruction at the offset modifies. Shared values are replaced
+by a private copy, which is bound to the symbol the value was loaded from by the instruction before the Push
+preceding this one. Other frozen values, and shared values not loaded from a symbol, can not be modified
+*/
+func (plasma *Plasma) writable(ctx *context, instructionRip int64, selector *Value) *Value {
+	if !selector.frozen {
+		return selector
+	}
+	if !selector.shared {
+		panic(ErrImmutableValue)
+	}
+	loaded := ctx.loaded
+	if loaded.code != ctx.code.Peek() || loaded.next+1 != instructionRip {
+		// Temporary values, like results of calls, are not bound to any symbol the copy could replace
+		panic(ErrImmutableValue)
+	}
+	if loaded.receiver == nil {
+		return ctx.currentSymbols.replace(loaded.name, selector, plasma.copyPrimitive)
+	}
+	if loaded.receiver.frozen {
+		panic(ErrImmutableValue)
+	}
+	copied := plasma.copyPrimitive(selector)
+	loaded.receiver.Set(loaded.name, copied)
+	return copied
+}
+
 func (plasma *Plasma) do(ctx *context) {
 	ctxCode := ctx.code.Peek()
 	instruction := ctxCode.bytecode[ctxCode.rip]
-	// fmt.Println(opcodes.OpCodes[instruction])
-	// plasma.printStack(ctx)
 	switch instruction {
 	case opcodes.Push:
 		ctxCode.rip++
+		ctx.checkStackSize(1)
 		ctx.stack.Push(ctx.register)
 	case opcodes.Pop:
 		ctxCode.rip++
@@ -74,19 +214,36 @@ func (plasma *Plasma) do(ctx *context) {
 		symbolLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		symbol := string(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+symbolLength])
-		// fmt.Println(symbol)
 		ctxCode.rip += symbolLength
-		ctx.currentSymbols.Set(symbol, ctx.stack.Pop())
+		value := ctx.stack.Pop()
+		if ctx.hooks != nil {
+			ctx.hooks.symbolSet(ctx, nil, symbol, value)
+		}
+		ctx.currentSymbols.Set(symbol, value)
 	case opcodes.SelectorAssign:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		symbolLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		symbol := string(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+symbolLength])
 		ctxCode.rip += symbolLength
-		selector := ctx.stack.Pop()
-		selector.Set(symbol, ctx.stack.Pop())
+		selector := plasma.writable(ctx, instructionRip, ctx.stack.Pop())
+		value := ctx.stack.Pop()
+		if ctx.hooks != nil {
+			ctx.hooks.symbolSet(ctx, selector, symbol, value)
+		}
+		assignError := selector.assign(symbol, value)
+		if assignError != nil {
+			panic(assignError)
+		}
 	case opcodes.Label:
 		ctxCode.rip += 9 // OP + Label
+	case opcodes.Line:
+		ctxCode.line = int(common.BytesToInt(ctxCode.bytecode[1+ctxCode.rip : 9+ctxCode.rip]))
+		ctxCode.rip += 9
+		if ctx.debugger != nil {
+			ctx.debugger.line(ctx, ctxCode.line)
+		}
 	case opcodes.Jump:
 		ctxCode.rip += common.BytesToInt(ctxCode.bytecode[1+ctxCode.rip : 9+ctxCode.rip])
 	case opcodes.IfJump:
@@ -110,12 +267,13 @@ func (plasma *Plasma) do(ctx *context) {
 			panic(delError)
 		}
 	case opcodes.DeleteSelector:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		symbolLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		symbol := string(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+symbolLength])
 		ctxCode.rip += symbolLength
-		selector := ctx.stack.Pop()
+		selector := plasma.writable(ctx, instructionRip, ctx.stack.Pop())
 		delError := selector.Del(symbol)
 		if delError != nil {
 			panic(delError)
@@ -129,6 +287,10 @@ func (plasma *Plasma) do(ctx *context) {
 		ctxCode.onExit.Push(onExitCode)
 	case opcodes.NewFunction:
 		ctxCode.rip++
+		nameLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
+		ctxCode.rip += 8
+		name := string(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+nameLength])
+		ctxCode.rip += nameLength
 		numberOfArgument := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		arguments := make([]string, 0, numberOfArgument)
@@ -144,11 +306,14 @@ func (plasma *Plasma) do(ctx *context) {
 		bytecode := ctxCode.bytecode[ctxCode.rip : ctxCode.rip+bytecodeLength]
 		ctxCode.rip += bytecodeLength
 		funcInfo := FuncInfo{
+			Name:      name,
 			Arguments: arguments,
 			Bytecode:  bytecode,
+			caches:    newInlineCaches(),
 		}
 		funcObject := plasma.NewValue(ctx.currentSymbols, FunctionId, plasma.function)
 		funcObject.SetAny(funcInfo)
+		ctx.allocate()
 		ctx.register = funcObject
 	case opcodes.NewClass:
 		ctxCode.rip++
@@ -166,9 +331,11 @@ func (plasma *Plasma) do(ctx *context) {
 		classInfo := &ClassInfo{
 			Bases:    bases,
 			Bytecode: body,
+			caches:   newInlineCaches(),
 		}
 		classObject := plasma.NewValue(ctx.currentSymbols, ClassId, plasma.class)
 		classObject.SetAny(classInfo)
+		ctx.allocate()
 		ctx.register = classObject
 	case opcodes.Call:
 		ctxCode.rip++
@@ -179,73 +346,7 @@ func (plasma *Plasma) do(ctx *context) {
 		for i := numberOfArguments - 1; i >= 0; i-- {
 			arguments[i] = ctx.stack.Pop()
 		}
-		var callError error
-		tries := 0
-	doCall:
-		if tries == MaxDoCallSearch {
-			panic("infinite nested __call__")
-		}
-		switch function.TypeId() {
-		case BuiltInFunctionId, BuiltInClassId:
-			ctx.register, callError = function.Call(arguments...)
-			if callError != nil {
-				panic(callError)
-			}
-		case FunctionId:
-			funcInfo := function.GetFuncInfo()
-			// Push new symbol table based on the function
-			newSymbols := NewSymbols(function.vtable)
-			newSymbols.call = ctx.currentSymbols
-			ctx.currentSymbols = newSymbols
-			if int64(len(funcInfo.Arguments)) != numberOfArguments {
-				panic("invalid number of argument for function call")
-			}
-			// Load arguments
-			for index, argument := range funcInfo.Arguments {
-				ctx.currentSymbols.Set(argument, arguments[index])
-			}
-			// Push code
-			ctx.pushCode(funcInfo.Bytecode)
-		case ClassId:
-			classInfo := function.GetClassInfo()
-			if !classInfo.prepared {
-				plasma.prepareClassInitCode(classInfo)
-			}
-			// Instantiate object
-			object := plasma.NewValue(function.vtable, ValueId, plasma.value)
-			object.class = function
-			object.Set(special_symbols.Self, object)
-			// Push object
-			ctx.stack.Push(object)
-			for _, argument := range arguments {
-				ctx.stack.Push(argument)
-			}
-			// Push class code
-			classCode := make([]byte, 0, len(classInfo.Bytecode))
-			classCode = append(classCode, classInfo.Bytecode...)
-			// inject init code: object.__init__(arguments...)
-			classCode = append(classCode, opcodes.Identifier)
-			classCode = append(classCode, common.IntToBytes(len(magic_functions.Init))...)
-			classCode = append(classCode, magic_functions.Init...)
-			classCode = append(classCode, opcodes.Push)
-			classCode = append(classCode, opcodes.Call)
-			classCode = append(classCode, common.IntToBytes(numberOfArguments)...)
-			// Inject pop object to register
-			classCode = append(classCode, opcodes.Pop)
-			// Load code
-			ctx.pushCode(classCode)
-			newSymbols := object.vtable
-			newSymbols.call = ctx.currentSymbols
-			ctx.currentSymbols = newSymbols
-		default: // __call__
-			call, getError := function.Get(magic_functions.Call)
-			if getError != nil {
-				panic(getError)
-			}
-			function = call
-			tries++
-			goto doCall
-		}
+		plasma.call(ctx, function, arguments)
 	case opcodes.NewArray:
 		ctxCode.rip++
 		numberOfValues := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
@@ -254,6 +355,7 @@ func (plasma *Plasma) do(ctx *context) {
 		for i := numberOfValues - 1; i >= 0; i-- {
 			values[i] = ctx.stack.Pop()
 		}
+		ctx.allocate()
 		ctx.register = plasma.NewArray(values)
 	case opcodes.NewTuple:
 		ctxCode.rip++
@@ -263,6 +365,7 @@ func (plasma *Plasma) do(ctx *context) {
 		for i := numberOfValues - 1; i >= 0; i-- {
 			values[i] = ctx.stack.Pop()
 		}
+		ctx.allocate()
 		ctx.register = plasma.NewTuple(values)
 	case opcodes.NewHash:
 		ctxCode.rip++
@@ -277,6 +380,7 @@ func (plasma *Plasma) do(ctx *context) {
 				panic(setError)
 			}
 		}
+		ctx.allocate()
 		ctx.register = plasma.NewHash(hash)
 	case opcodes.Identifier:
 		ctxCode.rip++
@@ -290,30 +394,43 @@ func (plasma *Plasma) do(ctx *context) {
 		if getError != nil {
 			panic(getError)
 		}
+		ctx.loaded = loadedSymbol{code: ctxCode, next: ctxCode.rip, name: symbol}
 	case opcodes.Integer:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		value := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
-		ctx.register = plasma.NewInt(value)
+		ctx.register = ctxCode.caches.constant(instructionRip, func() *Value {
+			return plasma.NewInt(value)
+		})
 	case opcodes.Float:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		value := common.BytesToFloat(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
-		ctx.register = plasma.NewFloat(value)
+		ctx.register = ctxCode.caches.constant(instructionRip, func() *Value {
+			return plasma.NewFloat(value)
+		})
 	case opcodes.String:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		stringLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		contents := ctxCode.bytecode[ctxCode.rip : ctxCode.rip+stringLength]
 		ctxCode.rip += stringLength
-		ctx.register = plasma.NewString(contents)
+		ctx.register = ctxCode.caches.constant(instructionRip, func() *Value {
+			return plasma.NewString(contents)
+		})
 	case opcodes.Bytes:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		stringLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
 		contents := ctxCode.bytecode[ctxCode.rip : ctxCode.rip+stringLength]
 		ctxCode.rip += stringLength
-		ctx.register = plasma.NewBytes(contents)
+		ctx.register = ctxCode.caches.constant(instructionRip, func() *Value {
+			return plasma.NewBytes(contents)
+		})
 	case opcodes.True:
 		ctxCode.rip++
 		ctx.register = plasma.true
@@ -324,6 +441,7 @@ func (plasma *Plasma) do(ctx *context) {
 		ctxCode.rip++
 		ctx.register = plasma.none
 	case opcodes.Selector:
+		instructionRip := ctxCode.rip
 		ctxCode.rip++
 		symbolLength := common.BytesToInt(ctxCode.bytecode[ctxCode.rip : ctxCode.rip+8])
 		ctxCode.rip += 8
@@ -332,10 +450,32 @@ func (plasma *Plasma) do(ctx *context) {
 		// fmt.Println(symbol)
 		selector := ctx.stack.Pop()
 		var getError error
-		ctx.register, getError = selector.Get(symbol)
+		ctx.register, getError = ctxCode.caches.selector(instructionRip, selector, symbol)
+		if getError != nil {
+			panic(getError)
+		}
+		ctx.loaded = loadedSymbol{code: ctxCode, next: ctxCode.rip, receiver: selector, name: symbol}
+	case opcodes.Add, opcodes.Sub, opcodes.Mul, opcodes.Div, opcodes.FloorDiv, opcodes.Modulus, opcodes.PowerOf,
+		opcodes.BitwiseOr, opcodes.BitwiseXor, opcodes.BitwiseAnd, opcodes.BitwiseLeft, opcodes.BitwiseRight,
+		opcodes.Equal, opcodes.NotEqual, opcodes.GreaterThan, opcodes.GreaterOrEqualThan, opcodes.LessThan,
+		opcodes.LessOrEqualThan:
+		instructionRip := ctxCode.rip
+		ctxCode.rip++
+		left := ctx.stack.Pop()
+		right := ctx.stack.Pop()
+		if ctx.limits != nil {
+			ctx.limits.checkBinary(instruction, left, right)
+		}
+		if result, ok := plasma.fastBinary(instruction, left, right); ok {
+			ctx.allocate()
+			ctx.register = result
+			break
+		}
+		method, getError := ctxCode.caches.selector(instructionRip, left, opcodes.BinaryOperations[instruction])
 		if getError != nil {
 			panic(getError)
 		}
+		plasma.call(ctx, method, []*Value{right})
 	case opcodes.Super:
 		break // TODO: Implement me!
 	default:
@@ -3,7 +3,39 @@ package vm
 import "fmt"
 
 var (
-	NotOperable   = fmt.Errorf("not operable")
-	NotIndexable  = fmt.Errorf("not indexable")
-	NotComparable = fmt.Errorf("not comparable")
+	NotOperable        = fmt.Errorf("not operable")
+	NotIndexable       = fmt.Errorf("not indexable")
+	NotComparable      = fmt.Errorf("not comparable")
+	ErrInvalidBytecode = fmt.Errorf("invalid bytecode")
+	// ErrBytecodeVersion is returned for bytecode without the format header or compiled for another format version
+	ErrBytecodeVersion = fmt.Errorf("%w: unsupported format version", ErrInvalidBytecode)
+	ErrImmutableValue  = fmt.Errorf("immutable value")
+	ErrCancelled       = fmt.Errorf("execution cancelled")
+	// ErrStopped is returned by the executions and callbacks of a VM after Stop
+	ErrStopped      = fmt.Errorf("vm stopped")
+	ErrRestricted   = fmt.Errorf("not available in restricted VM")
+	ErrFieldType    = fmt.Errorf("invalid Go field type")
+	ErrTypeMismatch = fmt.Errorf("type mismatch")
+	// ErrNotImplemented is returned by Implement when a script object can not be used as a Go interface
+	ErrNotImplemented = fmt.Errorf("interface not implemented")
+	// ErrLimitExceeded is wrapped by the errors of every limit in Limits
+	ErrLimitExceeded    = fmt.Errorf("limit exceeded")
+	ErrInstructionLimit = fmt.Errorf("%w: instructions", ErrLimitExceeded)
+	ErrCallDepthLimit   = fmt.Errorf("%w: call depth", ErrLimitExceeded)
+	ErrStackSizeLimit   = fmt.Errorf("%w: stack size", ErrLimitExceeded)
+	ErrValuesLimit      = fmt.Errorf("%w: values", ErrLimitExceeded)
+	ErrStringSizeLimit  = fmt.Errorf("%w: string size", ErrLimitExceeded)
+	ErrArraySizeLimit   = fmt.Errorf("%w: array size", ErrLimitExceeded)
+	// ErrNotSerializable is returned by SaveGlobals for values it can not write
+	ErrNotSerializable = fmt.Errorf("not serializable")
+	// ErrInvalidState is returned by LoadGlobals and LoadExecution for malformed input
+	ErrInvalidState = fmt.Errorf("invalid state")
+	// ErrSuspended is returned by executions paused by Execution.Suspend or by a built-in returning it
+	ErrSuspended = fmt.Errorf("execution suspended")
+	// ErrExecutionRunning is returned by the methods of an Execution that is running in another goroutine
+	ErrExecutionRunning = fmt.Errorf("execution running")
+	// ErrConfigPath is returned by the require of LoadConfig for scripts outside the directory of the config
+	ErrConfigPath = fmt.Errorf("path outside the config directory")
+	// ErrSchedulerClosed is returned by Scheduler.Submit after Close
+	ErrSchedulerClosed = fmt.Errorf("scheduler closed")
 )
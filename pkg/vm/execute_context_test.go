@@ -0,0 +1,83 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func compile(t *testing.T, script string) []byte {
+	bytecode, compileError := compiler.Compile(script)
+	assert.Nil(t, compileError)
+	return bytecode
+}
+
+func TestPlasma_ExecuteContext(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	result, err := p.ExecuteContext(gocontext.Background(), compile(t, "1 + 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), result.GetInt64())
+	_, err = p.ExecuteContext(gocontext.Background(), compile(t, "undefined_symbol"))
+	assert.NotNil(t, err)
+}
+
+func TestPlasma_ExecuteContextDeadline(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.ExecuteContext(ctx, compile(t, "while true\n\ta = 1\nend"))
+	assert.True(t, errors.Is(err, gocontext.DeadlineExceeded))
+}
+
+func TestPlasma_ExecuteContextCancel(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := p.ExecuteContext(ctx, compile(t, "while true\n\ta = 1\nend"))
+	assert.True(t, errors.Is(err, ErrCancelled))
+	// Already cancelled contexts do not execute anything
+	_, err = p.ExecuteContext(ctx, compile(t, "a = 2"))
+	assert.True(t, errors.Is(err, ErrCancelled))
+	a, _ := p.RootSymbols().Get("a")
+	assert.Equal(t, int64(1), a.GetInt64())
+}
+
+func TestPlasma_ExecuteContextBlockedInput(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	p := NewVM(stdin, io.Discard, io.Discard)
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := p.ExecuteContext(ctx, compile(t, "input('> ')"))
+	assert.True(t, errors.Is(err, ErrCancelled))
+}
+
+func TestPlasma_ExecuteContextBlockedChannel(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("channel", make(chan int)))
+	for _, script := range []string{"channel.recv()", "channel.send(1)"} {
+		ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+		_, err := p.ExecuteContext(ctx, compile(t, script))
+		cancel()
+		assert.True(t, errors.Is(err, gocontext.DeadlineExceeded), script)
+	}
+	buffered := make(chan int, 1)
+	assert.Nil(t, p.LoadGo("buffered", buffered))
+	_, err := p.ExecuteContext(gocontext.Background(), compile(t, "buffered.send(5)"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, <-buffered)
+}
+
+func TestPlasma_CallValueContext(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, "def forever()\n\twhile true\n\t\ta = 1\n\tend\nend")
+	forever, _ := p.RootSymbols().Get("forever")
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.CallValueContext(ctx, forever)
+	assert.True(t, errors.Is(err, gocontext.DeadlineExceeded))
+}
@@ -0,0 +1,349 @@
+package vm
+
+import (
+	gocontext "context"
+	"encoding/gob"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/common"
+	"io"
+	"sync"
+)
+
+type (
+	/*
+		Execution is an execution that can be paused at an instruction boundary and resumed later from the same
+		instruction, code frames, operand stack and symbols. It is paused by Suspend or by a built-in returning
+		ErrSuspended, in the latter case the value passed to Resume becomes the result of the built-in
+	*/
+	Execution struct {
+		plasma   *Plasma
+		streams  *executionStreams
+		mutex    sync.Mutex
+		ctx      *context
+		suspend  chan struct{}
+		running  bool
+		paused   bool
+		awaiting bool
+		pending  *Pending
+		finished bool
+		result   *Value
+		err      error
+	}
+	/*
+		savedExecution is the encoded form of a suspended execution, values and symbols reference the state
+		like the globals do
+	*/
+	savedExecution struct {
+		State        savedState
+		Codes        []savedCode // Bottom frame first
+		Stack        []int       // Bottom value first
+		Register     int
+		Symbols      int
+		Awaiting     bool
+		Limits       Limits
+		Instructions int64
+		Values       int64
+	}
+	savedCode struct {
+		Bytecode []byte
+		Rip      int64
+		OnExit   [][]byte // Bottom block first
+		Function string
+		Call     bool
+		Line     int
+	}
+)
+
+/*
+NewExecution prepares the execution of the bytecode with the options, it does not start until Run is called.
+The streams of the options are used every time it runs, they are not saved by Save
+*/
+func (plasma *Plasma) NewExecution(bytecode []byte, options ExecuteOptions) *Execution {
+	ctx := plasma.newContext(bytecode)
+	if options.Verify && ctx.bytecodeError == nil {
+		ctx.bytecodeError = Verify(bytecode)
+	}
+	if options.Limits != (Limits{}) {
+		ctx.limits = newExecutionLimits(options.Limits)
+	}
+	if options.Scope != nil {
+		ctx.currentSymbols = options.Scope
+	}
+	execution := plasma.newExecution(ctx)
+	execution.streams = newExecutionStreams(nil, options)
+	return execution
+}
+
+func (plasma *Plasma) newExecution(ctx *context) *Execution {
+	execution := &Execution{
+		plasma:  plasma,
+		ctx:     ctx,
+		suspend: make(chan struct{}, 1),
+	}
+	ctx.suspend = execution.suspend
+	return execution
+}
+
+/*
+Run executes the code until it finishes or is suspended, suspended executions return ErrSuspended and continue
+from the instruction they stopped at on the next call to Run or Resume. Cancellation, Plasma.Stop and errors
+finish the execution, once finished Run returns its result again without executing anything
+*/
+func (execution *Execution) Run(goContext gocontext.Context) (*Value, error) {
+	return execution.Resume(goContext, nil)
+}
+
+/*
+Resume is Run setting the result of the built-in that suspended the execution by returning ErrSuspended or a
+Pending, nil results are None. The result is ignored when the execution was suspended by Suspend
+*/
+func (execution *Execution) Resume(goContext gocontext.Context, result *Value) (*Value, error) {
+	return execution.resume(goContext, result, nil)
+}
+
+/*
+resume is Resume, a non nil resumeError is the error of the built-in the execution is awaiting and finishes it
+*/
+func (execution *Execution) resume(goContext gocontext.Context, result *Value, resumeError error) (*Value, error) {
+	execution.mutex.Lock()
+	if execution.running {
+		execution.mutex.Unlock()
+		return nil, ErrExecutionRunning
+	}
+	if execution.finished {
+		execution.mutex.Unlock()
+		return execution.result, execution.err
+	}
+	execution.pending = nil
+	if execution.awaiting {
+		execution.awaiting = false
+		if resumeError != nil {
+			execution.paused = false
+			execution.finished = true
+			execution.err = executionError(resumeError)
+			execution.mutex.Unlock()
+			if execution.ctx.hooks != nil {
+				execution.ctx.hooks.error(execution.ctx, execution.err)
+			}
+			return nil, execution.err
+		}
+		if result == nil {
+			result = execution.plasma.none
+		}
+		execution.ctx.register = result
+	}
+	execution.running = true
+	execution.paused = false
+	execution.mutex.Unlock()
+	var runError error
+	if goContext.Err() != nil {
+		runError = cancellationError(goContext)
+	} else {
+		execution.ctx.goContext = withStreams(goContext, execution.streams)
+		runError = execution.plasma.run(execution.ctx)
+	}
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	execution.running = false
+	select {
+	case <-execution.suspend:
+		// Suspend arrived after the execution stopped running
+	default:
+	}
+	if runError == ErrSuspended {
+		execution.paused = true
+		execution.awaiting = execution.ctx.suspended
+		execution.pending = execution.ctx.pending
+		execution.ctx.suspended = false
+		execution.ctx.pending = nil
+		return nil, ErrSuspended
+	}
+	execution.finished = true
+	if runError != nil {
+		execution.err = runError
+		return nil, runError
+	}
+	execution.result = execution.ctx.register
+	return execution.result, nil
+}
+
+/*
+Suspend pauses the running execution before its next instruction, Run returns ErrSuspended once it paused.
+It has no effect on executions that are not running
+*/
+func (execution *Execution) Suspend() {
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	if !execution.running {
+		return
+	}
+	select {
+	case execution.suspend <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Suspended reports if the execution is paused, executions loaded by LoadExecution start paused
+*/
+func (execution *Execution) Suspended() bool {
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	return execution.paused
+}
+
+/*
+AwaitingResult reports if the execution was suspended by a built-in and expects its result in Resume
+*/
+func (execution *Execution) AwaitingResult() bool {
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	return execution.awaiting
+}
+
+/*
+Pending returns the Pending the execution is awaiting, nil when it was not suspended by a built-in returning one
+*/
+func (execution *Execution) Pending() *Pending {
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	return execution.pending
+}
+
+/*
+Save writes the globals of the VM and the paused execution, so it can be resumed by another VM with
+LoadExecution. Values are written like SaveGlobals does, executions holding built-in values in their
+operand stack, like the iterators of for loops over built-in sequences, fail with ErrNotSerializable
+*/
+func (execution *Execution) Save(w io.Writer) error {
+	execution.mutex.Lock()
+	defer execution.mutex.Unlock()
+	if execution.running {
+		return ErrExecutionRunning
+	}
+	if execution.finished {
+		return fmt.Errorf("%w: execution finished", ErrInvalidState)
+	}
+	ctx := execution.ctx
+	encoder := execution.plasma.newStateEncoder()
+	if encodeError := encoder.globals(); encodeError != nil {
+		return encodeError
+	}
+	saved := &savedExecution{Awaiting: execution.awaiting}
+	if ctx.limits != nil {
+		saved.Limits = ctx.limits.Limits
+		saved.Instructions = ctx.limits.instructions
+		saved.Values = ctx.limits.values
+	}
+	var encodeError error
+	for _, ctxCode := range stackValues(ctx.code) {
+		code := savedCode{
+			Bytecode: ctxCode.bytecode,
+			Rip:      ctxCode.rip,
+			OnExit:   stackValues(ctxCode.onExit),
+			Function: ctxCode.function,
+			Call:     ctxCode.call,
+			Line:     ctxCode.line,
+		}
+		saved.Codes = append(saved.Codes, code)
+	}
+	for index, value := range stackValues(ctx.stack) {
+		reference, valueError := encoder.value(value)
+		if valueError != nil {
+			return fmt.Errorf("stack %d: %w", index, valueError)
+		}
+		saved.Stack = append(saved.Stack, reference)
+	}
+	if saved.Register, encodeError = encoder.value(ctx.register); encodeError != nil {
+		return fmt.Errorf("register: %w", encodeError)
+	}
+	if saved.Symbols, encodeError = encoder.symbolTable(ctx.currentSymbols); encodeError != nil {
+		return fmt.Errorf("symbols: %w", encodeError)
+	}
+	saved.State = *encoder.state
+	return gob.NewEncoder(w).Encode(saved)
+}
+
+/*
+LoadExecution reads an execution written by Execution.Save, its globals are assigned to the root symbols of
+the VM like LoadGlobals does. The bytecode of every code frame is checked before resuming it
+*/
+func (plasma *Plasma) LoadExecution(r io.Reader) (*Execution, error) {
+	saved := &savedExecution{}
+	if decodeError := gob.NewDecoder(r).Decode(saved); decodeError != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidState, decodeError)
+	}
+	decoder, decodeError := plasma.decodeState(&saved.State)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+	ctx := plasma.newContext(nil)
+	ctx.code, ctx.bytecodeError = &common.ListStack[*contextCode]{}, nil
+	for index, code := range saved.Codes {
+		if verifyError := verifyFrame(code.Bytecode, code.Rip); verifyError != nil {
+			return nil, fmt.Errorf("%w: code %d: %s", ErrInvalidState, index, verifyError)
+		}
+		onExit := &common.ListStack[[]byte]{}
+		for _, block := range code.OnExit {
+			if verifyError := verifyFrame(block, 0); verifyError != nil {
+				return nil, fmt.Errorf("%w: code %d: %s", ErrInvalidState, index, verifyError)
+			}
+			onExit.Push(block)
+		}
+		ctx.code.Push(&contextCode{
+			bytecode: code.Bytecode,
+			rip:      code.Rip,
+			onExit:   onExit,
+			caches:   newInlineCaches(),
+			function: code.Function,
+			call:     code.Call,
+			line:     code.Line,
+		})
+	}
+	if !ctx.code.HasNext() {
+		return nil, fmt.Errorf("%w: no code", ErrInvalidState)
+	}
+	for _, reference := range saved.Stack {
+		value, referenceError := decoder.value(reference)
+		if referenceError != nil {
+			return nil, referenceError
+		}
+		ctx.stack.Push(value)
+	}
+	var referenceError error
+	if ctx.register, referenceError = decoder.value(saved.Register); referenceError != nil {
+		return nil, referenceError
+	}
+	if ctx.currentSymbols, referenceError = decoder.symbolTable(saved.Symbols); referenceError != nil {
+		return nil, referenceError
+	}
+	if ctx.currentSymbols == nil {
+		return nil, fmt.Errorf("%w: no symbols", ErrInvalidState)
+	}
+	if globalsError := decoder.globals(&saved.State); globalsError != nil {
+		return nil, globalsError
+	}
+	ctx.limits = newExecutionLimits(saved.Limits)
+	if ctx.limits != nil {
+		ctx.limits.instructions = saved.Instructions
+		ctx.limits.values = saved.Values
+	}
+	execution := plasma.newExecution(ctx)
+	execution.paused = true
+	execution.awaiting = saved.Awaiting
+	return execution, nil
+}
+
+/*
+stackValues returns the values of the stack, the bottom value first
+*/
+func stackValues[T any](stack *common.ListStack[T]) []T {
+	var values []T
+	for node := stack.Top; node != nil; node = node.Next {
+		values = append(values, node.Value.(T))
+	}
+	for left, right := 0, len(values)-1; left < right; left, right = left+1, right-1 {
+		values[left], values[right] = values[right], values[left]
+	}
+	return values
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"bytes"
+	gocontext "context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const approvalScript = `
+def request(amount)
+	requested = [amount]
+	defer requested.append("closed")
+	approved = approve("transfer " + amount.__string__())
+	if approved
+		requested.append("approved")
+	else
+		requested.append("rejected")
+	end
+	return requested
+end
+total = 10
+result = request(total * 2)
+(result, total)
+`
+
+func approvalVM(t *testing.T, prompts *[]string) *Plasma {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("approve", func(prompt string) (any, error) {
+		*prompts = append(*prompts, prompt)
+		return nil, ErrSuspended
+	}))
+	return p
+}
+
+func TestExecution_ResumeAwaiting(t *testing.T) {
+	var prompts []string
+	p := approvalVM(t, &prompts)
+	execution := p.NewExecution(compile(t, approvalScript), ExecuteOptions{})
+	result, runError := execution.Run(gocontext.Background())
+	assert.Nil(t, result)
+	assert.Equal(t, ErrSuspended, runError)
+	assert.True(t, execution.Suspended())
+	assert.True(t, execution.AwaitingResult())
+	assert.Equal(t, []string{"transfer 20"}, prompts)
+
+	result, runError = execution.Resume(gocontext.Background(), p.false)
+	assert.Nil(t, runError)
+	assert.False(t, execution.Suspended())
+	decoded, fromError := p.FromValue(result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{[]any{int64(20), "rejected", "closed"}, int64(10)}, decoded)
+
+	// Finished executions return their result again
+	again, runError := execution.Run(gocontext.Background())
+	assert.Nil(t, runError)
+	assert.Equal(t, result, again)
+	assert.NotNil(t, execution.Save(&bytes.Buffer{}))
+}
+
+func TestExecution_SaveLoad(t *testing.T) {
+	var prompts []string
+	p := approvalVM(t, &prompts)
+	execution := p.NewExecution(compile(t, approvalScript), ExecuteOptions{})
+	_, runError := execution.Run(gocontext.Background())
+	assert.Equal(t, ErrSuspended, runError)
+	saved := &bytes.Buffer{}
+	assert.Nil(t, execution.Save(saved))
+
+	// A new VM with the same bindings resumes the execution
+	restored := approvalVM(t, &prompts)
+	loaded, loadError := restored.LoadExecution(saved)
+	assert.Nil(t, loadError)
+	assert.True(t, loaded.Suspended())
+	assert.True(t, loaded.AwaitingResult())
+	result, runError := loaded.Resume(gocontext.Background(), restored.true)
+	assert.Nil(t, runError)
+	decoded, fromError := restored.FromValue(result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{[]any{int64(20), "approved", "closed"}, int64(10)}, decoded)
+	total, getError := restored.RootSymbols().Get("total")
+	assert.Nil(t, getError)
+	assert.Equal(t, int64(10), total.GetInt64())
+
+	_, loadError = restored.LoadExecution(bytes.NewBufferString("garbage"))
+	assert.True(t, errors.Is(loadError, ErrInvalidState))
+}
+
+func TestExecution_Suspend(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	started := make(chan struct{})
+	assert.Nil(t, p.LoadGo("started", func() { close(started) }))
+	execution := p.NewExecution(compile(t, `
+count = [0]
+started()
+while count[0] < 100000
+	count[0] = count[0] + 1
+end
+count[0]
+`), ExecuteOptions{})
+	done := make(chan error, 1)
+	go func() {
+		_, runError := execution.Run(gocontext.Background())
+		done <- runError
+	}()
+	<-started
+	execution.Suspend()
+	select {
+	case runError := <-done:
+		assert.Equal(t, ErrSuspended, runError)
+	case <-time.After(10 * time.Second):
+		t.Fatal("execution not suspended")
+	}
+	assert.True(t, execution.Suspended())
+	assert.False(t, execution.AwaitingResult())
+
+	saved := &bytes.Buffer{}
+	assert.Nil(t, execution.Save(saved))
+	restored := NewVM(nil, nil, nil)
+	assert.Nil(t, restored.LoadGo("started", func() {}))
+	loaded, loadError := restored.LoadExecution(saved)
+	assert.Nil(t, loadError)
+	result, runError := loaded.Run(gocontext.Background())
+	assert.Nil(t, runError)
+	assert.Equal(t, int64(100000), result.GetInt64())
+
+	// The original execution continues too
+	result, runError = execution.Run(gocontext.Background())
+	assert.Nil(t, runError)
+	assert.Equal(t, int64(100000), result.GetInt64())
+}
+
+func TestExecution_NotSuspendable(t *testing.T) {
+	var prompts []string
+	p := approvalVM(t, &prompts)
+	_, runError := p.ExecuteContext(gocontext.Background(), compile(t, `approve("x")`))
+	assert.True(t, errors.Is(runError, ErrSuspended))
+
+	// Built-in iterators in the operand stack can not be saved
+	execution := p.NewExecution(compile(t, `
+for value in range(0, 3, 1)
+	approve(value.__string__())
+end
+`), ExecuteOptions{})
+	_, runError = execution.Run(gocontext.Background())
+	assert.Equal(t, ErrSuspended, runError)
+	assert.True(t, errors.Is(execution.Save(&bytes.Buffer{}), ErrNotSerializable))
+}
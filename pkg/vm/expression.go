@@ -0,0 +1,140 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/common"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"sync"
+)
+
+var (
+	expressionVM     *Plasma
+	expressionVMOnce sync.Once
+)
+
+type (
+	/*
+		Expression is a compiled expression that can be evaluated many times and concurrently,
+		every evaluation binds its variables in its own scope over the root symbols of the VM
+	*/
+	Expression struct {
+		plasma   *Plasma
+		bytecode []byte
+		caches   *inlineCaches
+		contexts sync.Pool
+	}
+)
+
+/*
+CompileExpression compiles an expression evaluated by a VM shared by every expression compiled with it,
+the VM uses ProfilePure so expressions can not read or write the standard streams. Use
+Plasma.CompileExpression to evaluate expressions calling the Go bindings of a VM
+*/
+func CompileExpression(source string) (*Expression, error) {
+	expressionVMOnce.Do(func() {
+		expressionVM = NewVM(nil, nil, nil, WithProfile(ProfilePure))
+	})
+	return expressionVM.CompileExpression(source)
+}
+
+/*
+CompileExpression compiles an expression evaluated by the VM, sources with statements are rejected
+*/
+func (plasma *Plasma) CompileExpression(source string) (*Expression, error) {
+	program, compileError := compiler.CompileExpression(source)
+	if compileError != nil {
+		return nil, compileError
+	}
+	bytecode, headerError := programBody(program)
+	if headerError != nil {
+		return nil, headerError
+	}
+	return &Expression{
+		plasma:   plasma,
+		bytecode: bytecode,
+		caches:   newInlineCaches(),
+	}, nil
+}
+
+/*
+Eval evaluates the expression with the variables of env, they are converted with ToValue
+and *Value variables are used untouched
+*/
+func (expression *Expression) Eval(env map[string]any) (*Value, error) {
+	return expression.EvalContext(gocontext.Background(), env)
+}
+
+/*
+EvalContext is Eval aborting the evaluation when the context.Context is done, like ExecuteContext does
+*/
+func (expression *Expression) EvalContext(goContext gocontext.Context, env map[string]any) (*Value, error) {
+	if goContext.Err() != nil {
+		return nil, cancellationError(goContext)
+	}
+	plasma := expression.plasma
+	scope := plasma.NewScope()
+	for name, variable := range env {
+		value, isValue := variable.(*Value)
+		if !isValue {
+			var toValueError error
+			value, toValueError = plasma.ToValue(plasma.rootSymbols, variable)
+			if toValueError != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, toValueError)
+			}
+		}
+		scope.values[name] = value
+	}
+	ctx := expression.context(goContext, scope)
+	defer expression.contexts.Put(ctx)
+	if runError := plasma.run(ctx); runError != nil {
+		return nil, runError
+	}
+	if ctx.register == nil {
+		return plasma.none, nil
+	}
+	return ctx.register, nil
+}
+
+/*
+context takes a context from the pool and prepares it to evaluate the expression
+*/
+func (expression *Expression) context(goContext gocontext.Context, scope *Symbols) *context {
+	plasma := expression.plasma
+	ctx, reused := expression.contexts.Get().(*context)
+	if !reused {
+		ctx = &context{}
+	}
+	// Aborted evaluations leave code and values behind
+	if ctx.code == nil || ctx.code.HasNext() {
+		ctx.code = &common.ListStack[*contextCode]{}
+	}
+	if ctx.stack == nil || ctx.stack.HasNext() {
+		ctx.stack = &common.ListStack[*Value]{}
+	}
+	ctx.code.Push(&contextCode{
+		bytecode: expression.bytecode,
+		onExit:   &common.ListStack[[]byte]{},
+		caches:   expression.caches,
+	})
+	ctx.register = nil
+	ctx.currentSymbols = scope
+	ctx.goContext = goContext
+	ctx.limits = newExecutionLimits(plasma.limits)
+	ctx.stopped = plasma.stopped
+	ctx.hooks = plasma.Hooks()
+	ctx.debugger = plasma.Debugger()
+	return ctx
+}
+
+/*
+EvalAs evaluates the expression with Eval and decodes its result into T with As
+*/
+func EvalAs[T any](expression *Expression, env map[string]any) (T, error) {
+	result, evalError := expression.Eval(env)
+	if evalError != nil {
+		var zero T
+		return zero, evalError
+	}
+	return As[T](result)
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+type (
+	ruleOrder struct {
+		Total float64
+	}
+	ruleUser struct {
+		Tier string
+	}
+)
+
+func TestCompileExpression(t *testing.T) {
+	rule, compileError := CompileExpression(`order.Total > 100 and user.Tier in ["gold", "platinum"]`)
+	assert.Nil(t, compileError)
+	matches, evalError := EvalAs[bool](rule, map[string]any{
+		"order": &ruleOrder{Total: 150},
+		"user":  &ruleUser{Tier: "gold"},
+	})
+	assert.Nil(t, evalError)
+	assert.True(t, matches)
+	matches, evalError = EvalAs[bool](rule, map[string]any{
+		"order": &ruleOrder{Total: 150},
+		"user":  &ruleUser{Tier: "silver"},
+	})
+	assert.Nil(t, evalError)
+	assert.False(t, matches)
+
+	// Variables of one evaluation are not visible to the next one
+	_, evalError = rule.Eval(map[string]any{"order": &ruleOrder{Total: 150}})
+	assert.NotNil(t, evalError)
+
+	for _, source := range []string{
+		"x = 1",
+		"1\n2",
+		"def f()\n\treturn 1\nend",
+		"if true\n\t1\nend",
+		"1 +",
+	} {
+		_, compileError = CompileExpression(source)
+		assert.NotNil(t, compileError, source)
+	}
+}
+
+func TestPlasma_CompileExpression(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("discount", func(total float64) float64 { return total * 0.9 }))
+	expression, compileError := p.CompileExpression(`[discount(totals[0]), discount(totals[1])]`)
+	assert.Nil(t, compileError)
+	var wait sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				result, evalError := EvalAs[[]float64](expression, map[string]any{
+					"totals": []float64{float64(i * 10), float64(j * 10)},
+				})
+				assert.Nil(t, evalError)
+				assert.Equal(t, []float64{float64(i) * 9, float64(j) * 9}, result)
+			}
+		}(i)
+	}
+	wait.Wait()
+}
+
+func BenchmarkExpression_Eval(b *testing.B) {
+	rule, _ := CompileExpression(`order.Total > 100 and user.Tier in ["gold", "platinum"]`)
+	env := map[string]any{
+		"order": &ruleOrder{Total: 150},
+		"user":  &ruleUser{Tier: "gold"},
+	}
+	for i := 0; i < b.N; i++ {
+		_, _ = rule.Eval(env)
+	}
+}
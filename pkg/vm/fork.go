@@ -0,0 +1,293 @@
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	/*
+		forkCopier copies the globals a fork inherited from its template the first time the fork reads them,
+		copies are memoized so values shared between globals stay shared in the fork
+	*/
+	forkCopier struct {
+		mutex     sync.Mutex
+		plasma    *Plasma
+		templates map[*Symbols]struct{} // Root symbols of the template and of its own templates
+		pending   map[string]*Value     // Template globals not copied yet
+		values    map[*Value]*Value
+		symbols   map[*Symbols]*Symbols
+	}
+)
+
+/*
+Fork creates a VM with the globals of the VM at the moment of the call, like the Go bindings and the symbols
+defined by a prelude script. Built-in classes, built-in functions, Go bindings and other frozen values are shared
+with the template, while script functions, classes and mutable values are copied by the fork the first time it
+reads the global holding them, so executions in the fork never modify the template or other forks. Shared values
+are frozen, so scripts in the fork can not modify them either.
+The fork starts with the streams, hooks and limits of the template, built-ins writing to the streams use the ones
+of the fork. Do not modify the template globals while forks may still be copying them
+*/
+func (plasma *Plasma) Fork() *Plasma {
+	fork := &Plasma{
+		Stdin:    plasma.Stdin,
+		stdin:    plasma.stdin,
+		Stdout:   plasma.Stdout,
+		Stderr:   plasma.Stderr,
+		onDemand: plasma.onDemand,
+		true:     plasma.true,
+		false:    plasma.false,
+		none:     plasma.none,
+		value:    plasma.value,
+		string:   plasma.string,
+		bytes:    plasma.bytes,
+		bool:     plasma.bool,
+		noneType: plasma.noneType,
+		int:      plasma.int,
+		float:    plasma.float,
+		array:    plasma.array,
+		tuple:    plasma.tuple,
+		hash:     plasma.hash,
+		function: plasma.function,
+		class:    plasma.class,
+		profile:  plasma.profile,
+		limits:   plasma.limits,
+		stopped:  make(chan struct{}),
+	}
+	fork.SetHooks(plasma.Hooks())
+	copier := &forkCopier{
+		plasma:    fork,
+		templates: map[*Symbols]struct{}{plasma.rootSymbols: {}},
+		pending:   map[string]*Value{},
+		values:    map[*Value]*Value{},
+		symbols:   map[*Symbols]*Symbols{},
+	}
+	fork.rootSymbols = &Symbols{
+		mutex:  &sync.Mutex{},
+		values: plasma.globals(copier),
+		fork:   copier,
+	}
+	fork.streamBuiltins = fork.newStreamBuiltins()
+	fork.bindings = &sync.Map{}
+	plasma.bindings.Range(func(value, name any) bool {
+		fork.bindings.Store(value, name)
+		return true
+	})
+	fork.adapters = &sync.Map{}
+	plasma.adapters.Range(func(interfaceType, adapter any) bool {
+		fork.adapters.Store(interfaceType, adapter)
+		return true
+	})
+	for name, value := range fork.streamBuiltins {
+		value.Freeze()
+		fork.bindings.Store(value, name)
+	}
+	for name, builtin := range plasma.streamBuiltins {
+		copier.values[builtin] = fork.streamBuiltins[name]
+	}
+	for name, value := range fork.rootSymbols.values {
+		if builtin, found := copier.values[value]; found {
+			fork.rootSymbols.values[name] = builtin
+		} else if !forkShared(value) {
+			copier.pending[name] = value
+		}
+	}
+	return fork
+}
+
+/*
+globals returns the root symbols of the VM, globals a fork copied already are replaced by their copies.
+The templates of the VM are registered in the copier of the new fork
+*/
+func (plasma *Plasma) globals(copier *forkCopier) map[string]*Value {
+	template := plasma.rootSymbols.fork
+	if template != nil {
+		template.mutex.Lock()
+		defer template.mutex.Unlock()
+		for symbols := range template.templates {
+			copier.templates[symbols] = struct{}{}
+		}
+	}
+	plasma.rootSymbols.mutex.Lock()
+	values := make(map[string]*Value, len(plasma.rootSymbols.values))
+	for name, value := range plasma.rootSymbols.values {
+		values[name] = value
+	}
+	plasma.rootSymbols.mutex.Unlock()
+	if template != nil {
+		for name, value := range values {
+			if copied, found := template.values[value]; found {
+				values[name] = copied
+			}
+		}
+	}
+	return values
+}
+
+/*
+forkShared reports if forks can use the value of the template without copying it, only frozen values and
+proxies of Go structs are shared
+*/
+func forkShared(value *Value) bool {
+	value.mutex.Lock()
+	defer value.mutex.Unlock()
+	return value.frozen || value.proxy != nil
+}
+
+/*
+resolve returns the value of the global for the fork, copying it when the fork reads it for the first time
+*/
+func (copier *forkCopier) resolve(name string, value *Value) *Value {
+	copier.mutex.Lock()
+	defer copier.mutex.Unlock()
+	if copied, found := copier.values[value]; found {
+		// Read before the copy was stored
+		return copied
+	}
+	original, found := copier.pending[name]
+	if !found {
+		return value
+	}
+	delete(copier.pending, name)
+	if original != value {
+		// The fork assigned the global
+		return value
+	}
+	copied := copier.value(value)
+	root := copier.plasma.rootSymbols
+	root.mutex.Lock()
+	if root.values[name] == value {
+		root.values[name] = copied
+		atomic.AddUint64(&root.version, 1)
+	}
+	root.mutex.Unlock()
+	return copied
+}
+
+/*
+value copies the template value for the fork
+*/
+func (copier *forkCopier) value(value *Value) *Value {
+	if value == nil {
+		return nil
+	}
+	if copied, found := copier.values[value]; found {
+		return copied
+	}
+	if forkShared(value) {
+		return value
+	}
+	value.mutex.Lock()
+	typeId, class, v, vtable := value.typeId, value.class, value.v, value.vtable
+	value.mutex.Unlock()
+	plasma := copier.plasma
+	var result *Value
+	switch typeId {
+	case ArrayId, TupleId:
+		if typeId == ArrayId {
+			result = plasma.NewArray(nil)
+		} else {
+			result = plasma.NewTuple(nil)
+		}
+		copier.values[value] = result
+		values := v.([]*Value)
+		copiedValues := make([]*Value, 0, len(values))
+		for _, element := range values {
+			copiedValues = append(copiedValues, copier.value(element))
+		}
+		result.SetAny(copiedValues)
+	case HashId:
+		hash := v.(*Hash)
+		copiedHash := plasma.NewInternalHash()
+		result = plasma.NewHash(copiedHash)
+		copier.values[value] = result
+		hash.mutex.Lock()
+		entries := make(map[string]HashKeyValue, len(hash.internalMap))
+		for key, entry := range hash.internalMap {
+			entries[key] = entry
+		}
+		hash.mutex.Unlock()
+		for key, entry := range entries {
+			copiedHash.internalMap[key] = HashKeyValue{
+				Key:   copier.value(entry.Key),
+				Value: copier.value(entry.Value),
+			}
+		}
+	case IntId, FloatId, StringId, BytesId:
+		result = plasma.copyPrimitive(value)
+		copier.values[value] = result
+		// Attributes assigned by scripts, the methods of the primitive are the ones of the copy
+		for name, attribute := range vtable.Values() {
+			if _, isMethod := result.vtable.values[name]; isMethod {
+				continue
+			}
+			if _, isMethod := result.onDemand[name]; isMethod {
+				continue
+			}
+			result.vtable.values[name] = copier.value(attribute)
+		}
+	default:
+		// Objects, functions and classes keep their internal value and copy their symbols
+		result = &Value{
+			onDemand: value.onDemand,
+			typeId:   typeId,
+			mutex:    &sync.Mutex{},
+			v:        v,
+		}
+		copier.values[value] = result
+		result.class = copier.value(class)
+		switch typeId {
+		case FunctionId:
+			// The inline caches hold the values of the template, the copy fills its own
+			info := v.(FuncInfo)
+			info.caches = newInlineCaches()
+			result.v = info
+		case ClassId:
+			info := v.(*ClassInfo)
+			copiedInfo := &ClassInfo{
+				prepared: info.prepared,
+				Bytecode: info.Bytecode,
+				caches:   newInlineCaches(),
+			}
+			for _, base := range info.Bases {
+				copiedInfo.Bases = append(copiedInfo.Bases, copier.value(base))
+			}
+			result.v = copiedInfo
+		}
+		result.vtable = copier.symbolTable(vtable)
+		if result.vtable != nil && vtable.owner == value {
+			result.vtable.owner = result
+		}
+	}
+	return result
+}
+
+/*
+symbolTable copies the symbol table of a template value, the root symbols of the templates become the
+root symbols of the fork
+*/
+func (copier *forkCopier) symbolTable(symbols *Symbols) *Symbols {
+	if symbols == nil {
+		return nil
+	}
+	if _, isTemplate := copier.templates[symbols]; isTemplate {
+		return copier.plasma.rootSymbols
+	}
+	if copied, found := copier.symbols[symbols]; found {
+		return copied
+	}
+	result := NewSymbols(nil)
+	copier.symbols[symbols] = result
+	result.Parent = copier.symbolTable(symbols.Parent)
+	symbols.mutex.Lock()
+	values := make(map[string]*Value, len(symbols.values))
+	for name, value := range symbols.values {
+		values[name] = value
+	}
+	symbols.mutex.Unlock()
+	for name, value := range values {
+		result.values[name] = copier.value(value)
+	}
+	return result
+}
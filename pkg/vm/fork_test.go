@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+const forkPrelude = `
+greeting = "hello"
+def greet(name)
+	return greeting + " " + name
+end
+class Counter
+	def __init__()
+		self.count = 0
+	end
+	def increment()
+		self.count += 1
+		return self.count
+	end
+end
+counter = Counter()
+items = [1, 2]
+alias = items
+settings = {"mode": "template"}
+`
+
+func forkTemplate(t *testing.T) *Plasma {
+	p := NewVM(nil, &bytes.Buffer{}, nil)
+	assert.Nil(t, p.LoadGo("double", func(n int) int { return 2 * n }))
+	loadScript(t, p, forkPrelude)
+	return p
+}
+
+func TestPlasma_Fork(t *testing.T) {
+	template := forkTemplate(t)
+	first, second := template.Fork(), template.Fork()
+	out := &bytes.Buffer{}
+	first.Stdout = out
+	rCh, errCh, _ := first.ExecuteString(`
+greeting = "bye"
+counter.increment()
+counter.increment()
+items[0] = 10
+settings["mode"] = "fork"
+println(greet("fork"), double(counter.count), alias[0], settings["mode"])
+counter.count`)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int64(2), (<-rCh).GetInt64())
+	// Prelude functions see the globals of the fork and the Go bindings are shared
+	assert.Equal(t, "bye fork 4 10 fork\n", out.String())
+	// Neither the template nor other forks are modified
+	for _, p := range []*Plasma{template, second} {
+		rCh, errCh, _ = p.ExecuteString(`(greet("x"), counter.count, items[0], alias[0], settings["mode"])`)
+		assert.Nil(t, <-errCh)
+		result, fromError := p.FromValue(<-rCh)
+		assert.Nil(t, fromError)
+		assert.Equal(t, []any{"hello x", int64(0), int64(1), int64(1), "template"}, result)
+	}
+	// Copies keep the relations between values
+	counter, _ := first.RootSymbols().Get("counter")
+	class, _ := first.RootSymbols().Get("Counter")
+	assert.Same(t, class, counter.GetClass())
+	templateClass, _ := template.RootSymbols().Get("Counter")
+	assert.NotSame(t, templateClass, class)
+	double, _ := first.RootSymbols().Get("double")
+	templateDouble, _ := template.RootSymbols().Get("double")
+	assert.Same(t, templateDouble, double)
+	// Forks of forks start from the state of the fork
+	third := first.Fork()
+	rCh, errCh, _ = third.ExecuteString(`counter.increment()
+(greet("x"), counter.count, items[0])`)
+	assert.Nil(t, <-errCh)
+	result, fromError := third.FromValue(<-rCh)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{"bye x", int64(3), int64(10)}, result)
+	rCh, errCh, _ = first.ExecuteString("counter.count")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int64(2), (<-rCh).GetInt64())
+}
+
+func TestPlasma_ForkSharedReadOnly(t *testing.T) {
+	template := forkTemplate(t)
+	_, errCh, _ := template.ExecuteString("total = 1000 + 1000\ntotal.owner = 'template'")
+	assert.Nil(t, <-errCh)
+	fork := template.Fork()
+	for _, script := range []string{
+		"Value.leak = 'fork'",
+		"range.leak = 'r'",
+		"double.leak = 'd'",
+		"delete println.__string__",
+	} {
+		_, errCh, _ = fork.ExecuteString(script)
+		err := <-errCh
+		assert.NotNil(t, err, script)
+		assert.ErrorIs(t, err, ErrImmutableValue, script)
+	}
+	// Mutable primitives are copied with their attributes
+	rCh, errCh, _ := fork.ExecuteString("total.owner = 'fork'\ngreeting.owner = 'fork'\n(total + 0, total.owner, greeting)")
+	assert.Nil(t, <-errCh)
+	result, fromError := fork.FromValue(<-rCh)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{int64(2000), "fork", "hello"}, result)
+	rCh, errCh, _ = template.ExecuteString("total.owner")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, "template", (<-rCh).String())
+	for _, script := range []string{"Value.leak", "range.leak", "greeting.owner"} {
+		_, errCh, _ = template.ExecuteString(script)
+		assert.NotNil(t, <-errCh, script)
+	}
+}
+
+func TestPlasma_ForkConcurrent(t *testing.T) {
+	template := forkTemplate(t)
+	bytecode := compile(t, `for i in range(0, 10)
+	counter.increment()
+	items[0] = items[0] + 1
+end
+(counter.count, alias[0])`)
+	var wait sync.WaitGroup
+	for index := 0; index < 8; index++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			fork := template.Fork()
+			out := &bytes.Buffer{}
+			fork.Stdout = out
+			rCh, errCh, _ := fork.Execute(bytecode)
+			assert.Nil(t, <-errCh)
+			result, fromError := fork.FromValue(<-rCh)
+			assert.Nil(t, fromError)
+			assert.Equal(t, []any{int64(10), int64(11)}, result)
+			_, errCh, _ = fork.ExecuteString(`println(greet("fork"))`)
+			assert.Nil(t, <-errCh)
+			assert.Equal(t, fmt.Sprintln("hello fork"), out.String())
+		}()
+	}
+	wait.Wait()
+}
@@ -20,3 +20,12 @@ func (plasma *Plasma) NewBuiltInFunction(parent *Symbols, callback Callback) *Va
 	function.SetAny(callback)
 	return function
 }
+
+/*
+NewBuiltInContextFunction Creates a new built-in function Value that receives the context.Context of the execution
+*/
+func (plasma *Plasma) NewBuiltInContextFunction(parent *Symbols, callback ContextCallback) *Value {
+	function := plasma.NewValue(parent, BuiltInFunctionId, plasma.function)
+	function.SetAny(callback)
+	return function
+}
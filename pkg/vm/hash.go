@@ -1,6 +1,9 @@
 package vm
 
-import magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+import (
+	gocontext "context"
+	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+)
 
 func (plasma *Plasma) hashClass() *Value {
 	class := plasma.NewValue(plasma.rootSymbols, BuiltInClassId, plasma.class)
@@ -53,15 +56,28 @@ func (plasma *Plasma) NewHash(hash *Hash) *Value {
 			return result.GetHash().Get(argument[0])
 		},
 	))
-	result.Set(magic_functions.Set, plasma.NewBuiltInFunction(
+	result.Set(magic_functions.Set, plasma.NewBuiltInContextFunction(
 		result.vtable,
-		func(argument ...*Value) (*Value, error) {
-			return plasma.none, result.GetHash().Set(argument[0], argument[1])
+		func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
+			hash := result.GetHash()
+			if growthError := checkGrowth(ctx, hash.Size()+1); growthError != nil {
+				// Replacing the value of a key does not grow the hash
+				if found, inError := hash.In(argument[0]); inError != nil || !found {
+					return nil, growthError
+				}
+			}
+			return plasma.none, hash.Set(argument[0], argument[1])
 		},
 	))
 	result.Set(magic_functions.Del, plasma.NewBuiltInFunction(
 		result.vtable,
 		func(argument ...*Value) (*Value, error) {
+			if result.frozen {
+				return nil, ErrImmutableValue
+			}
 			return plasma.none, result.GetHash().Del(argument[0])
 		},
 	))
@@ -0,0 +1,159 @@
+package vm
+
+type (
+	/*
+		Position locates an instruction, Offset is relative to the bytecode of the function running it.
+		Line is the source line of its statement, 0 unless the bytecode was compiled with source positions
+	*/
+	Position struct {
+		Offset int64
+		Line   int
+	}
+	/*
+		Event describes where something happened. Function is the name of the running function,
+		empty for the top level code, classes and anonymous functions
+	*/
+	Event struct {
+		Opcode   byte
+		Function string
+		Position Position
+	}
+	/*
+		CallEvent is received by OnCall before calling a value, Event describes the call site and
+		Name is the name of the called function, empty when it is not a named script function
+	*/
+	CallEvent struct {
+		Event
+		Name      string
+		Callee    *Value
+		Arguments []*Value
+	}
+	/*
+		ReturnEvent is received by OnReturn when a function or class instantiation finishes,
+		Event describes the last instruction of the returning function. Result is the value received
+		by the caller, nil when the function returned nothing
+	*/
+	ReturnEvent struct {
+		Event
+		Result *Value
+	}
+	/*
+		ErrorEvent is received by OnError when the execution fails, Event describes the failing instruction
+	*/
+	ErrorEvent struct {
+		Event
+		Err error
+	}
+	/*
+		SymbolSetEvent is received by OnSymbolSet when the script assigns a symbol,
+		Receiver is nil for variables and the object for selector assignments
+	*/
+	SymbolSetEvent struct {
+		Event
+		Receiver *Value
+		Symbol   string
+		Value    *Value
+	}
+	/*
+		Hooks observe the executions of a VM, nil callbacks are skipped. Callbacks run in the goroutine
+		of the execution, concurrent executions call them concurrently
+	*/
+	Hooks struct {
+		OnInstruction func(event Event)
+		OnCall        func(event CallEvent)
+		OnReturn      func(event ReturnEvent)
+		OnError       func(event ErrorEvent)
+		OnSymbolSet   func(event SymbolSetEvent)
+	}
+)
+
+/*
+SetHooks installs the hooks used by the executions started after the call, nil removes them.
+Executions without hooks do not pay for them
+*/
+func (plasma *Plasma) SetHooks(hooks *Hooks) {
+	plasma.hooks.Store(hooks)
+}
+
+/*
+Hooks returns the installed hooks, nil when there are none
+*/
+func (plasma *Plasma) Hooks() *Hooks {
+	hooks, _ := plasma.hooks.Load().(*Hooks)
+	return hooks
+}
+
+/*
+event describes the instruction the context is running
+*/
+func (ctx *context) event() Event {
+	event := Event{
+		Opcode:   ctx.opcode,
+		Position: Position{Offset: ctx.instruction},
+	}
+	if ctx.code.HasNext() {
+		event.Function = ctx.code.Peek().function
+		event.Position.Line = ctx.code.Peek().line
+	}
+	return event
+}
+
+/*
+instruction records the instruction about to run, the other events refer to it
+*/
+func (hooks *Hooks) instruction(ctx *context) {
+	ctxCode := ctx.code.Peek()
+	ctx.instruction = ctxCode.rip
+	ctx.opcode = ctxCode.bytecode[ctxCode.rip]
+	if hooks.OnInstruction != nil {
+		hooks.OnInstruction(ctx.event())
+	}
+}
+
+func (hooks *Hooks) call(ctx *context, function *Value, arguments []*Value) {
+	if hooks.OnCall == nil {
+		return
+	}
+	var name string
+	if function.TypeId() == FunctionId {
+		name = function.GetFuncInfo().Name
+	}
+	hooks.OnCall(CallEvent{
+		Event:     ctx.event(),
+		Name:      name,
+		Callee:    function,
+		Arguments: arguments,
+	})
+}
+
+func (hooks *Hooks) ret(ctx *context, function string) {
+	if hooks.OnReturn == nil {
+		return
+	}
+	event := ctx.event()
+	event.Function = function
+	hooks.OnReturn(ReturnEvent{
+		Event:  event,
+		Result: ctx.register,
+	})
+}
+
+func (hooks *Hooks) error(ctx *context, err error) {
+	if hooks.OnError != nil {
+		hooks.OnError(ErrorEvent{
+			Event: ctx.event(),
+			Err:   err,
+		})
+	}
+}
+
+func (hooks *Hooks) symbolSet(ctx *context, receiver *Value, symbol string, value *Value) {
+	if hooks.OnSymbolSet != nil {
+		hooks.OnSymbolSet(SymbolSetEvent{
+			Event:    ctx.event(),
+			Receiver: receiver,
+			Symbol:   symbol,
+			Value:    value,
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordedHooks struct {
+	instructions map[string]int
+	calls        []string
+	returns      map[string]int64
+	errors       []ErrorEvent
+	symbols      []SymbolSetEvent
+}
+
+func newRecordedHooks() (*recordedHooks, *Hooks) {
+	recorded := &recordedHooks{
+		instructions: map[string]int{},
+		returns:      map[string]int64{},
+	}
+	return recorded, &Hooks{
+		OnInstruction: func(event Event) {
+			recorded.instructions[event.Function]++
+		},
+		OnCall: func(event CallEvent) {
+			if event.Name != "" {
+				recorded.calls = append(recorded.calls, event.Function+" -> "+event.Name)
+			}
+		},
+		OnReturn: func(event ReturnEvent) {
+			if event.Result != nil && event.Result.TypeId() == IntId {
+				recorded.returns[event.Function] = event.Result.GetInt64()
+			}
+		},
+		OnError: func(event ErrorEvent) {
+			recorded.errors = append(recorded.errors, event)
+		},
+		OnSymbolSet: func(event SymbolSetEvent) {
+			recorded.symbols = append(recorded.symbols, event)
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	recorded, hooks := newRecordedHooks()
+	p.SetHooks(hooks)
+	assert.Same(t, hooks, p.Hooks())
+	result := execute(t, p, `
+def double(n)
+	return n * 2
+end
+def add(a, b)
+	return double(a) + b
+end
+o = Value()
+o.total = add(1, 2)
+o.total
+`)
+	assert.Equal(t, int64(4), result.GetInt64())
+	assert.Equal(t, []string{" -> add", "add -> double"}, recorded.calls)
+	assert.Equal(t, map[string]int64{"add": 4, "double": 2}, recorded.returns)
+	assert.Greater(t, recorded.instructions[""], 0)
+	assert.Greater(t, recorded.instructions["add"], 0)
+	assert.Greater(t, recorded.instructions["double"], 0)
+	var assigned []string
+	for _, event := range recorded.symbols {
+		assigned = append(assigned, event.Symbol)
+	}
+	assert.Equal(t, []string{"double", "add", "o", "total"}, assigned)
+	assert.Nil(t, recorded.symbols[0].Receiver)
+	assert.Equal(t, opcodes.IdentifierAssign, recorded.symbols[0].Opcode)
+	assert.Equal(t, opcodes.SelectorAssign, recorded.symbols[3].Opcode)
+	assert.Equal(t, int64(4), recorded.symbols[3].Value.GetInt64())
+	o, _ := p.RootSymbols().Get("o")
+	assert.Same(t, o, recorded.symbols[3].Receiver)
+	assert.Empty(t, recorded.errors)
+
+	// Calls made from Go are reported too
+	add, _ := p.RootSymbols().Get("add")
+	_, callError := Call[int](p, add, 2, 3)
+	assert.Nil(t, callError)
+	assert.Equal(t, []string{" -> add", "add -> double", " -> add", "add -> double"}, recorded.calls)
+	assert.Equal(t, int64(7), recorded.returns["add"])
+
+	// Removing the hooks only affects new executions
+	p.SetHooks(nil)
+	assert.Nil(t, p.Hooks())
+	execute(t, p, "add(1, 1)")
+	assert.Equal(t, 4, len(recorded.calls))
+}
+
+func TestHooksOnError(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	recorded, hooks := newRecordedHooks()
+	p.SetHooks(hooks)
+	_, errCh, _ := p.ExecuteString("def fail(n)\n\treturn n.missing\nend\nfail(1)")
+	err := <-errCh
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(recorded.errors))
+	event := recorded.errors[0]
+	assert.Equal(t, err, event.Err)
+	assert.Equal(t, "fail", event.Function)
+	assert.Equal(t, opcodes.Selector, event.Opcode)
+}
@@ -0,0 +1,271 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
+	"reflect"
+	"strings"
+)
+
+type (
+	/*
+		ScriptObject is a script value used from Go through an interface, adapters registered with
+		RegisterInterface forward their methods to it with Method or CallMethod
+	*/
+	ScriptObject struct {
+		plasma *Plasma
+		value  *Value
+	}
+)
+
+/*
+NewScriptObject wraps the script value so Method and CallMethod can call its methods
+*/
+func (plasma *Plasma) NewScriptObject(value *Value) ScriptObject {
+	return ScriptObject{plasma: plasma, value: value}
+}
+
+/*
+Value returns the script value behind the object
+*/
+func (object ScriptObject) Value() *Value {
+	return object.value
+}
+
+/*
+Plasma returns the VM the object belongs to
+*/
+func (object ScriptObject) Plasma() *Plasma {
+	return object.plasma
+}
+
+/*
+CallMethod calls the method of the script object with Call, converting the arguments with ToValue and
+its result to T
+*/
+func CallMethod[T any](object ScriptObject, method string, arguments ...any) (T, error) {
+	function, getError := object.value.Get(method)
+	if getError != nil {
+		var zero T
+		return zero, getError
+	}
+	return Call[T](object.plasma, function, arguments...)
+}
+
+/*
+Method returns a function of type F calling the method of the script object, the method is looked up on every
+call. Arguments are converted with ToValue, variadic ones are passed as a single array, and the result is decoded
+with Decode. Functions with many results expect the method to return a tuple or array with one value per result.
+A first argument of type context.Context aborts the call like CallValueContext does. Errors of the call,
+including the decoding of its result, are returned by the last result when it is an error. Functions without
+an error result can not report them, so they panic with the error instead
+*/
+func Method[F any](object ScriptObject, name string) F {
+	functionType := reflect.TypeOf((*F)(nil)).Elem()
+	if functionType.Kind() != reflect.Func {
+		panic(fmt.Sprintf("%s is not a function type", functionType))
+	}
+	return object.method(name, functionType).Interface().(F)
+}
+
+func (object ScriptObject) method(name string, functionType reflect.Type) reflect.Value {
+	numOut := functionType.NumOut()
+	returnsError := numOut > 0 && functionType.Out(numOut-1) == errorType
+	if returnsError {
+		numOut--
+	}
+	return reflect.MakeFunc(functionType, func(arguments []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, 0, functionType.NumOut())
+		for index := 0; index < numOut; index++ {
+			results = append(results, reflect.New(functionType.Out(index)).Elem())
+		}
+		callError := object.callMethod(name, arguments, results)
+		if returnsError {
+			errorResult := reflect.New(errorType).Elem()
+			if callError != nil {
+				errorResult.Set(reflect.ValueOf(callError))
+			}
+			return append(results, errorResult)
+		}
+		if callError != nil {
+			panic(fmt.Errorf("%s: %w", name, callError))
+		}
+		return results
+	})
+}
+
+/*
+callMethod calls the method with the Go arguments and decodes its result into the results
+*/
+func (object ScriptObject) callMethod(name string, arguments, results []reflect.Value) error {
+	goContext := gocontext.Background()
+	if len(arguments) > 0 && arguments[0].Type() == contextType {
+		if !arguments[0].IsNil() {
+			goContext = arguments[0].Interface().(gocontext.Context)
+		}
+		arguments = arguments[1:]
+	}
+	goArguments := make([]any, 0, len(arguments))
+	for _, argument := range arguments {
+		goArguments = append(goArguments, argument.Interface())
+	}
+	callArguments, toValueError := object.plasma.toArguments(goArguments)
+	if toValueError != nil {
+		return toValueError
+	}
+	function, getError := object.value.Get(name)
+	if getError != nil {
+		return getError
+	}
+	result, callError := object.plasma.CallValueContext(goContext, function, callArguments...)
+	if callError != nil {
+		return callError
+	}
+	switch len(results) {
+	case 0:
+		return nil
+	case 1:
+		return (&decoder{}).decode(result, results[0], "")
+	}
+	switch result.TypeId() {
+	case TupleId, ArrayId:
+	default:
+		return mismatch("", fmt.Sprintf("tuple of %d values", len(results)), result)
+	}
+	values := result.GetValues()
+	if len(values) != len(results) {
+		return &DecodeError{Message: fmt.Sprintf("expecting %d results, got %d", len(results), len(values))}
+	}
+	for index, value := range values {
+		if decodeError := (&decoder{}).decode(value, results[index], fmt.Sprintf("[%d]", index)); decodeError != nil {
+			return decodeError
+		}
+	}
+	return nil
+}
+
+/*
+ImplementFuncs fills the function fields of the struct T with functions calling the methods of the script object
+like Method does. Fields are matched by their "plasma" tag or their name, fields tagged "-" and fields that
+are not functions are left untouched. It fails with ErrNotImplemented when obj lacks a method, use it when
+the Go side can work with a struct of functions instead of an interface
+*/
+func ImplementFuncs[T any](plasma *Plasma, obj *Value) (T, error) {
+	var result T
+	structValue := reflect.ValueOf(&result).Elem()
+	if structValue.Kind() != reflect.Struct {
+		return result, fmt.Errorf("%s is not a struct", structValue.Type())
+	}
+	object := plasma.NewScriptObject(obj)
+	var missing []string
+	for index := 0; index < structValue.NumField(); index++ {
+		field := structValue.Type().Field(index)
+		name := field.Tag.Get("plasma")
+		if !field.IsExported() || field.Type.Kind() != reflect.Func || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if !hasMethod(obj, name, field.Type) {
+			missing = append(missing, name)
+			continue
+		}
+		structValue.Field(index).Set(object.method(name, field.Type))
+	}
+	if len(missing) > 0 {
+		return result, fmt.Errorf("%w: %s, missing methods %s", ErrNotImplemented, structValue.Type(), strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+/*
+RegisterInterface registers in the VM the adapter Implement uses to expose script objects as I, forks
+created afterwards inherit it. Go can not create methods at runtime, so every interface needs a type
+implementing it. The plasma-adapter command generates it from the interface declaration:
+
+	//go:generate go run github.com/shoriwe/plasma/cmd/plasma-adapter -type Handler
+
+Adapters can also be written by hand, forwarding their methods with Method:
+
+	type handlerAdapter struct{ vm.ScriptObject }
+
+	func (h handlerAdapter) Handle(request string) (string, error) {
+		return vm.Method[func(string) (string, error)](h.ScriptObject, "Handle")(request)
+	}
+
+	vm.RegisterInterface[Handler](p, func(object vm.ScriptObject) Handler { return handlerAdapter{object} })
+*/
+func RegisterInterface[I any](plasma *Plasma, adapter func(object ScriptObject) I) {
+	interfaceType := reflect.TypeOf((*I)(nil)).Elem()
+	if interfaceType.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("%s is not an interface", interfaceType))
+	}
+	plasma.adapters.Store(interfaceType, adapter)
+}
+
+/*
+callable reports if the value can be called with the number of arguments, only the arguments of script
+functions are known before calling them
+*/
+func callable(value *Value, arguments int) bool {
+	switch value.TypeId() {
+	case FunctionId:
+		return len(value.GetFuncInfo().Arguments) == arguments
+	case BuiltInFunctionId, BuiltInClassId, ClassId:
+		return true
+	}
+	_, getError := value.Get(magic_functions.Call)
+	return getError == nil
+}
+
+/*
+hasMethod reports if the object has a method callable with the arguments of the function type,
+context.Context arguments are not passed to the script
+*/
+func hasMethod(obj *Value, name string, functionType reflect.Type) bool {
+	function, getError := obj.Get(name)
+	if getError != nil {
+		return false
+	}
+	arguments := functionType.NumIn()
+	if arguments > 0 && functionType.In(0) == contextType {
+		arguments--
+	}
+	return callable(function, arguments)
+}
+
+/*
+Implement returns obj as an I whose methods call the methods of the script object with the same name, using
+the adapter registered for I in the VM with RegisterInterface. It works with instances of script classes and
+with objects built from Value. It fails with ErrNotImplemented when obj lacks a method of I, the method expects
+a different number of arguments or no adapter was registered. Proxies of Go pointers implementing I are
+returned untouched. Adapters built with Method return script errors through the error result of the methods
+that have one, methods without it panic with the error
+*/
+func Implement[I any](plasma *Plasma, obj *Value) (I, error) {
+	var zero I
+	interfaceType := reflect.TypeOf((*I)(nil)).Elem()
+	if interfaceType.Kind() != reflect.Interface {
+		return zero, fmt.Errorf("%s is not an interface", interfaceType)
+	}
+	if obj.proxy != nil && obj.proxy.pointer.Type().Implements(interfaceType) {
+		return obj.proxy.pointer.Interface().(I), nil
+	}
+	var missing []string
+	for index := 0; index < interfaceType.NumMethod(); index++ {
+		method := interfaceType.Method(index)
+		if !hasMethod(obj, method.Name, method.Type) {
+			missing = append(missing, method.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return zero, fmt.Errorf("%w: %s, missing methods %s", ErrNotImplemented, interfaceType, strings.Join(missing, ", "))
+	}
+	adapter, found := plasma.adapters.Load(interfaceType)
+	if !found {
+		return zero, fmt.Errorf("%w: no adapter registered for %s", ErrNotImplemented, interfaceType)
+	}
+	return adapter.(func(object ScriptObject) I)(plasma.NewScriptObject(obj)), nil
+}
@@ -0,0 +1,203 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type (
+	implementRequest struct {
+		Path string `plasma:"path"`
+	}
+	implementResponse struct {
+		Status int    `plasma:"status"`
+		Body   string `plasma:"body"`
+	}
+	implementHandler interface {
+		Handle(request *implementRequest) (implementResponse, error)
+		Name() string
+	}
+	implementHandlerAdapter struct{ ScriptObject }
+	implementUnregistered   interface {
+		Handle(request *implementRequest)
+	}
+	goHandler struct{}
+)
+
+func (handler implementHandlerAdapter) Handle(request *implementRequest) (implementResponse, error) {
+	return Method[func(*implementRequest) (implementResponse, error)](handler.ScriptObject, "Handle")(request)
+}
+
+func (handler implementHandlerAdapter) Name() string {
+	return Method[func() string](handler.ScriptObject, "Name")()
+}
+
+func (handler *goHandler) Handle(request *implementRequest) (implementResponse, error) {
+	return implementResponse{Status: 200, Body: "go"}, nil
+}
+
+func (handler *goHandler) Name() string {
+	return "go"
+}
+
+func implementVM() *Plasma {
+	p := NewVM(nil, nil, nil)
+	RegisterInterface[implementHandler](p, func(object ScriptObject) implementHandler {
+		return implementHandlerAdapter{object}
+	})
+	return p
+}
+
+func TestImplement(t *testing.T) {
+	p := implementVM()
+	for _, script := range []string{`
+class Handler
+	def __init__(name)
+		self.name = name
+	end
+	def Handle(request)
+		request.path = "/handled" + request.path
+		return {"status": 200, "body": self.name}
+	end
+	def Name()
+		return self.name
+	end
+end
+Handler("class")
+`, `
+handler = Value()
+handler.name = "object"
+def handle(request)
+	request.path = "/handled" + request.path
+	return {"status": 200, "body": handler.name}
+end
+handler.Handle = handle
+def name()
+	return handler.name
+end
+handler.Name = name
+handler
+`} {
+		value := execute(t, p, script)
+		handler, err := Implement[implementHandler](p, value)
+		assert.Nil(t, err)
+		request := &implementRequest{Path: "/index"}
+		response, err := handler.Handle(request)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, response.Status)
+		assert.Equal(t, handler.Name(), response.Body)
+		assert.Equal(t, "/handled/index", request.Path)
+	}
+}
+
+func TestImplementErrors(t *testing.T) {
+	p := implementVM()
+	missing := execute(t, p, "o = Value()\ndef name()\n\treturn 'o'\nend\no.Name = name\no")
+	_, err := Implement[implementHandler](p, missing)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	assert.Contains(t, err.Error(), "missing methods Handle")
+	arity := execute(t, p, "o = Value()\ndef name()\n\treturn 'o'\nend\no.Name = name\no.Handle = name\no")
+	_, err = Implement[implementHandler](p, arity)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	unregistered := execute(t, p, "o = Value()\ndef handle(request)\n\treturn none\nend\no.Handle = handle\no")
+	_, err = Implement[implementUnregistered](p, unregistered)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	assert.Contains(t, err.Error(), "no adapter registered")
+	_, err = Implement[string](p, unregistered)
+	assert.NotNil(t, err)
+	// Go values implementing the interface are returned untouched
+	original := &goHandler{}
+	value, toValueError := p.ToValue(nil, original)
+	assert.Nil(t, toValueError)
+	handler, err := Implement[implementHandler](p, value)
+	assert.Nil(t, err)
+	assert.Same(t, original, handler)
+	// Errors raised by the script are returned by the method
+	failing := execute(t, p, "class Failing\n\tdef __init__()\n\t\tself.name = 'failing'\n\tend\n\tdef Handle(request)\n\t\treturn 1 / none\n\tend\n\tdef Name()\n\t\treturn 'failing'\n\tend\nend\nFailing()")
+	handler, err = Implement[implementHandler](p, failing)
+	assert.Nil(t, err)
+	_, err = handler.Handle(&implementRequest{})
+	assert.NotNil(t, err)
+	// Methods without an error result panic with the error
+	failing = execute(t, p, "class Failing\n\tdef __init__()\n\tend\n\tdef Handle(request)\n\t\treturn none\n\tend\n\tdef Name()\n\t\treturn 1 / none\n\tend\nend\nFailing()")
+	handler, err = Implement[implementHandler](p, failing)
+	assert.Nil(t, err)
+	assert.Panics(t, func() { handler.Name() })
+	// Adapters are registered per VM, forks inherit them
+	_, err = Implement[implementHandler](NewVM(nil, nil, nil), failing)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	_, err = Implement[implementHandler](p.Fork(), failing)
+	assert.Nil(t, err)
+}
+
+func TestMethod(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	object := p.NewScriptObject(execute(t, p, `
+class Math
+	def __init__()
+	end
+	def DivMod(a, b)
+		return (a // b, a % b)
+	end
+	def Sum(values)
+		total = 0
+		for value in values
+			total += value
+		end
+		return total
+	end
+end
+Math()
+`))
+	quotient, remainder, err := Method[func(int, int) (int, int, error)](object, "DivMod")(7, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, quotient)
+	assert.Equal(t, 1, remainder)
+	sum, err := Method[func(gocontext.Context, []int) (int64, error)](object, "Sum")(gocontext.Background(), []int{1, 2, 3})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), sum)
+	// Decoding errors are returned too
+	_, err = Method[func(int, int) (string, error)](object, "DivMod")(7, 2)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	_, err = Method[func() (int, error)](object, "Missing")()
+	assert.NotNil(t, err)
+}
+
+func TestImplementFuncs(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	type handlerFuncs struct {
+		Handle  func(request *implementRequest) (implementResponse, error)
+		GetName func() string `plasma:"Name"`
+		Ignored func()        `plasma:"-"`
+		name    func() string
+	}
+	value := execute(t, p, `
+class Handler
+	def __init__()
+	end
+	def Handle(request)
+		return {"status": 201, "body": request.path}
+	end
+	def Name()
+		return "funcs"
+	end
+end
+Handler()
+`)
+	funcs, err := ImplementFuncs[handlerFuncs](p, value)
+	assert.Nil(t, err)
+	assert.Nil(t, funcs.Ignored)
+	assert.Nil(t, funcs.name)
+	assert.Equal(t, "funcs", funcs.GetName())
+	response, err := funcs.Handle(&implementRequest{Path: "/funcs"})
+	assert.Nil(t, err)
+	assert.Equal(t, implementResponse{Status: 201, Body: "/funcs"}, response)
+	type missingFuncs struct {
+		Close func() error
+	}
+	_, err = ImplementFuncs[missingFuncs](p, value)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	assert.Contains(t, err.Error(), "missing methods Close")
+}
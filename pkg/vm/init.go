@@ -1,7 +1,8 @@
 package vm
 
 import (
-	"bufio"
+	gocontext "context"
+	"fmt"
 	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
 	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
 )
@@ -134,62 +135,21 @@ func (plasma *Plasma) init() {
 	plasma.rootSymbols.Set(special_symbols.Class, plasma.class)
 	/*
 		- input
+		- read_line
+		- read_all
+		- read_bytes
+		- lines
 		- print
 		- println
+		- eprint
+		- eprintln
+		- flush
 		- range
 	*/
-	plasma.rootSymbols.Set(special_symbols.Input, plasma.NewBuiltInFunction(plasma.rootSymbols,
-		func(argument ...*Value) (*Value, error) {
-			_, writeError := plasma.Stdout.Write([]byte(argument[0].String()))
-			if writeError != nil {
-				panic(writeError)
-			}
-			scanner := bufio.NewScanner(plasma.Stdin)
-			if scanner.Scan() {
-				return plasma.NewString(scanner.Bytes()), nil
-			}
-			return plasma.none, nil
-		},
-	))
-	plasma.rootSymbols.Set(special_symbols.Print, plasma.NewBuiltInFunction(plasma.rootSymbols,
-		func(argument ...*Value) (*Value, error) {
-			for index, arg := range argument {
-				if index != 0 {
-					_, writeError := plasma.Stdout.Write([]byte(" "))
-					if writeError != nil {
-						panic(writeError)
-					}
-				}
-				_, writeError := plasma.Stdout.Write([]byte(arg.String()))
-				if writeError != nil {
-					panic(writeError)
-				}
-
-			}
-			return plasma.none, nil
-		},
-	))
-	plasma.rootSymbols.Set(special_symbols.Println, plasma.NewBuiltInFunction(plasma.rootSymbols,
-		func(argument ...*Value) (*Value, error) {
-			for index, arg := range argument {
-				if index != 0 {
-					_, writeError := plasma.Stdout.Write([]byte(" "))
-					if writeError != nil {
-						panic(writeError)
-					}
-				}
-				_, writeError := plasma.Stdout.Write([]byte(arg.String()))
-				if writeError != nil {
-					panic(writeError)
-				}
-			}
-			_, writeError := plasma.Stdout.Write([]byte("\n"))
-			if writeError != nil {
-				panic(writeError)
-			}
-			return plasma.none, nil
-		},
-	))
+	plasma.streamBuiltins = plasma.newStreamBuiltins()
+	for name, builtin := range plasma.streamBuiltins {
+		plasma.rootSymbols.Set(name, builtin)
+	}
 	plasma.rootSymbols.Set(special_symbols.Range, plasma.NewBuiltInFunction(plasma.rootSymbols,
 		func(argument ...*Value) (*Value, error) {
 			var (
@@ -246,3 +206,121 @@ func (plasma *Plasma) init() {
 		},
 	))
 }
+
+/*
+newStreamBuiltins creates the built-ins using the standard streams of the execution calling them or the ones
+of the VM, see ioSymbols
+*/
+func (plasma *Plasma) newStreamBuiltins() map[string]*Value {
+	return map[string]*Value{
+		special_symbols.Input: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				_, writeError := plasma.stdout(ctx).Write([]byte(argument[0].String()))
+				if writeError != nil {
+					return nil, writeError
+				}
+				return plasma.readLine(ctx)
+			},
+		),
+		special_symbols.ReadLine: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, _ ...*Value) (*Value, error) {
+				return plasma.readLine(ctx)
+			},
+		),
+		special_symbols.ReadAll: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, _ ...*Value) (*Value, error) {
+				contents, readError := plasma.read(ctx, func(buffer []byte, ended bool) (int, bool) {
+					return len(buffer), ended
+				})
+				if readError != nil {
+					return nil, readError
+				}
+				return plasma.NewString(contents), nil
+			},
+		),
+		special_symbols.ReadBytes: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				if argument[0].TypeId() != IntId || argument[0].GetInt64() < 0 {
+					return nil, fmt.Errorf("%w: read_bytes expects a positive Int", ErrTypeMismatch)
+				}
+				count := int(argument[0].GetInt64())
+				contents, readError := plasma.read(ctx, func(buffer []byte, ended bool) (int, bool) {
+					if len(buffer) >= count {
+						return count, true
+					}
+					return len(buffer), ended
+				})
+				if readError != nil {
+					return nil, readError
+				}
+				return plasma.NewBytes(contents), nil
+			},
+		),
+		special_symbols.Lines: plasma.NewBuiltInFunction(plasma.rootSymbols,
+			func(_ ...*Value) (*Value, error) {
+				var (
+					iter    = plasma.NewValue(plasma.rootSymbols, ValueId, plasma.value)
+					line    *Value
+					fetched bool
+				)
+				// The next line is read ahead to know if there is one
+				fetch := func(ctx gocontext.Context) error {
+					if fetched {
+						return nil
+					}
+					next, readError := plasma.readLine(ctx)
+					if readError != nil {
+						return readError
+					}
+					line, fetched = next, true
+					return nil
+				}
+				iter.Set(magic_functions.HasNext, plasma.NewBuiltInContextFunction(
+					iter.vtable,
+					func(ctx gocontext.Context, _ ...*Value) (*Value, error) {
+						if fetchError := fetch(ctx); fetchError != nil {
+							return nil, fetchError
+						}
+						return plasma.NewBool(line != plasma.none), nil
+					},
+				))
+				iter.Set(magic_functions.Next, plasma.NewBuiltInContextFunction(
+					iter.vtable,
+					func(ctx gocontext.Context, _ ...*Value) (*Value, error) {
+						if fetchError := fetch(ctx); fetchError != nil {
+							return nil, fetchError
+						}
+						fetched = line == plasma.none
+						return line, nil
+					},
+				))
+				return iter, nil
+			},
+		),
+		special_symbols.Print: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				return plasma.none, plasma.write(plasma.stdout(ctx), argument, "")
+			},
+		),
+		special_symbols.Println: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				return plasma.none, plasma.write(plasma.stdout(ctx), argument, "\n")
+			},
+		),
+		special_symbols.EPrint: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				return plasma.none, plasma.write(plasma.stderr(ctx), argument, "")
+			},
+		),
+		special_symbols.EPrintln: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				return plasma.none, plasma.write(plasma.stderr(ctx), argument, "\n")
+			},
+		),
+		special_symbols.Flush: plasma.NewBuiltInContextFunction(plasma.rootSymbols,
+			func(ctx gocontext.Context, _ ...*Value) (*Value, error) {
+				return plasma.none, plasma.flush(ctx)
+			},
+		),
+	}
+}
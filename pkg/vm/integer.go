@@ -15,10 +15,32 @@ func (plasma *Plasma) integerClass() *Value {
 	return class
 }
 
+const (
+	minSmallInt int64 = -128
+	maxSmallInt int64 = 1023
+)
+
 /*
-NewInt Creates a new int Value
+NewInt Creates a new int Value. Values between -128 and 1023 are interned, every call with them
+returns the same shared Value, which is frozen so scripts changing its attributes change a copy
 */
 func (plasma *Plasma) NewInt(i int64) *Value {
+	if i < minSmallInt || i > maxSmallInt || plasma.int == nil {
+		return plasma.newInt(i)
+	}
+	slot := &plasma.smallInts[i-minSmallInt]
+	if cached := slot.Load(); cached != nil {
+		return cached.(*Value)
+	}
+	result := plasma.newInt(i)
+	result.frozen, result.shared = true, true
+	if !slot.CompareAndSwap(nil, result) {
+		return slot.Load().(*Value)
+	}
+	return result
+}
+
+func (plasma *Plasma) newInt(i int64) *Value {
 	result := plasma.NewValue(plasma.rootSymbols, IntId, plasma.int)
 	result.SetAny(i)
 	result.Set(magic_functions.Positive,
@@ -0,0 +1,177 @@
+package vm
+
+import (
+	gocontext "context"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+)
+
+type (
+	/*
+		Limits caps the resources a single execution can use, zero values mean unlimited.
+		MaxCallDepth counts the code frames of functions, classes and defer blocks.
+		MaxValues and the size limits are approximate, values are counted by the instructions creating them
+		and sizes are checked on the values produced by each instruction and by the built-ins growing arrays
+		and hashes. MaxArraySize caps the entries of hashes too
+	*/
+	Limits struct {
+		MaxInstructions int64
+		MaxCallDepth    int64
+		MaxStackSize    int64
+		MaxValues       int64
+		MaxStringSize   int64
+		MaxArraySize    int64
+	}
+	executionLimits struct {
+		Limits
+		instructions int64
+		values       int64
+	}
+	limitsKey struct{}
+)
+
+func newExecutionLimits(limits Limits) *executionLimits {
+	if limits == (Limits{}) {
+		return nil
+	}
+	return &executionLimits{Limits: limits}
+}
+
+func (limits *executionLimits) instruction() {
+	limits.instructions++
+	if limits.MaxInstructions > 0 && limits.instructions > limits.MaxInstructions {
+		panic(ErrInstructionLimit)
+	}
+}
+
+func (limits *executionLimits) allocate() {
+	limits.values++
+	if limits.MaxValues > 0 && limits.values > limits.MaxValues {
+		panic(ErrValuesLimit)
+	}
+}
+
+func (limits *executionLimits) callDepth(depth int) {
+	if limits.MaxCallDepth > 0 && int64(depth) >= limits.MaxCallDepth {
+		panic(ErrCallDepthLimit)
+	}
+}
+
+func (limits *executionLimits) stackSize(size int) {
+	if limits.MaxStackSize > 0 && int64(size) >= limits.MaxStackSize {
+		panic(ErrStackSizeLimit)
+	}
+}
+
+func (limits *executionLimits) checkStringSize(size int64) {
+	if limits.MaxStringSize > 0 && size > limits.MaxStringSize {
+		panic(ErrStringSizeLimit)
+	}
+}
+
+func (limits *executionLimits) checkArraySize(size int64) {
+	if limits.MaxArraySize > 0 && size > limits.MaxArraySize {
+		panic(ErrArraySizeLimit)
+	}
+}
+
+/*
+checkSize rejects strings, byte strings, arrays, tuples and hashes bigger than the limits
+*/
+func (limits *executionLimits) checkSize(value *Value) {
+	if value == nil {
+		return
+	}
+	switch value.TypeId() {
+	case StringId, BytesId:
+		limits.checkStringSize(int64(len(value.GetBytes())))
+	case ArrayId, TupleId:
+		limits.checkArraySize(int64(len(value.GetValues())))
+	case HashId:
+		limits.checkArraySize(value.GetHash().Size())
+	}
+}
+
+/*
+withLimits returns the context.Context passed to built-ins, it carries the limits so built-ins growing
+arrays and hashes can check them
+*/
+func withLimits(goContext gocontext.Context, limits *executionLimits) gocontext.Context {
+	if limits == nil || limits.MaxArraySize <= 0 {
+		return goContext
+	}
+	return gocontext.WithValue(goContext, limitsKey{}, limits)
+}
+
+/*
+checkGrowth fails with ErrArraySizeLimit when the execution running with the context.Context does not allow
+arrays and hashes of the size
+*/
+func checkGrowth(goContext gocontext.Context, size int64) error {
+	limits, _ := goContext.Value(limitsKey{}).(*executionLimits)
+	if limits != nil && limits.MaxArraySize > 0 && size > limits.MaxArraySize {
+		return ErrArraySizeLimit
+	}
+	return nil
+}
+
+/*
+checkBinary predicts the size of concatenations and repetitions before they are computed,
+so scripts like "a" * 1000000000000 fail without allocating the result
+*/
+func (limits *executionLimits) checkBinary(op byte, left, right *Value) {
+	switch op {
+	case opcodes.Add:
+		switch left.TypeId() {
+		case StringId, BytesId:
+			switch right.TypeId() {
+			case StringId, BytesId:
+				limits.checkStringSize(int64(len(left.GetBytes())) + int64(len(right.GetBytes())))
+			}
+		}
+	case opcodes.Mul:
+		sequence, times := left, right
+		if sequence.TypeId() == IntId {
+			sequence, times = right, left
+		}
+		if times.TypeId() != IntId {
+			return
+		}
+		n := times.GetInt64()
+		if n <= 0 {
+			return
+		}
+		switch sequence.TypeId() {
+		case StringId, BytesId:
+			length := int64(len(sequence.GetBytes()))
+			if length > 0 && limits.MaxStringSize > 0 && n > limits.MaxStringSize/length {
+				panic(ErrStringSizeLimit)
+			}
+		case ArrayId:
+			length := int64(len(sequence.GetValues()))
+			if length > 0 && limits.MaxArraySize > 0 && n > limits.MaxArraySize/length {
+				panic(ErrArraySizeLimit)
+			}
+		}
+	}
+}
+
+func (ctx *context) allocate() {
+	if ctx.limits != nil {
+		ctx.limits.allocate()
+	}
+}
+
+func (ctx *context) checkCallDepth() {
+	if ctx.limits != nil {
+		ctx.limits.callDepth(ctx.code.Len())
+	}
+}
+
+/*
+checkStackSize checks the operand stack can hold the number of values about to be pushed
+*/
+func (ctx *context) checkStackSize(pushes int) {
+	if ctx.limits != nil {
+		ctx.limits.stackSize(ctx.stack.Len() + pushes - 1)
+	}
+}
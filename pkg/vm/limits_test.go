@@ -0,0 +1,83 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func executeLimited(t *testing.T, script string, limits Limits) (*Value, error) {
+	p := NewVM(nil, nil, nil)
+	return p.ExecuteWithOptions(gocontext.Background(), compile(t, script), ExecuteOptions{Limits: limits})
+}
+
+func TestLimits(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		script   string
+		limits   Limits
+		expected error
+	}{
+		{"instructions", "while true\n\ta = 1\nend", Limits{MaxInstructions: 1000}, ErrInstructionLimit},
+		{"call depth", "def f(n)\n\treturn f(n + 1)\nend\nf(0)", Limits{MaxCallDepth: 100}, ErrCallDepthLimit},
+		{"stack size", "(" + strings.Repeat("1, ", 100) + "1)", Limits{MaxStackSize: 50}, ErrStackSizeLimit},
+		{"values", "a = []\nwhile true\n\ta = [a]\nend", Limits{MaxValues: 1000}, ErrValuesLimit},
+		{"string concatenation", "s = 'a'\nwhile true\n\ts += s\nend", Limits{MaxStringSize: 1024}, ErrStringSizeLimit},
+		{"string repetition", "'a' * 1000000000000", Limits{MaxStringSize: 1024}, ErrStringSizeLimit},
+		{"array repetition", "[1, 2] * 1000000000000", Limits{MaxArraySize: 1024}, ErrArraySizeLimit},
+		{"array literal", "[1, 2, 3, 4, 5]", Limits{MaxArraySize: 4}, ErrArraySizeLimit},
+		// Values growing in place are checked by the built-ins modifying them
+		{"array append", "a = []\nwhile true\n\ta.append(1)\nend", Limits{MaxArraySize: 100, MaxInstructions: 1000000}, ErrArraySizeLimit},
+		{"array insert", "a = []\nwhile true\n\ta.insert(0, 1)\nend", Limits{MaxArraySize: 100, MaxInstructions: 1000000}, ErrArraySizeLimit},
+		{"hash set", "h = {}\ni = 0\nwhile true\n\th[i] = i\n\ti += 1\nend", Limits{MaxArraySize: 100, MaxInstructions: 1000000}, ErrArraySizeLimit},
+		{"hash literal", "{1: 1, 2: 2, 3: 3}", Limits{MaxArraySize: 2}, ErrArraySizeLimit},
+		{"class arguments", "class C\n\tdef __init__(a, b, c)\n\tend\nend\n(1, 2, C(1, 2, 3))", Limits{MaxStackSize: 5}, ErrStackSizeLimit},
+		{"class call depth", "class C\n\tdef __init__()\n\t\tC()\n\tend\nend\nC()", Limits{MaxCallDepth: 50}, ErrCallDepthLimit},
+	} {
+		_, err := executeLimited(t, test.script, test.limits)
+		assert.True(t, errors.Is(err, test.expected), "%s: %v", test.name, err)
+		assert.True(t, errors.Is(err, ErrLimitExceeded), test.name)
+	}
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	result, err := executeLimited(t, `
+def fib(n)
+	if n < 2
+		return n
+	end
+	return fib(n - 1) + fib(n - 2)
+end
+fib(10)
+`, Limits{
+		MaxInstructions: 100000,
+		MaxCallDepth:    20,
+		MaxStackSize:    20,
+		MaxValues:       10000,
+		MaxStringSize:   10,
+		MaxArraySize:    10,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(55), result.GetInt64())
+}
+
+func TestLimitsGrowthNotExceeded(t *testing.T) {
+	// Replacing the values of keys and elements does not grow them
+	result, err := executeLimited(t, `
+a = [0, 0]
+h = {"a": 0, "b": 0}
+for i in range(0, 100)
+	a[0] = i
+	h["a"] = i
+end
+a.pop()
+a.append(1)
+(a[0] + h["a"], a[1])
+`, Limits{MaxArraySize: 2})
+	assert.Nil(t, err)
+	converted, fromError := NewVM(nil, nil, nil).FromValue(result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{int64(198), int64(1)}, converted)
+}
@@ -0,0 +1,172 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const requireSymbol = "require"
+
+type (
+	/*
+		configLoader executes a config file and the fragments it requires, every fragment is executed once
+	*/
+	configLoader struct {
+		plasma    *Plasma
+		root      string // Directory of the config, required scripts must be inside it
+		fragments map[string]*Value
+		loading   []string // Files being executed, the last one is the innermost require
+	}
+)
+
+/*
+LoadConfig executes the config script in a VM created with ProfilePure, so it has no access to the standard
+streams, and decodes its top level globals into target like Decode does. Globals starting with an underscore,
+functions, classes and built-ins are not collected. Scripts can call require with the path of another script,
+relative to the directory of the requiring one, it returns an object with the top level globals of that script,
+frozen so it can not be modified. Required scripts must be inside the directory of the config once their symbolic
+links are resolved, others fail with ErrConfigPath. Options like WithLimits apply to the VM, the profile is always ProfilePure.
+Errors decoding the globals are a *DecodeError locating the field, for example servers[2].port
+*/
+func LoadConfig(path string, target any, options ...Option) error {
+	options = append(options, WithProfile(ProfilePure))
+	loader := &configLoader{
+		plasma:    NewVM(nil, nil, nil, options...),
+		fragments: map[string]*Value{},
+	}
+	root, rootError := filepath.EvalSymlinks(filepath.Dir(path))
+	if rootError != nil {
+		return rootError
+	}
+	if loader.root, rootError = filepath.Abs(root); rootError != nil {
+		return rootError
+	}
+	resolved, resolveError := loader.resolve(path)
+	if resolveError != nil {
+		return resolveError
+	}
+	loader.loading = []string{resolved}
+	scope, loadError := loader.execute(resolved)
+	if loadError != nil {
+		return loadError
+	}
+	config := loader.exports(scope, false)
+	if decodeError := Decode(config, target); decodeError != nil {
+		return fmt.Errorf("%s: %w", path, decodeError)
+	}
+	return nil
+}
+
+/*
+execute runs the script in a new scope with a require bound to its directory
+*/
+func (loader *configLoader) execute(path string) (*Symbols, error) {
+	source, readError := os.ReadFile(path)
+	if readError != nil {
+		return nil, readError
+	}
+	bytecode, compileError := compiler.Compile(string(source))
+	if compileError != nil {
+		return nil, fmt.Errorf("%s: %w", path, compileError)
+	}
+	scope := loader.plasma.NewScope()
+	scope.Set(requireSymbol, loader.require(filepath.Dir(path)))
+	_, executeError := loader.plasma.ExecuteWithOptions(gocontext.Background(), bytecode, ExecuteOptions{Scope: scope})
+	if executeError != nil {
+		return nil, fmt.Errorf("%s: %w", path, executeError)
+	}
+	return scope, nil
+}
+
+/*
+require returns the require built-in of the scripts in the directory
+*/
+func (loader *configLoader) require(directory string) *Value {
+	plasma := loader.plasma
+	return plasma.NewBuiltInFunction(plasma.rootSymbols, func(argument ...*Value) (*Value, error) {
+		if len(argument) != 1 || argument[0].TypeId() != StringId {
+			return nil, fmt.Errorf("%w: require expects the path of the script", ErrTypeMismatch)
+		}
+		path := argument[0].String()
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(directory, path)
+		}
+		path, resolveError := loader.resolve(path)
+		if resolveError != nil {
+			return nil, resolveError
+		}
+		if fragment, found := loader.fragments[path]; found {
+			return fragment, nil
+		}
+		for index, loading := range loader.loading {
+			if loading == path {
+				cycle := append(append([]string{}, loader.loading[index:]...), path)
+				return nil, fmt.Errorf("require cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		loader.loading = append(loader.loading, path)
+		scope, executeError := loader.execute(path)
+		loader.loading = loader.loading[:len(loader.loading)-1]
+		if executeError != nil {
+			return nil, executeError
+		}
+		fragment := loader.exports(scope, true)
+		fragment.Freeze()
+		loader.fragments[path] = fragment
+		return fragment, nil
+	})
+}
+
+/*
+resolve returns the absolute path of the script with its symbolic links resolved, failing for scripts outside
+the directory of the config
+*/
+func (loader *configLoader) resolve(path string) (string, error) {
+	resolved, resolveError := filepath.EvalSymlinks(path)
+	if resolveError != nil {
+		return "", resolveError
+	}
+	if resolved, resolveError = filepath.Abs(resolved); resolveError != nil {
+		return "", resolveError
+	}
+	relative, relativeError := filepath.Rel(loader.root, resolved)
+	if relativeError != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is not inside %s", ErrConfigPath, path, loader.root)
+	}
+	return resolved, nil
+}
+
+/*
+exports creates an object with the public globals of the scope, in name order
+*/
+func (loader *configLoader) exports(scope *Symbols, callables bool) *Value {
+	plasma := loader.plasma
+	result := plasma.NewValue(nil, ValueId, plasma.value)
+	globals := scope.Values()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := globals[name]
+		if name == requireSymbol || strings.HasPrefix(name, "_") {
+			continue
+		}
+		switch value.TypeId() {
+		case BuiltInFunctionId, BuiltInClassId:
+			continue
+		case FunctionId, ClassId:
+			if !callables {
+				continue
+			}
+		}
+		result.vtable.values[name] = value
+	}
+	return result
+}
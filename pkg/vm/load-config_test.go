@@ -0,0 +1,142 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type (
+	testServerConfig struct {
+		Host string `plasma:"host"`
+		Port int    `plasma:"port"`
+	}
+	testAppConfig struct {
+		Name    string             `plasma:"name"`
+		Timeout time.Duration      `plasma:"timeout"`
+		Servers []testServerConfig `plasma:"servers"`
+		Tags    map[string]string  `plasma:"tags"`
+	}
+)
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(directory, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, []byte(source), 0o644))
+	}
+	return directory
+}
+
+func TestLoadConfig(t *testing.T) {
+	directory := writeConfigs(t, map[string]string{
+		"app.pl": `
+base = require("shared/base.pl")
+def _server(index)
+	return {"host": base.domain, "port": base.port + index}
+end
+name = "api"
+timeout = "1m30s"
+servers = [_server(0), _server(1)]
+tags = {"env": "prod"}
+`,
+		"shared/base.pl": `
+domain = "example.com"
+port = 8000
+ports = [port]
+`,
+	})
+	var config testAppConfig
+	assert.Nil(t, LoadConfig(filepath.Join(directory, "app.pl"), &config))
+	assert.Equal(t, testAppConfig{
+		Name:    "api",
+		Timeout: 90 * time.Second,
+		Servers: []testServerConfig{
+			{Host: "example.com", Port: 8000},
+			{Host: "example.com", Port: 8001},
+		},
+		Tags: map[string]string{"env": "prod"},
+	}, config)
+
+	// Every global is collected into maps
+	var globals map[string]any
+	assert.Nil(t, LoadConfig(filepath.Join(directory, "shared/base.pl"), &globals))
+	assert.Equal(t, map[string]any{"domain": "example.com", "port": int64(8000), "ports": []any{int64(8000)}}, globals)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	directory := writeConfigs(t, map[string]string{
+		"wrong.pl":  `servers = [{"host": "a", "port": 1}, {"host": "b", "port": "2"}]`,
+		"print.pl":  `println("hello")`,
+		"frozen.pl": "base = require(\"base.pl\")\nbase.ports.append(1)",
+		"base.pl":   `ports = [80]`,
+		"a.pl":      `b = require("b.pl")`,
+		"b.pl":      `a = require("a.pl")`,
+		"loop.pl":   "while true\n\tpass\nend",
+	})
+	var config testAppConfig
+	loadError := LoadConfig(filepath.Join(directory, "wrong.pl"), &config)
+	var decodeError *DecodeError
+	assert.True(t, errors.As(loadError, &decodeError))
+	assert.Equal(t, "servers[1].port", decodeError.Path)
+
+	assert.NotNil(t, LoadConfig(filepath.Join(directory, "print.pl"), &config))
+	loadError = LoadConfig(filepath.Join(directory, "frozen.pl"), &config)
+	assert.True(t, errors.Is(loadError, ErrImmutableValue))
+	loadError = LoadConfig(filepath.Join(directory, "a.pl"), &config)
+	assert.NotNil(t, loadError)
+	assert.Contains(t, loadError.Error(), "require cycle")
+	loadError = LoadConfig(filepath.Join(directory, "loop.pl"), &config, WithLimits(Limits{MaxInstructions: 1000}))
+	assert.True(t, errors.Is(loadError, ErrInstructionLimit))
+	assert.NotNil(t, LoadConfig(filepath.Join(directory, "missing.pl"), &config))
+}
+
+func TestLoadConfigOutsideDirectory(t *testing.T) {
+	outside := writeConfigs(t, map[string]string{"secret.pl": `token = "secret"`})
+	directory := writeConfigs(t, map[string]string{
+		"absolute.pl":  `secret = require("` + filepath.ToSlash(filepath.Join(outside, "secret.pl")) + `")`,
+		"parent.pl":    `secret = require("../` + filepath.Base(outside) + `/secret.pl")`,
+		"link.pl":      `secret = require("link/secret.pl")`,
+		"app.pl":       `port = require("nested/up.pl").port`,
+		"nested/up.pl": `port = require("../base.pl").port`,
+		"base.pl":      `port = 80`,
+	})
+	assert.Nil(t, os.Symlink(outside, filepath.Join(directory, "link")))
+	var config map[string]any
+	for _, name := range []string{"absolute.pl", "parent.pl", "link.pl"} {
+		loadError := LoadConfig(filepath.Join(directory, name), &config)
+		assert.ErrorIs(t, loadError, ErrConfigPath, name)
+	}
+	// Parent directories inside the directory of the config can be required
+	assert.Nil(t, LoadConfig(filepath.Join(directory, "app.pl"), &config))
+	assert.Equal(t, map[string]any{"port": int64(80)}, config)
+}
+
+func TestValue_Freeze(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, `
+class Box
+	def __init__()
+		self.items = [1, {"key": [2]}]
+	end
+end
+box = Box()
+`)
+	box, getError := p.RootSymbols().Get("box")
+	assert.Nil(t, getError)
+	box.Freeze()
+	for _, script := range []string{
+		`box.items = []`,
+		`box.items.append(3)`,
+		`box.items[1]["key"] = 3`,
+		`box.items[1]["key"].pop()`,
+	} {
+		_, runError := p.ExecuteContext(gocontext.Background(), compile(t, script))
+		assert.True(t, errors.Is(runError, ErrImmutableValue), script)
+	}
+}
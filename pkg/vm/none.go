@@ -30,5 +30,6 @@ func (plasma *Plasma) NewNone() *Value {
 			return plasma.NewString([]byte(result.String())), nil
 		},
 	))
+	result.frozen = true
 	return result
 }
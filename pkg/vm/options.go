@@ -0,0 +1,133 @@
+package vm
+
+import (
+	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
+)
+
+const (
+	// ProfileFull installs every built-in and exposes the methods of Go values converted with ToValue
+	ProfileFull Profile = iota
+	// ProfileIO installs every built-in but never exposes Go methods or nested Go functions through ToValue
+	ProfileIO
+	// ProfilePure is ProfileIO without the built-ins reading or writing the standard streams
+	ProfilePure
+)
+
+type (
+	/*
+		Profile selects the capabilities installed in a new VM
+	*/
+	Profile int
+	/*
+		Option configures a VM created with NewVM
+	*/
+	Option    func(options *vmOptions)
+	vmOptions struct {
+		profile Profile
+		allowed map[string]struct{}
+		denied  map[string]struct{}
+		limits  Limits
+	}
+)
+
+/*
+ioSymbols are the built-ins giving access to the standard streams of the VM
+*/
+var ioSymbols = []string{
+	special_symbols.Input,
+	special_symbols.ReadLine,
+	special_symbols.ReadAll,
+	special_symbols.ReadBytes,
+	special_symbols.Lines,
+	special_symbols.Print,
+	special_symbols.Println,
+	special_symbols.EPrint,
+	special_symbols.EPrintln,
+	special_symbols.Flush,
+}
+
+/*
+WithProfile selects the capability profile of the VM, the default is ProfileFull
+*/
+func WithProfile(profile Profile) Option {
+	return func(options *vmOptions) {
+		options.profile = profile
+	}
+}
+
+/*
+WithAllowedSymbols removes from the root symbols installed by NewVM every symbol not listed.
+Symbols loaded later with Load or LoadGo are not affected
+*/
+func WithAllowedSymbols(symbols ...string) Option {
+	return func(options *vmOptions) {
+		if options.allowed == nil {
+			options.allowed = map[string]struct{}{}
+		}
+		for _, symbol := range symbols {
+			options.allowed[symbol] = struct{}{}
+		}
+	}
+}
+
+/*
+WithDeniedSymbols removes the listed symbols from the root symbols installed by NewVM.
+Symbols loaded later with Load or LoadGo are not affected
+*/
+func WithDeniedSymbols(symbols ...string) Option {
+	return func(options *vmOptions) {
+		if options.denied == nil {
+			options.denied = map[string]struct{}{}
+		}
+		for _, symbol := range symbols {
+			options.denied[symbol] = struct{}{}
+		}
+	}
+}
+
+/*
+WithLimits sets the limits of the executions, calls and callbacks of the VM that do not set their own,
+like ExecuteWithOptions does
+*/
+func WithLimits(limits Limits) Option {
+	return func(options *vmOptions) {
+		options.limits = limits
+	}
+}
+
+/*
+Profile returns the capability profile the VM was created with
+*/
+func (plasma *Plasma) Profile() Profile {
+	return plasma.profile
+}
+
+/*
+restricted reports if ToValue must hide Go methods and nested Go functions from scripts
+*/
+func (plasma *Plasma) restricted() bool {
+	return plasma.profile != ProfileFull
+}
+
+func (plasma *Plasma) applyOptions(options *vmOptions) {
+	plasma.profile = options.profile
+	plasma.limits = options.limits
+	if options.profile == ProfilePure {
+		for _, symbol := range ioSymbols {
+			_ = plasma.rootSymbols.Del(symbol)
+		}
+	}
+	plasma.rootSymbols.mutex.Lock()
+	names := make([]string, 0, len(plasma.rootSymbols.values))
+	for name := range plasma.rootSymbols.values {
+		names = append(names, name)
+	}
+	plasma.rootSymbols.mutex.Unlock()
+	for _, name := range names {
+		_, allowed := options.allowed[name]
+		_, denied := options.denied[name]
+		if (options.allowed != nil && !allowed) || denied {
+			_ = plasma.rootSymbols.Del(name)
+		}
+	}
+}
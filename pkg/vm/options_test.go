@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type hostFile struct {
+	Name    string
+	written *bytes.Buffer
+}
+
+func (file *hostFile) Write(s string) int {
+	file.written.WriteString(s)
+	return len(s)
+}
+
+type hostConfig struct {
+	Name string
+	Open func(string) string
+}
+
+func runWith(p *Plasma, script string) (string, error) {
+	out := &bytes.Buffer{}
+	p.Stdout = out
+	_, errCh, _ := p.ExecuteString(script)
+	err := <-errCh
+	return out.String(), err
+}
+
+func TestProfiles(t *testing.T) {
+	full := NewVM(nil, nil, nil)
+	assert.Equal(t, ProfileFull, full.Profile())
+	output, err := runWith(full, "println(1)")
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n", output)
+
+	io := NewVM(nil, nil, nil, WithProfile(ProfileIO))
+	output, err = runWith(io, "println(1)")
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n", output)
+
+	pure := NewVM(nil, nil, nil, WithProfile(ProfilePure))
+	for _, symbol := range []string{"input", "print", "println"} {
+		_, getError := pure.RootSymbols().Get(symbol)
+		assert.NotNil(t, getError, symbol)
+	}
+	_, err = runWith(pure, "println(1)")
+	assert.NotNil(t, err)
+	rCh, errCh, _ := pure.ExecuteString("a = 0\nfor i in range(0, 4)\n\ta += i\nend\na")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int64(6), (<-rCh).GetInt64())
+}
+
+func TestAllowedAndDeniedSymbols(t *testing.T) {
+	p := NewVM(nil, nil, nil, WithAllowedSymbols("println", "Int"))
+	output, err := runWith(p, "println(Int(1.5))")
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n", output)
+	for _, symbol := range []string{"input", "print", "range", "String"} {
+		_, getError := p.RootSymbols().Get(symbol)
+		assert.NotNil(t, getError, symbol)
+	}
+	// Symbols loaded by the embedder are not filtered
+	p.Load("print", func(plasma *Plasma) *Value {
+		return plasma.None()
+	})
+	_, getError := p.RootSymbols().Get("print")
+	assert.Nil(t, getError)
+
+	p = NewVM(nil, nil, nil, WithDeniedSymbols("input"), WithProfile(ProfileIO))
+	_, getError = p.RootSymbols().Get("input")
+	assert.NotNil(t, getError)
+	_, getError = p.RootSymbols().Get("print")
+	assert.Nil(t, getError)
+}
+
+func TestRestrictedToValue(t *testing.T) {
+	for _, profile := range []Profile{ProfileIO, ProfilePure} {
+		p := NewVM(nil, nil, nil, WithProfile(profile))
+		file := &hostFile{Name: "secrets.txt", written: &bytes.Buffer{}}
+		assert.Nil(t, p.LoadGo("file", file))
+		_, err := runWith(p, "file.Write('leak')")
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, file.written.Len())
+		rCh, errCh, _ := p.ExecuteString("file.Name")
+		assert.Nil(t, <-errCh)
+		assert.Equal(t, "secrets.txt", (<-rCh).String())
+		// Functions nested in other values are rejected
+		err = p.LoadGo("config", hostConfig{Name: "config", Open: func(s string) string { return s }})
+		assert.True(t, errors.Is(err, ErrRestricted))
+		err = p.LoadGo("functions", []any{func() {}})
+		assert.True(t, errors.Is(err, ErrRestricted))
+		// Functions passed directly are intended by the embedder
+		assert.Nil(t, p.LoadGo("double", func(i int) int { return i * 2 }))
+		rCh, errCh, _ = p.ExecuteString("double(2)")
+		assert.Nil(t, <-errCh)
+		assert.Equal(t, int64(4), (<-rCh).GetInt64())
+	}
+	p := NewVM(nil, nil, nil)
+	file := &hostFile{Name: "secrets.txt", written: &bytes.Buffer{}}
+	assert.Nil(t, p.LoadGo("file", file))
+	_, err := runWith(p, "file.Write('written')")
+	assert.Nil(t, err)
+	assert.Equal(t, "written", file.written.String())
+}
@@ -0,0 +1,267 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	/*
+		goStruct backs the values created by ToValue from pointers to Go structs. Field reads and writes
+		are made directly on the Go memory, symbols not naming a field are stored in the virtual table
+	*/
+	goStruct struct {
+		plasma  *Plasma
+		symbols *Symbols
+		pointer reflect.Value
+		fields  map[string]int
+		mutex   sync.Mutex
+		nested  map[int]*Value
+	}
+)
+
+var (
+	structFieldsCache sync.Map
+	decodeFieldsCache sync.Map
+)
+
+/*
+fieldName returns the name used by plasma for the struct field, the first of the tags present overrides it
+and "-" hides it. Unexported fields are never visible
+*/
+func fieldName(field reflect.StructField, tags ...string) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	var tag string
+	for _, key := range tags {
+		if value, found := field.Tag.Lookup(key); found {
+			tag = value
+			break
+		}
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	}
+	return name, true
+}
+
+/*
+structFields maps the plasma names of the visible fields of the struct type to their index, names come from
+the "plasma" tag
+*/
+func structFields(structType reflect.Type) map[string]int {
+	return taggedFields(&structFieldsCache, structType, "plasma")
+}
+
+/*
+decodeFields is structFields for Decode, fields without a "plasma" tag use their "json" tag
+*/
+func decodeFields(structType reflect.Type) map[string]int {
+	return taggedFields(&decodeFieldsCache, structType, "plasma", "json")
+}
+
+func taggedFields(cache *sync.Map, structType reflect.Type, tags ...string) map[string]int {
+	if cached, found := cache.Load(structType); found {
+		return cached.(map[string]int)
+	}
+	fields := make(map[string]int, structType.NumField())
+	for index := 0; index < structType.NumField(); index++ {
+		name, visible := fieldName(structType.Field(index), tags...)
+		if visible {
+			fields[name] = index
+		}
+	}
+	result, _ := cache.LoadOrStore(structType, fields)
+	return result.(map[string]int)
+}
+
+/*
+structProxy creates a Value reading and writing the fields of the struct the pointer references
+*/
+func (plasma *Plasma) structProxy(symbols *Symbols, pointer reflect.Value) *Value {
+	obj := plasma.NewValue(symbols, ValueId, plasma.ValueClass())
+	obj.proxy = &goStruct{
+		plasma:  plasma,
+		symbols: symbols,
+		pointer: pointer,
+		fields:  structFields(pointer.Type().Elem()),
+	}
+	return obj
+}
+
+/*
+get converts the current value of the field, found is false when the symbol does not name a field.
+Struct fields are returned as proxies of the field memory, other values are copies
+*/
+func (proxy *goStruct) get(symbol string) (result *Value, found bool, err error) {
+	index, found := proxy.fields[symbol]
+	if !found {
+		return nil, false, nil
+	}
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	field := proxy.pointer.Elem().Field(index)
+	if field.Kind() == reflect.Struct {
+		if nested, cached := proxy.nested[index]; cached {
+			return nested, true, nil
+		}
+		if proxy.nested == nil {
+			proxy.nested = map[int]*Value{}
+		}
+		nested, err := proxy.plasma.toValue(proxy.symbols, field.Addr().Interface(), true)
+		if err != nil {
+			return nil, true, fmt.Errorf("field %s: %w", symbol, err)
+		}
+		proxy.nested[index] = nested
+		return nested, true, nil
+	}
+	result, err = proxy.plasma.toValue(proxy.symbols, field.Interface(), true)
+	if err != nil {
+		return nil, true, fmt.Errorf("field %s: %w", symbol, err)
+	}
+	return result, true, nil
+}
+
+/*
+set converts the value to the type of the field and stores it in the Go memory
+*/
+func (proxy *goStruct) set(symbol string, value *Value) (found bool, err error) {
+	index, found := proxy.fields[symbol]
+	if !found {
+		return false, nil
+	}
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	field := proxy.pointer.Elem().Field(index)
+	converted, err := proxy.plasma.goValue(value, field.Type())
+	if err != nil {
+		return true, fmt.Errorf("field %s: %w", symbol, err)
+	}
+	// Cached proxies of struct fields reference the field memory, they see the new value
+	field.Set(converted)
+	return true, nil
+}
+
+/*
+goValue converts the plasma value to the Go type, failing when the kinds do not match
+*/
+func (plasma *Plasma) goValue(value *Value, t reflect.Type) (reflect.Value, error) {
+	result := reflect.New(t).Elem()
+	typeId := value.TypeId()
+	if typeId == NoneId {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+			return result, nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if typeId == BoolId {
+			result.SetBool(value.GetBool())
+			return result, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if typeId == IntId {
+			i := value.GetInt64()
+			if result.OverflowInt(i) {
+				return reflect.Value{}, fmt.Errorf("%w: %d overflows %s", ErrFieldType, i, t)
+			}
+			result.SetInt(i)
+			return result, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if typeId == IntId {
+			i := value.GetInt64()
+			if i < 0 || result.OverflowUint(uint64(i)) {
+				return reflect.Value{}, fmt.Errorf("%w: %d overflows %s", ErrFieldType, i, t)
+			}
+			result.SetUint(uint64(i))
+			return result, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch typeId {
+		case IntId:
+			result.SetFloat(float64(value.GetInt64()))
+			return result, nil
+		case FloatId:
+			result.SetFloat(value.GetFloat64())
+			return result, nil
+		}
+	case reflect.String:
+		if typeId == StringId {
+			result.SetString(value.String())
+			return result, nil
+		}
+	case reflect.Pointer:
+		if value.proxy != nil && value.proxy.pointer.Type() == t {
+			return value.proxy.pointer, nil
+		}
+		if t.Elem().Kind() != reflect.Struct {
+			elem, err := plasma.goValue(value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Set(reflect.New(t.Elem()))
+			result.Elem().Set(elem)
+			return result, nil
+		}
+		fallthrough
+	default:
+		if value.proxy != nil && value.proxy.pointer.Type().Elem() == t {
+			result.Set(value.proxy.pointer.Elem())
+			return result, nil
+		}
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && (typeId == BytesId || typeId == StringId) {
+			result.SetBytes(append([]byte(nil), value.GetBytes()...))
+			return result, nil
+		}
+		if t.Kind() == reflect.Slice && (typeId == ArrayId || typeId == TupleId) {
+			values := value.GetValues()
+			result.Set(reflect.MakeSlice(t, len(values), len(values)))
+			for index, element := range values {
+				converted, err := plasma.goValue(element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("index %d: %w", index, err)
+				}
+				result.Index(index).Set(converted)
+			}
+			return result, nil
+		}
+		if t.Kind() == reflect.Map && typeId == HashId {
+			hash := value.GetHash()
+			hash.mutex.Lock()
+			defer hash.mutex.Unlock()
+			result.Set(reflect.MakeMapWithSize(t, len(hash.internalMap)))
+			for _, keyValue := range hash.internalMap {
+				key, err := plasma.goValue(keyValue.Key, t.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s: %w", keyValue.Key.String(), err)
+				}
+				element, err := plasma.goValue(keyValue.Value, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s: %w", keyValue.Key.String(), err)
+				}
+				result.SetMapIndex(key, element)
+			}
+			return result, nil
+		}
+		asGoValue, err := plasma.FromValue(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if asGoValue != nil {
+			converted, convertErr := reflectConvert(reflect.ValueOf(asGoValue), t)
+			if convertErr == nil {
+				return converted, nil
+			}
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("%w: expected %s, got %s", ErrFieldType, t, typeId)
+}
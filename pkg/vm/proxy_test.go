@@ -0,0 +1,135 @@
+package vm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type (
+	proxyAddress struct {
+		City string
+		Zip  uint16
+	}
+	proxyUser struct {
+		Name     string
+		Age      int    `plasma:"age"`
+		Password string `plasma:"-"`
+		Score    float64
+		Nickname *string
+		Address  proxyAddress
+		Next     *proxyUser
+		Tags     []string
+		private  int
+	}
+)
+
+func (user *proxyUser) Birthday() int {
+	user.Age++
+	return user.Age
+}
+
+func (user proxyUser) Greeting() string {
+	return "Hello " + user.Name
+}
+
+func loadUser(t *testing.T, user *proxyUser) *Plasma {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("user", user))
+	return p
+}
+
+func TestStructProxyWriteThrough(t *testing.T) {
+	user := &proxyUser{Name: "alice", Age: 30, Address: proxyAddress{City: "Paris"}}
+	p := loadUser(t, user)
+	rCh, errCh, _ := p.ExecuteString(`
+user.Name = "bob"
+user.age = 41
+user.Score = 3
+user.Address.City = "Lima"
+user.Address.Zip = 15001
+user.Nickname = "b"
+user.Tags = ("a", "b")
+user.Extra = 1
+user.Birthday()
+user.Greeting()
+`)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, "Hello bob", (<-rCh).String())
+	assert.Equal(t, "bob", user.Name)
+	assert.Equal(t, 42, user.Age)
+	assert.Equal(t, 3.0, user.Score)
+	assert.Equal(t, proxyAddress{City: "Lima", Zip: 15001}, user.Address)
+	assert.Equal(t, "b", *user.Nickname)
+	assert.Equal(t, []string{"a", "b"}, user.Tags)
+	// Go side changes are visible to scripts
+	user.Name = "carol"
+	user.Address.City = "Quito"
+	rCh, errCh, _ = p.ExecuteString("(user.Name, user.Address.City, user.Extra)")
+	assert.Nil(t, <-errCh)
+	values := (<-rCh).GetValues()
+	assert.Equal(t, "carol", values[0].String())
+	assert.Equal(t, "Quito", values[1].String())
+	assert.Equal(t, int64(1), values[2].GetInt64())
+}
+
+func TestStructProxyTags(t *testing.T) {
+	user := &proxyUser{Name: "alice", Age: 30, Password: "secret", private: 1}
+	p := loadUser(t, user)
+	for _, script := range []string{"user.Age", "user.Password", "user.private"} {
+		_, errCh, _ := p.ExecuteString(script)
+		assert.NotNil(t, <-errCh, script)
+	}
+	rCh, errCh, _ := p.ExecuteString("user.age")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int64(30), (<-rCh).GetInt64())
+	// Copies of structs use the same names
+	copied, err := p.ToValue(nil, *user)
+	assert.Nil(t, err)
+	_, getError := copied.Get("Password")
+	assert.NotNil(t, getError)
+	age, getError := copied.Get("age")
+	assert.Nil(t, getError)
+	assert.Equal(t, int64(30), age.GetInt64())
+}
+
+func TestStructProxyInvalidAssignments(t *testing.T) {
+	user := &proxyUser{Name: "alice", Age: 30}
+	p := loadUser(t, user)
+	for _, script := range []string{
+		"user.Name = 1",
+		"user.age = 'old'",
+		"user.age = 1.5",
+		"user.Address.Zip = -1",
+		"user.Address.Zip = 100000",
+		"user.Address = 1",
+		"delete user.Name",
+	} {
+		_, errCh, _ := p.ExecuteString(script)
+		err := <-errCh
+		assert.NotNil(t, err, script)
+	}
+	_, errCh, _ := p.ExecuteString("user.age = 'old'")
+	assert.True(t, errors.Is(<-errCh, ErrFieldType))
+	assert.Equal(t, "alice", user.Name)
+	assert.Equal(t, 30, user.Age)
+}
+
+func TestStructProxyIdentity(t *testing.T) {
+	user := &proxyUser{Name: "alice", Next: &proxyUser{Name: "bob"}}
+	p := loadUser(t, user)
+	var received *proxyUser
+	assert.Nil(t, p.LoadGo("same", func(other *proxyUser) bool {
+		received = other
+		return other == user
+	}))
+	rCh, errCh, _ := p.ExecuteString("user.Next.Name = 'dave'\nuser.Next = user\nsame(user.Next)")
+	assert.Nil(t, <-errCh)
+	assert.True(t, (<-rCh).Bool())
+	assert.Same(t, user, received)
+	assert.Same(t, user, user.Next)
+	rCh, errCh, _ = p.ExecuteString("user.Next = none\nuser.Next")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, NoneId, (<-rCh).TypeId())
+	assert.Nil(t, user.Next)
+}
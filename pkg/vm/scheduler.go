@@ -0,0 +1,333 @@
+package vm
+
+import (
+	gocontext "context"
+	"sync"
+)
+
+type (
+	/*
+		Pending is the result of a built-in that completes later. Built-ins return it as their error to park
+		the execution calling them without blocking its goroutine, the host completes it with Complete once the
+		operation finishes. Only executions created with NewExecution can be parked, other executions fail
+		with an error wrapping ErrSuspended
+	*/
+	Pending struct {
+		mutex     sync.Mutex
+		completed bool
+		result    *Value
+		err       error
+		done      chan struct{}
+		callbacks []func()
+	}
+	/*
+		Scheduler runs executions over a fixed number of worker goroutines. Executions parked by a Pending
+		release their worker and are queued again when the Pending completes
+	*/
+	Scheduler struct {
+		mutex    sync.Mutex
+		ready    *sync.Cond
+		queue    []*Task
+		parked   map[*Task]struct{}
+		watchers map[<-chan struct{}]*contextWatcher // Parked tasks by the Done channel of their context.Context
+		closed   bool
+		workers  sync.WaitGroup
+	}
+	/*
+		contextWatcher fails the parked tasks sharing a context.Context once it is cancelled, a single goroutine
+		watches every task of the context
+	*/
+	contextWatcher struct {
+		tasks map[*Task]struct{}
+		stop  chan struct{}
+	}
+	/*
+		Task is an execution submitted to a Scheduler
+	*/
+	Task struct {
+		execution *Execution
+		goContext gocontext.Context
+		result    *Value
+		err       error // Error of the completed Pending before resuming, result of the task once done
+		done      chan struct{}
+	}
+)
+
+/*
+NewPending creates a Pending not completed yet
+*/
+func NewPending() *Pending {
+	return &Pending{done: make(chan struct{})}
+}
+
+func (pending *Pending) Error() string {
+	return "pending result"
+}
+
+func (pending *Pending) Unwrap() error {
+	return ErrSuspended
+}
+
+/*
+Complete sets the result of the built-in that returned the Pending, a non nil error fails the execution.
+Only the first call has effect
+*/
+func (pending *Pending) Complete(result *Value, err error) {
+	pending.mutex.Lock()
+	if pending.completed {
+		pending.mutex.Unlock()
+		return
+	}
+	pending.completed = true
+	pending.result, pending.err = result, err
+	callbacks := pending.callbacks
+	pending.callbacks = nil
+	close(pending.done)
+	pending.mutex.Unlock()
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+/*
+Done is closed when the Pending completes
+*/
+func (pending *Pending) Done() <-chan struct{} {
+	return pending.done
+}
+
+/*
+Result returns the values passed to Complete
+*/
+func (pending *Pending) Result() (*Value, error) {
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+	return pending.result, pending.err
+}
+
+/*
+onComplete calls the callback once the Pending completes, immediately when it already did
+*/
+func (pending *Pending) onComplete(callback func()) {
+	pending.mutex.Lock()
+	if !pending.completed {
+		pending.callbacks = append(pending.callbacks, callback)
+		pending.mutex.Unlock()
+		return
+	}
+	pending.mutex.Unlock()
+	callback()
+}
+
+/*
+NewScheduler starts a scheduler with the number of workers, at least one worker is started
+*/
+func NewScheduler(workers int) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	scheduler := &Scheduler{
+		parked:   map[*Task]struct{}{},
+		watchers: map[<-chan struct{}]*contextWatcher{},
+	}
+	scheduler.ready = sync.NewCond(&scheduler.mutex)
+	scheduler.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go scheduler.work()
+	}
+	return scheduler
+}
+
+/*
+Submit queues the execution, it runs with the context.Context once a worker is free. Cancellation is observed
+while the execution runs, tasks parked by a Pending fail with the error of the cancellation right away. Their
+executions stay suspended and can be resumed with Resume
+*/
+func (scheduler *Scheduler) Submit(goContext gocontext.Context, execution *Execution) (*Task, error) {
+	task := &Task{
+		execution: execution,
+		goContext: goContext,
+		done:      make(chan struct{}),
+	}
+	if !scheduler.enqueue(task) {
+		return nil, ErrSchedulerClosed
+	}
+	return task, nil
+}
+
+/*
+Close stops accepting executions and waits until the workers finished the queued ones. Tasks still parked
+fail with ErrSchedulerClosed, their executions stay suspended and can be resumed with Resume
+*/
+func (scheduler *Scheduler) Close() {
+	scheduler.mutex.Lock()
+	scheduler.closed = true
+	parked := scheduler.parked
+	scheduler.parked = map[*Task]struct{}{}
+	for _, watcher := range scheduler.watchers {
+		close(watcher.stop)
+	}
+	scheduler.watchers = map[<-chan struct{}]*contextWatcher{}
+	scheduler.ready.Broadcast()
+	scheduler.mutex.Unlock()
+	for task := range parked {
+		task.finish(nil, ErrSchedulerClosed)
+	}
+	scheduler.workers.Wait()
+}
+
+func (scheduler *Scheduler) enqueue(task *Task) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.closed {
+		return false
+	}
+	scheduler.queue = append(scheduler.queue, task)
+	scheduler.ready.Signal()
+	return true
+}
+
+/*
+next returns the next queued task, nil once the scheduler is closed and the queue is empty
+*/
+func (scheduler *Scheduler) next() *Task {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	for len(scheduler.queue) == 0 {
+		if scheduler.closed {
+			return nil
+		}
+		scheduler.ready.Wait()
+	}
+	task := scheduler.queue[0]
+	scheduler.queue[0] = nil
+	scheduler.queue = scheduler.queue[1:]
+	return task
+}
+
+func (scheduler *Scheduler) work() {
+	defer scheduler.workers.Done()
+	for task := scheduler.next(); task != nil; task = scheduler.next() {
+		scheduler.run(task)
+	}
+}
+
+func (scheduler *Scheduler) run(task *Task) {
+	result, runError := task.execution.resume(task.goContext, task.result, task.err)
+	pending := task.execution.Pending()
+	if runError != ErrSuspended || pending == nil {
+		task.finish(result, runError)
+		return
+	}
+	if !scheduler.park(task) {
+		task.finish(nil, ErrSchedulerClosed)
+		return
+	}
+	pending.onComplete(func() {
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+		if !scheduler.unpark(task) {
+			// Finished by Close or by the cancellation of its context.Context
+			return
+		}
+		task.result, task.err = pending.Result()
+		scheduler.queue = append(scheduler.queue, task)
+		scheduler.ready.Signal()
+	})
+}
+
+/*
+park registers the task waiting for its Pending, so Close and the cancellation of its context.Context finish it.
+It returns false once the scheduler is closed
+*/
+func (scheduler *Scheduler) park(task *Task) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.closed {
+		return false
+	}
+	scheduler.parked[task] = struct{}{}
+	done := task.goContext.Done()
+	if done == nil {
+		return true
+	}
+	watcher, found := scheduler.watchers[done]
+	if !found {
+		watcher = &contextWatcher{tasks: map[*Task]struct{}{}, stop: make(chan struct{})}
+		scheduler.watchers[done] = watcher
+		go scheduler.watch(task.goContext, watcher)
+	}
+	watcher.tasks[task] = struct{}{}
+	return true
+}
+
+/*
+unpark removes the parked task, it reports false when the task is not parked anymore. The mutex of the
+scheduler must be held
+*/
+func (scheduler *Scheduler) unpark(task *Task) bool {
+	if _, parked := scheduler.parked[task]; !parked {
+		return false
+	}
+	delete(scheduler.parked, task)
+	done := task.goContext.Done()
+	if watcher, found := scheduler.watchers[done]; found {
+		delete(watcher.tasks, task)
+		if len(watcher.tasks) == 0 {
+			close(watcher.stop)
+			delete(scheduler.watchers, done)
+		}
+	}
+	return true
+}
+
+/*
+watch fails the tasks of the watcher once the context.Context is cancelled, it returns when they all left
+*/
+func (scheduler *Scheduler) watch(goContext gocontext.Context, watcher *contextWatcher) {
+	select {
+	case <-watcher.stop:
+		return
+	case <-goContext.Done():
+	}
+	scheduler.mutex.Lock()
+	tasks := make([]*Task, 0, len(watcher.tasks))
+	for task := range watcher.tasks {
+		// Close may have finished them already
+		if scheduler.unpark(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	scheduler.mutex.Unlock()
+	for _, task := range tasks {
+		task.finish(nil, cancellationError(goContext))
+	}
+}
+
+func (task *Task) finish(result *Value, err error) {
+	task.result, task.err = result, err
+	close(task.done)
+}
+
+/*
+Execution returns the execution of the task
+*/
+func (task *Task) Execution() *Execution {
+	return task.execution
+}
+
+/*
+Done is closed when the task finishes, executions suspended by Suspend or by a built-in returning ErrSuspended
+finish the task with ErrSuspended
+*/
+func (task *Task) Done() <-chan struct{} {
+	return task.done
+}
+
+/*
+Wait waits until the task finishes and returns the result of its execution
+*/
+func (task *Task) Wait() (*Value, error) {
+	<-task.done
+	return task.result, task.err
+}
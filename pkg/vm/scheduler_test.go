@@ -0,0 +1,135 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Pending(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	var (
+		mutex    sync.Mutex
+		pendings []*Pending
+	)
+	assert.Nil(t, p.LoadGo("fetch", func() (any, error) {
+		pending := NewPending()
+		mutex.Lock()
+		pendings = append(pendings, pending)
+		mutex.Unlock()
+		return nil, pending
+	}))
+	bytecode := compile(t, `
+value = fetch()
+value * 2
+`)
+	scheduler := NewScheduler(4)
+	defer scheduler.Close()
+	goroutines := runtime.NumGoroutine()
+	const scripts = 1000
+	tasks := make([]*Task, 0, scripts)
+	for i := 0; i < scripts; i++ {
+		// Every script assigns value, each one needs its own globals
+		execution := p.NewExecution(bytecode, ExecuteOptions{Scope: p.NewScope()})
+		task, submitError := scheduler.Submit(gocontext.Background(), execution)
+		assert.Nil(t, submitError)
+		tasks = append(tasks, task)
+	}
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(pendings) == scripts
+	}, 10*time.Second, time.Millisecond)
+	// Parked scripts do not hold goroutines
+	assert.Less(t, runtime.NumGoroutine(), goroutines+scripts/10)
+	for index, pending := range pendings {
+		if index == 0 {
+			pending.Complete(nil, fmt.Errorf("connection refused"))
+			continue
+		}
+		pending.Complete(p.NewInt(int64(index)), nil)
+	}
+	sum := int64(0)
+	failed := 0
+	for _, task := range tasks {
+		result, waitError := task.Wait()
+		if waitError != nil {
+			assert.Contains(t, waitError.Error(), "connection refused")
+			failed++
+			continue
+		}
+		sum += result.GetInt64()
+	}
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, int64(scripts*(scripts-1)), sum)
+}
+
+func TestScheduler_Close(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	pending := NewPending()
+	assert.Nil(t, p.LoadGo("fetch", func() (any, error) {
+		return nil, pending
+	}))
+	scheduler := NewScheduler(1)
+	task, submitError := scheduler.Submit(gocontext.Background(), p.NewExecution(compile(t, `fetch()`), ExecuteOptions{}))
+	assert.Nil(t, submitError)
+	assert.Eventually(t, task.Execution().Suspended, 10*time.Second, time.Millisecond)
+	scheduler.Close()
+	_, submitError = scheduler.Submit(gocontext.Background(), p.NewExecution(compile(t, `1`), ExecuteOptions{}))
+	assert.Equal(t, ErrSchedulerClosed, submitError)
+
+	// Parked tasks finish with Close even when their Pending never completes
+	select {
+	case <-task.Done():
+	default:
+		t.Fatal("parked task not finished by Close")
+	}
+	_, waitError := task.Wait()
+	assert.Equal(t, ErrSchedulerClosed, waitError)
+	pending.Complete(p.NewString([]byte("late")), nil)
+	// The execution can still be resumed by the host
+	assert.Equal(t, pending, task.Execution().Pending())
+	result, resumeError := task.Execution().Resume(gocontext.Background(), p.NewString([]byte("late")))
+	assert.Nil(t, resumeError)
+	assert.Equal(t, "late", result.String())
+
+	// Executions not created with NewExecution can not be parked
+	_, runError := p.ExecuteContext(gocontext.Background(), compile(t, `fetch()`))
+	assert.True(t, errors.Is(runError, ErrSuspended))
+}
+
+func TestScheduler_CancelParked(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	pending := NewPending()
+	assert.Nil(t, p.LoadGo("fetch", func() (any, error) {
+		return nil, pending
+	}))
+	scheduler := NewScheduler(1)
+	defer scheduler.Close()
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	tasks := make([]*Task, 0, 2)
+	for i := 0; i < 2; i++ {
+		task, submitError := scheduler.Submit(ctx, p.NewExecution(compile(t, `fetch()`), ExecuteOptions{}))
+		assert.Nil(t, submitError)
+		assert.Eventually(t, task.Execution().Suspended, 10*time.Second, time.Millisecond)
+		tasks = append(tasks, task)
+	}
+	// The tasks are parked, only the cancellation finishes them
+	cancel()
+	for _, task := range tasks {
+		_, waitError := task.Wait()
+		assert.Equal(t, ErrCancelled, waitError)
+	}
+	// Completing the Pending afterwards does not queue them again
+	pending.Complete(p.NewInt(1), nil)
+	task, submitError := scheduler.Submit(gocontext.Background(), p.NewExecution(compile(t, `2`), ExecuteOptions{}))
+	assert.Nil(t, submitError)
+	result, waitError := task.Wait()
+	assert.Nil(t, waitError)
+	assert.Equal(t, int64(2), result.GetInt64())
+}
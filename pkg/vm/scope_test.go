@@ -0,0 +1,107 @@
+package vm
+
+import (
+	gocontext "context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestPlasma_ExecuteIn(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("offset", 100))
+	bytecode := compile(t, `
+total = offset
+def add(n)
+	return total + n
+end
+for i in range(0, 10)
+	total = add(i)
+end
+println = total
+total
+`)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scope := p.NewScope()
+			rCh, errCh, _ := p.ExecuteIn(scope, bytecode)
+			assert.Nil(t, <-errCh)
+			assert.Equal(t, int64(145), (<-rCh).GetInt64())
+			total, getError := scope.Get("total")
+			assert.Nil(t, getError)
+			assert.Equal(t, int64(145), total.GetInt64())
+		}()
+	}
+	wg.Wait()
+	// Globals and shadowed built-ins never reach the root symbols
+	_, getError := p.RootSymbols().Get("total")
+	assert.NotNil(t, getError)
+	println, _ := p.RootSymbols().Get("println")
+	assert.Equal(t, BuiltInFunctionId, println.TypeId())
+}
+
+func TestScopeFunctionsKeepTheirGlobals(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	scopes := make([]*Symbols, 2)
+	for index := range scopes {
+		scopes[index] = p.NewScope()
+		_, err := p.ExecuteWithOptions(
+			gocontext.Background(),
+			compile(t, fmt.Sprintf("name = 'scope-%d'\ndef get_name()\n\treturn name\nend", index)),
+			ExecuteOptions{Scope: scopes[index]},
+		)
+		assert.Nil(t, err)
+	}
+	for index, scope := range scopes {
+		getName, getError := scope.Get("get_name")
+		assert.Nil(t, getError)
+		name, callError := Call[string](p, getName)
+		assert.Nil(t, callError)
+		assert.Equal(t, fmt.Sprintf("scope-%d", index), name)
+	}
+	// Deleting a built-in from a scope is not possible
+	_, err := p.ExecuteWithOptions(gocontext.Background(), compile(t, "delete println"), ExecuteOptions{Scope: p.NewScope()})
+	assert.NotNil(t, err)
+	_, getError := p.RootSymbols().Get("println")
+	assert.Nil(t, getError)
+}
+
+func TestScopeBuiltInsReadOnly(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("settings", map[string]any{"mode": "root"}))
+	assert.Nil(t, p.LoadGo("offset", 100))
+	for _, script := range []string{
+		"println.leak = 'from A'",
+		"Value.leak = 'A'",
+		"delete range.__string__",
+		"settings.leak = 'A'",
+		"settings['mode'] = 'A'",
+		"offset.leak = 'A'",
+	} {
+		_, err := p.ExecuteWithOptions(gocontext.Background(), compile(t, script), ExecuteOptions{Scope: p.NewScope()})
+		assert.NotNil(t, err, script)
+		assert.ErrorIs(t, err, ErrImmutableValue, script)
+	}
+	result, err := p.ExecuteWithOptions(
+		gocontext.Background(),
+		compile(t, "(settings['mode'], offset + 1)"),
+		ExecuteOptions{Scope: p.NewScope()},
+	)
+	assert.Nil(t, err)
+	values, fromError := p.FromValue(result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{"root", int64(101)}, values)
+	// Equal literals are not bindings
+	_, err = p.ExecuteWithOptions(gocontext.Background(), compile(t, "a = 100\na.x = 1"), ExecuteOptions{Scope: p.NewScope()})
+	assert.Nil(t, err)
+	for _, name := range []string{"println", "Value", "range"} {
+		value, getError := p.RootSymbols().Get(name)
+		assert.Nil(t, getError)
+		_, getError = value.Get("leak")
+		assert.NotNil(t, getError, name)
+	}
+}
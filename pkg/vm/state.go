@@ -0,0 +1,578 @@
+package vm
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	stateVersion = 1
+	// rootSymbolsReference references the root symbols of the VM, other tables start after it
+	rootSymbolsReference = 1
+)
+
+type (
+	/*
+		savedState is the encoded form of the globals. Values and symbol tables reference each other by
+		their index plus one, zero is nil, so shared values and cycles are stored once
+	*/
+	savedState struct {
+		Version int
+		Format  int64 // Format version of the bytecode of functions and classes
+		Globals map[string]int
+		Values  []savedValue
+		Symbols []savedSymbols
+	}
+	savedValue struct {
+		Type       TypeId
+		Builtin    string // Name of the root symbol holding the Go bound value
+		Bytes      []byte
+		Int        int64
+		Float      float64
+		Values     []int // Elements of arrays and tuples, bases of classes
+		HashKeys   []string
+		HashValues [][2]int
+		Class      int
+		Symbols    int
+		Frozen     bool
+		Name       string // Name of functions and built-in methods
+		Receiver   int    // Value the built-in method was created for
+		Arguments  []string
+		Bytecode   []byte
+		Prepared   bool
+	}
+	savedSymbols struct {
+		Parent int
+		Call   int // Symbols of the caller, only set while a call runs
+		Values map[string]int
+	}
+	stateDecoder struct {
+		plasma  *Plasma
+		values  []*Value
+		symbols []*Symbols
+	}
+	stateEncoder struct {
+		plasma   *Plasma
+		bindings map[*Value]string
+		state    *savedState
+		values   map[*Value]int
+		symbols  map[*Symbols]int
+	}
+)
+
+/*
+SaveGlobals writes the globals of the VM and every value reachable from them, globals still holding the Go
+bound value NewVM, Load or LoadGo installed in them are not written. Values shared between globals and
+cycles are preserved. Script functions are saved with their bytecode and the symbols they captured, and
+classes with their bytecode and bases. Go bound values are saved as the name of their global and built-in
+methods as their receiver and name, other built-ins can not be saved and fail with ErrNotSerializable
+*/
+func (plasma *Plasma) SaveGlobals(w io.Writer) error {
+	encoder := plasma.newStateEncoder()
+	if encodeError := encoder.globals(); encodeError != nil {
+		return encodeError
+	}
+	return gob.NewEncoder(w).Encode(encoder.state)
+}
+
+func (plasma *Plasma) newStateEncoder() *stateEncoder {
+	encoder := &stateEncoder{
+		plasma:   plasma,
+		bindings: map[*Value]string{},
+		state: &savedState{
+			Version: stateVersion,
+			Format:  opcodes.FormatVersion,
+			Globals: map[string]int{},
+		},
+		values:  map[*Value]int{},
+		symbols: map[*Symbols]int{plasma.rootSymbols: rootSymbolsReference},
+	}
+	if fork := plasma.rootSymbols.fork; fork != nil {
+		// Values the fork did not copy yet still use the root symbols of its templates
+		fork.mutex.Lock()
+		for template := range fork.templates {
+			encoder.symbols[template] = rootSymbolsReference
+		}
+		fork.mutex.Unlock()
+	}
+	return encoder
+}
+
+/*
+globals encodes the globals, the Go bound values are registered first so every reference to them is a name
+*/
+func (encoder *stateEncoder) globals() error {
+	globals := encoder.plasma.rootSymbols.Values()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := globals[name]
+		if binding, found := encoder.plasma.bindings.Load(value); found && binding.(string) == name {
+			encoder.bindings[value] = name
+		}
+	}
+	for _, name := range names {
+		value := globals[name]
+		if encoder.bindings[value] == name {
+			continue
+		}
+		reference, encodeError := encoder.value(value)
+		if encodeError != nil {
+			return fmt.Errorf("global %s: %w", name, encodeError)
+		}
+		encoder.state.Globals[name] = reference
+	}
+	return nil
+}
+
+func (encoder *stateEncoder) value(value *Value) (int, error) {
+	if value == nil {
+		return 0, nil
+	}
+	if reference, found := encoder.values[value]; found {
+		return reference, nil
+	}
+	if _, bound := encoder.bindings[value]; !bound {
+		if receiver, name, isMethod := value.receiver(); isMethod {
+			return encoder.method(value, receiver, name)
+		}
+	}
+	encoder.state.Values = append(encoder.state.Values, savedValue{})
+	reference := len(encoder.state.Values)
+	encoder.values[value] = reference
+	saved := savedValue{}
+	if name, found := encoder.bindings[value]; found {
+		saved.Builtin = name
+		encoder.state.Values[reference-1] = saved
+		return reference, nil
+	}
+	value.mutex.Lock()
+	typeId, class, v, vtable := value.typeId, value.class, value.v, value.vtable
+	saved.Type, saved.Frozen = typeId, value.frozen
+	value.mutex.Unlock()
+	if typeId != ValueId && typeId != FunctionId && typeId != ClassId {
+		if name, found := encoder.attribute(vtable); found {
+			return 0, fmt.Errorf("%w: attribute %s of %s", ErrNotSerializable, name, typeId)
+		}
+	}
+	var encodeError error
+	switch typeId {
+	case StringId, BytesId:
+		saved.Bytes = v.([]byte)
+	case BoolId:
+		if v.(bool) {
+			saved.Int = 1
+		}
+	case NoneId:
+	case IntId:
+		saved.Int = v.(int64)
+	case FloatId:
+		saved.Float = v.(float64)
+	case ArrayId, TupleId:
+		saved.Values, encodeError = encoder.references(v.([]*Value))
+	case HashId:
+		hash := v.(*Hash)
+		hash.mutex.Lock()
+		keys := make([]string, 0, len(hash.internalMap))
+		for key := range hash.internalMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]HashKeyValue, 0, len(keys))
+		for _, key := range keys {
+			entries = append(entries, hash.internalMap[key])
+		}
+		hash.mutex.Unlock()
+		saved.HashKeys = keys
+		for _, entry := range entries {
+			var pair [2]int
+			if pair[0], encodeError = encoder.value(entry.Key); encodeError != nil {
+				break
+			}
+			if pair[1], encodeError = encoder.value(entry.Value); encodeError != nil {
+				break
+			}
+			saved.HashValues = append(saved.HashValues, pair)
+		}
+	case ValueId, FunctionId, ClassId:
+		switch typeId {
+		case ValueId:
+			if v != nil || value.proxy != nil {
+				return 0, fmt.Errorf("%w: object holding a Go value", ErrNotSerializable)
+			}
+		case FunctionId:
+			info := v.(FuncInfo)
+			saved.Name, saved.Arguments, saved.Bytecode = info.Name, info.Arguments, info.Bytecode
+		case ClassId:
+			info := v.(*ClassInfo)
+			saved.Prepared, saved.Bytecode = info.prepared, info.Bytecode
+			saved.Values, encodeError = encoder.references(info.Bases)
+		}
+		if encodeError == nil {
+			saved.Class, encodeError = encoder.value(class)
+		}
+		if encodeError == nil {
+			saved.Symbols, encodeError = encoder.symbolTable(vtable)
+		}
+	default:
+		return 0, fmt.Errorf("%w: %s not held by a global", ErrNotSerializable, typeId)
+	}
+	if encodeError != nil {
+		return 0, encodeError
+	}
+	encoder.state.Values[reference-1] = saved
+	return reference, nil
+}
+
+/*
+attribute returns the name of an attribute scripts set in the symbols, the built-in methods created for the
+value owning them are not attributes. Only objects, functions and classes have their attributes saved
+*/
+func (encoder *stateEncoder) attribute(vtable *Symbols) (string, bool) {
+	if vtable == nil {
+		return "", false
+	}
+	names := make([]string, 0)
+	for name, value := range vtable.Values() {
+		value.mutex.Lock()
+		isMethod := value.typeId == BuiltInFunctionId && value.vtable != nil && value.vtable.Parent == vtable
+		value.mutex.Unlock()
+		if isMethod {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+	return names[0], true
+}
+
+/*
+method encodes the built-in method as its receiver and name. The receiver is encoded first, so it is created
+before the method when decoding. Objects only get their methods on demand, the rest are set by Go code
+*/
+func (encoder *stateEncoder) method(value, receiver *Value, name string) (int, error) {
+	switch receiver.TypeId() {
+	case ValueId, FunctionId, ClassId:
+		if _, onDemand := encoder.plasma.onDemand[name]; !onDemand {
+			return 0, fmt.Errorf("%w: method %s set by Go", ErrNotSerializable, name)
+		}
+	}
+	receiverReference, encodeError := encoder.value(receiver)
+	if encodeError != nil {
+		return 0, encodeError
+	}
+	if reference, found := encoder.values[value]; found {
+		return reference, nil
+	}
+	encoder.state.Values = append(encoder.state.Values, savedValue{
+		Type:     BuiltInFunctionId,
+		Name:     name,
+		Receiver: receiverReference,
+	})
+	reference := len(encoder.state.Values)
+	encoder.values[value] = reference
+	return reference, nil
+}
+
+func (encoder *stateEncoder) references(values []*Value) ([]int, error) {
+	references := make([]int, 0, len(values))
+	for index, value := range values {
+		reference, encodeError := encoder.value(value)
+		if encodeError != nil {
+			return nil, fmt.Errorf("index %d: %w", index, encodeError)
+		}
+		references = append(references, reference)
+	}
+	return references, nil
+}
+
+func (encoder *stateEncoder) symbolTable(symbols *Symbols) (int, error) {
+	if symbols == nil {
+		return 0, nil
+	}
+	if reference, found := encoder.symbols[symbols]; found {
+		return reference, nil
+	}
+	encoder.state.Symbols = append(encoder.state.Symbols, savedSymbols{})
+	index := len(encoder.state.Symbols) - 1
+	reference := index + rootSymbolsReference + 1
+	encoder.symbols[symbols] = reference
+	saved := savedSymbols{Values: map[string]int{}}
+	var encodeError error
+	if saved.Parent, encodeError = encoder.symbolTable(symbols.Parent); encodeError != nil {
+		return 0, encodeError
+	}
+	if saved.Call, encodeError = encoder.symbolTable(symbols.call); encodeError != nil {
+		return 0, encodeError
+	}
+	for name, value := range symbols.Values() {
+		if _, onDemand := encoder.plasma.onDemand[name]; onDemand && value.TypeId() == BuiltInFunctionId {
+			// Generated again when requested
+			continue
+		}
+		valueReference, valueError := encoder.value(value)
+		if valueError != nil {
+			return 0, fmt.Errorf("symbol %s: %w", name, valueError)
+		}
+		saved.Values[name] = valueReference
+	}
+	encoder.state.Symbols[index] = saved
+	return reference, nil
+}
+
+/*
+LoadGlobals reads globals written by SaveGlobals and assigns them to the root symbols of the VM. The Go bound
+values the saved globals reference are looked up by name in the root symbols, so the VM must have the same
+bindings loaded as the one that saved them. Bytecode of functions and classes is checked like Verify does
+*/
+func (plasma *Plasma) LoadGlobals(r io.Reader) error {
+	state := &savedState{}
+	if decodeError := gob.NewDecoder(r).Decode(state); decodeError != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidState, decodeError)
+	}
+	decoder, decodeError := plasma.decodeState(state)
+	if decodeError != nil {
+		return decodeError
+	}
+	return decoder.globals(state)
+}
+
+/*
+element resolves a reference that can not be nil, like the elements of arrays and the keys and values of hashes
+*/
+func (decoder *stateDecoder) element(reference int) (*Value, error) {
+	if reference == 0 {
+		return nil, fmt.Errorf("%w: nil element", ErrInvalidState)
+	}
+	return decoder.value(reference)
+}
+
+func (decoder *stateDecoder) value(reference int) (*Value, error) {
+	if reference < 0 || reference > len(decoder.values) {
+		return nil, fmt.Errorf("%w: value %d out of range", ErrInvalidState, reference)
+	}
+	if reference == 0 {
+		return nil, nil
+	}
+	return decoder.values[reference-1], nil
+}
+
+func (decoder *stateDecoder) symbolTable(reference int) (*Symbols, error) {
+	switch {
+	case reference == 0:
+		return nil, nil
+	case reference == rootSymbolsReference:
+		return decoder.plasma.rootSymbols, nil
+	case reference < 0 || reference-rootSymbolsReference-1 >= len(decoder.symbols):
+		return nil, fmt.Errorf("%w: symbols %d out of range", ErrInvalidState, reference)
+	}
+	return decoder.symbols[reference-rootSymbolsReference-1], nil
+}
+
+/*
+globals assigns the decoded globals to the root symbols, none of them is assigned when one fails
+*/
+func (decoder *stateDecoder) globals(state *savedState) error {
+	globals := make(map[string]*Value, len(state.Globals))
+	for name, reference := range state.Globals {
+		global, referenceError := decoder.element(reference)
+		if referenceError != nil {
+			return fmt.Errorf("global %s: %w", name, referenceError)
+		}
+		globals[name] = global
+	}
+	for name, global := range globals {
+		decoder.plasma.rootSymbols.Set(name, global)
+	}
+	return nil
+}
+
+/*
+decodeState creates the values and symbol tables of the state, the symbols of the VM are left untouched
+*/
+func (plasma *Plasma) decodeState(state *savedState) (*stateDecoder, error) {
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrInvalidState, state.Version)
+	}
+	if state.Format != opcodes.FormatVersion {
+		return nil, fmt.Errorf("%w: bytecode format version %d, the VM executes version %d", ErrInvalidState, state.Format, opcodes.FormatVersion)
+	}
+	decoder := &stateDecoder{
+		plasma:  plasma,
+		values:  make([]*Value, len(state.Values)),
+		symbols: make([]*Symbols, len(state.Symbols)),
+	}
+	values, value, symbolTable := decoder.values, decoder.value, decoder.symbolTable
+	for index := range decoder.symbols {
+		decoder.symbols[index] = NewSymbols(nil)
+	}
+	// Create the values first, so references work in any order
+	for index, saved := range state.Values {
+		if saved.Builtin != "" {
+			builtin, getError := plasma.rootSymbols.Get(saved.Builtin)
+			if getError != nil {
+				return nil, fmt.Errorf("%w: Go bound value %s not found", ErrInvalidState, saved.Builtin)
+			}
+			values[index] = builtin
+			continue
+		}
+		switch saved.Type {
+		case StringId:
+			values[index] = plasma.NewString(saved.Bytes)
+		case BytesId:
+			values[index] = plasma.NewBytes(saved.Bytes)
+		case BoolId:
+			values[index] = plasma.NewBool(saved.Int != 0)
+		case NoneId:
+			values[index] = plasma.none
+		case IntId:
+			values[index] = plasma.NewInt(saved.Int)
+		case FloatId:
+			values[index] = plasma.NewFloat(saved.Float)
+		case ArrayId:
+			values[index] = plasma.NewArray(nil)
+		case TupleId:
+			values[index] = plasma.NewTuple(nil)
+		case HashId:
+			values[index] = plasma.NewHash(plasma.NewInternalHash())
+		case ValueId, FunctionId, ClassId:
+			if verifyError := verifyBody(saved.Bytecode); verifyError != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidState, verifyError)
+			}
+			// The symbols exist before the values, the methods below are looked up in them
+			vtable, symbolsError := symbolTable(saved.Symbols)
+			if symbolsError != nil {
+				return nil, symbolsError
+			}
+			if vtable == nil {
+				vtable = NewSymbols(plasma.rootSymbols)
+			}
+			values[index] = &Value{
+				onDemand: plasma.onDemand,
+				typeId:   saved.Type,
+				mutex:    &sync.Mutex{},
+				vtable:   vtable,
+			}
+			if vtable.owner == nil && vtable != plasma.rootSymbols {
+				vtable.owner = values[index]
+			}
+		case BuiltInFunctionId:
+			// Built-in methods are saved after their receiver
+			if saved.Receiver < 1 || saved.Receiver > index {
+				return nil, fmt.Errorf("%w: method %s without receiver", ErrInvalidState, saved.Name)
+			}
+			method, getError := values[saved.Receiver-1].Get(saved.Name)
+			if getError != nil || method.TypeId() != BuiltInFunctionId {
+				return nil, fmt.Errorf("%w: method %s not found", ErrInvalidState, saved.Name)
+			}
+			values[index] = method
+		default:
+			return nil, fmt.Errorf("%w: unknown type %d", ErrInvalidState, saved.Type)
+		}
+	}
+	// Link them
+	for index, saved := range state.Values {
+		switch {
+		case saved.Builtin != "":
+			continue
+		case saved.Type != ValueId && saved.Type != FunctionId && saved.Type != ClassId &&
+			saved.Type != BuiltInFunctionId && (saved.Symbols != 0 || saved.Class != 0):
+			return nil, fmt.Errorf("%w: attributes of %s", ErrInvalidState, saved.Type)
+		case saved.Type != ValueId && saved.Type != FunctionId && saved.Type != ClassId &&
+			saved.Type != ArrayId && saved.Type != TupleId && saved.Type != HashId:
+			// Primitives are complete and may be interned
+			continue
+		}
+		result := values[index]
+		switch saved.Type {
+		case ArrayId, TupleId:
+			elements := make([]*Value, 0, len(saved.Values))
+			for _, reference := range saved.Values {
+				element, referenceError := decoder.element(reference)
+				if referenceError != nil {
+					return nil, referenceError
+				}
+				elements = append(elements, element)
+			}
+			result.SetAny(elements)
+		case HashId:
+			if len(saved.HashKeys) != len(saved.HashValues) {
+				return nil, fmt.Errorf("%w: hash keys and values differ", ErrInvalidState)
+			}
+			hash := result.GetHash()
+			for entryIndex, key := range saved.HashKeys {
+				entryKey, keyError := decoder.element(saved.HashValues[entryIndex][0])
+				if keyError != nil {
+					return nil, keyError
+				}
+				entryValue, valueError := decoder.element(saved.HashValues[entryIndex][1])
+				if valueError != nil {
+					return nil, valueError
+				}
+				hash.internalMap[key] = HashKeyValue{Key: entryKey, Value: entryValue}
+			}
+		case ValueId, FunctionId, ClassId:
+			class, classError := value(saved.Class)
+			if classError != nil {
+				return nil, classError
+			}
+			result.class = class
+			switch saved.Type {
+			case FunctionId:
+				result.v = FuncInfo{
+					Name:      saved.Name,
+					Arguments: saved.Arguments,
+					Bytecode:  saved.Bytecode,
+					caches:    newInlineCaches(),
+				}
+			case ClassId:
+				info := &ClassInfo{
+					prepared: saved.Prepared,
+					Bytecode: saved.Bytecode,
+					caches:   newInlineCaches(),
+				}
+				for _, reference := range saved.Values {
+					base, baseError := decoder.element(reference)
+					if baseError != nil {
+						return nil, baseError
+					}
+					info.Bases = append(info.Bases, base)
+				}
+				result.v = info
+			}
+		}
+		if saved.Frozen {
+			result.frozen = true
+		}
+	}
+	for index, saved := range state.Symbols {
+		parent, parentError := symbolTable(saved.Parent)
+		if parentError != nil {
+			return nil, parentError
+		}
+		decoder.symbols[index].Parent = parent
+		call, callError := symbolTable(saved.Call)
+		if callError != nil {
+			return nil, callError
+		}
+		decoder.symbols[index].call = call
+		for name, reference := range saved.Values {
+			symbolValue, referenceError := value(reference)
+			if referenceError != nil {
+				return nil, referenceError
+			}
+			decoder.symbols[index].values[name] = symbolValue
+		}
+	}
+	return decoder, nil
+}
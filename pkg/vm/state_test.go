@@ -0,0 +1,204 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const statePrelude = `
+class Node
+	def __init__(name)
+		self.name = name
+		self.next = none
+	end
+	def describe()
+		return prefix + self.name + " -> " + self.next.name
+	end
+end
+prefix = "node "
+first = Node("first")
+second = Node("second")
+first.next = second
+second.next = first
+nodes = [first, second]
+alias = nodes
+table = {"nodes": nodes, 1: 2.5, "raw": b"bytes", "flag": true, "nothing": none}
+pair = (1, "two")
+def make_counter()
+	count = [0]
+	def increment()
+		count[0] = count[0] + 1
+		return count[0]
+	end
+	return increment
+end
+counter = make_counter()
+counter()
+printer = println
+`
+
+func TestPlasma_SaveLoadGlobals(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("triple", func(n int) int { return 3 * n }))
+	loadScript(t, p, statePrelude+"\ntripler = triple")
+	state := &bytes.Buffer{}
+	assert.Nil(t, p.SaveGlobals(state))
+
+	out := &bytes.Buffer{}
+	restored := NewVM(nil, out, nil)
+	assert.Nil(t, restored.LoadGo("triple", func(n int) int { return 3 * n }))
+	assert.Nil(t, restored.LoadGlobals(state))
+	rCh, errCh, _ := restored.ExecuteString(`
+printer(first.describe(), second.describe())
+nodes.append(Node("third"))
+(alias.__len__(), table["nodes"][0] == first, first.next.next == first, counter(), counter(), tripler(2),
+	table[1], table["raw"], table["flag"], table["nothing"], pair)`)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, "node first -> second node second -> first\n", out.String())
+	result, fromError := restored.FromValue(<-rCh)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{int64(3), true, true, int64(2), int64(3), int64(6),
+		2.5, []byte("bytes"), true, nil, []any{int64(1), "two"}}, result)
+	// Restored instances keep their class
+	first, _ := restored.RootSymbols().Get("first")
+	node, _ := restored.RootSymbols().Get("Node")
+	assert.Same(t, node, first.GetClass())
+	// Built-ins are linked to the ones of the VM
+	printer, _ := restored.RootSymbols().Get("printer")
+	println, _ := restored.RootSymbols().Get("println")
+	assert.Same(t, println, printer)
+}
+
+func TestPlasma_SaveGlobalsMethods(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, statePrelude+`
+methods = (nodes.append, first.__equal__)
+numbers = [1]
+push = numbers.append
+`)
+	state := &bytes.Buffer{}
+	assert.Nil(t, p.SaveGlobals(state))
+
+	restored := NewVM(nil, nil, nil)
+	assert.Nil(t, restored.LoadGlobals(state))
+	rCh, errCh, _ := restored.ExecuteString(`
+push(2)
+methods[0](Node("third"))
+(numbers.__len__(), alias.__len__(), methods[1](first), methods[1](second), push == numbers.append)`)
+	assert.Nil(t, <-errCh)
+	result, fromError := restored.FromValue(<-rCh)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{int64(2), int64(3), true, false, true}, result)
+}
+
+func TestPlasma_SaveGlobalsErrors(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, "iterators = [range(0, 3)]")
+	assert.ErrorIs(t, p.SaveGlobals(&bytes.Buffer{}), ErrNotSerializable)
+
+	// Missing bindings and malformed input
+	p = NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("triple", func(n int) int { return 3 * n }))
+	loadScript(t, p, "tripler = triple")
+	state := &bytes.Buffer{}
+	assert.Nil(t, p.SaveGlobals(state))
+	assert.ErrorIs(t, NewVM(nil, nil, nil).LoadGlobals(state), ErrInvalidState)
+	assert.ErrorIs(t, NewVM(nil, nil, nil).LoadGlobals(bytes.NewReader([]byte("garbage"))), ErrInvalidState)
+
+	// States holding bytecode of another format version
+	encoder := p.newStateEncoder()
+	encoder.state.Format = opcodes.FormatVersion - 1
+	state.Reset()
+	assert.Nil(t, gob.NewEncoder(state).Encode(encoder.state))
+	loadError := NewVM(nil, nil, nil).LoadGlobals(state)
+	assert.ErrorIs(t, loadError, ErrInvalidState)
+	assert.Contains(t, loadError.Error(), "bytecode format version")
+}
+
+func TestPlasma_SaveGlobalsFork(t *testing.T) {
+	template := NewVM(nil, nil, nil)
+	loadScript(t, template, statePrelude)
+	fork := template.Fork()
+	loadScript(t, fork, `first.name = "forked"`)
+	state := &bytes.Buffer{}
+	assert.Nil(t, fork.SaveGlobals(state))
+	restored := NewVM(nil, nil, nil)
+	assert.Nil(t, restored.LoadGlobals(state))
+	rCh, errCh, _ := restored.ExecuteString("second.describe()")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, "node second -> forked", (<-rCh).String())
+}
+
+func TestPlasma_SaveGlobalsAttributes(t *testing.T) {
+	// Only objects, functions and classes keep their attributes
+	for _, script := range []string{
+		"items = [1]\nitems.tag = 5",
+		"table = {}\ntable.tag = 5",
+		"name = 'plasma'\nname.tag = 5",
+	} {
+		p := NewVM(nil, nil, nil)
+		loadScript(t, p, script)
+		assert.ErrorIs(t, p.SaveGlobals(&bytes.Buffer{}), ErrNotSerializable, script)
+	}
+
+	// Methods created for the values are not attributes
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, "items = [1]\nitems.append(2)\nname = 'plasma'\nname.upper()\ncount = 1 + 2")
+	state := &bytes.Buffer{}
+	assert.Nil(t, p.SaveGlobals(state))
+	restored := NewVM(nil, nil, nil)
+	assert.Nil(t, restored.LoadGlobals(state))
+	rCh, errCh, _ := restored.ExecuteString("(items, name, count)")
+	assert.Nil(t, <-errCh)
+	decoded, fromError := restored.FromValue(<-rCh)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{[]any{int64(1), int64(2)}, "plasma", int64(3)}, decoded)
+}
+
+func TestPlasma_LoadGlobalsInvalid(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	loadScript(t, p, "kept = 1\nitems = [1, 2]\ntable = {\"a\": 1}\nnumber = 10")
+	indexOf := func(state *savedState, typeId TypeId) int {
+		for index, saved := range state.Values {
+			if saved.Type == typeId {
+				return index
+			}
+		}
+		t.Fatalf("no %s saved", typeId)
+		return 0
+	}
+	for _, test := range []struct {
+		name    string
+		corrupt func(state *savedState)
+	}{
+		{"nil element", func(state *savedState) { state.Values[indexOf(state, ArrayId)].Values[0] = 0 }},
+		{"nil hash key", func(state *savedState) { state.Values[indexOf(state, HashId)].HashValues[0][0] = 0 }},
+		{"nil hash value", func(state *savedState) { state.Values[indexOf(state, HashId)].HashValues[0][1] = 0 }},
+		{"primitive attributes", func(state *savedState) { state.Values[indexOf(state, IntId)].Symbols = rootSymbolsReference }},
+		{"primitive class", func(state *savedState) { state.Values[indexOf(state, IntId)].Class = 1 }},
+		{"array attributes", func(state *savedState) { state.Values[indexOf(state, ArrayId)].Symbols = rootSymbolsReference }},
+		{"nil global", func(state *savedState) { state.Globals["missing"] = 0 }},
+		{"global out of range", func(state *savedState) { state.Globals["missing"] = len(state.Values) + 1 }},
+	} {
+		encoder := p.newStateEncoder()
+		assert.Nil(t, encoder.globals(), test.name)
+		test.corrupt(encoder.state)
+		state := &bytes.Buffer{}
+		assert.Nil(t, gob.NewEncoder(state).Encode(encoder.state), test.name)
+
+		// Failed loads leave the globals untouched
+		target := NewVM(nil, nil, nil)
+		loadScript(t, target, "kept = 7")
+		assert.ErrorIs(t, target.LoadGlobals(state), ErrInvalidState, test.name)
+		kept, getError := target.rootSymbols.Get("kept")
+		assert.Nil(t, getError, test.name)
+		assert.Equal(t, int64(7), kept.GetInt64(), test.name)
+		for _, name := range []string{"items", "table", "number", "missing"} {
+			_, getError = target.rootSymbols.Get(name)
+			assert.NotNil(t, getError, "%s: %s", test.name, name)
+		}
+	}
+}
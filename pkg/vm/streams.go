@@ -0,0 +1,334 @@
+package vm
+
+import (
+	"bytes"
+	gocontext "context"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	streamsKey struct{}
+	/*
+		executionStreams are the streams of an execution started with ExecuteOptions redirecting them,
+		they travel in its context.Context so calls and callbacks made by built-ins use them too
+	*/
+	executionStreams struct {
+		stdin          *streamReader
+		stdout, stderr io.Writer
+	}
+	/*
+		streamReader buffers an input stream, it is kept for the whole life of the stream
+		so the bytes it buffered are not lost between reads. A single goroutine reads the stream
+		and hands its chunks to the reads, so reads can be abandoned without losing input
+	*/
+	streamReader struct {
+		lock   chan struct{}
+		start  sync.Once
+		stream io.Reader
+		chunks chan streamChunk
+		buffer []byte
+		ended  error // Error that ended the stream, io.EOF when it was fully read
+	}
+	streamChunk struct {
+		data []byte
+		err  error
+	}
+	/*
+		stdinBuffer holds the buffered Stdin of a VM, the first read binds it to the stream
+	*/
+	stdinBuffer struct {
+		mutex  sync.Mutex
+		stream io.Reader
+		reader *streamReader
+	}
+	flusher interface {
+		Flush() error
+	}
+	/*
+		Captured is the result of an execution started with ExecuteCaptured and the output it wrote
+	*/
+	Captured struct {
+		Result         *Value
+		Stdout, Stderr string
+	}
+	lockedBuffer struct {
+		mutex  sync.Mutex
+		buffer bytes.Buffer
+	}
+)
+
+/*
+newExecutionStreams returns the streams of an execution with the options, streams the options do not set are
+the ones of the parent execution. It returns the parent when the options set no stream
+*/
+func newExecutionStreams(parent *executionStreams, options ExecuteOptions) *executionStreams {
+	if options.Stdin == nil && options.Stdout == nil && options.Stderr == nil {
+		return parent
+	}
+	streams := &executionStreams{
+		stdout: options.Stdout,
+		stderr: options.Stderr,
+	}
+	if options.Stdin != nil {
+		streams.stdin = newStreamReader(options.Stdin)
+	}
+	if parent != nil {
+		if streams.stdin == nil {
+			streams.stdin = parent.stdin
+		}
+		if streams.stdout == nil {
+			streams.stdout = parent.stdout
+		}
+		if streams.stderr == nil {
+			streams.stderr = parent.stderr
+		}
+	}
+	return streams
+}
+
+/*
+withStreams returns the context.Context carrying the streams, nil streams leave it untouched
+*/
+func withStreams(goContext gocontext.Context, streams *executionStreams) gocontext.Context {
+	if streams == nil {
+		return goContext
+	}
+	return gocontext.WithValue(goContext, streamsKey{}, streams)
+}
+
+func newStreamReader(stream io.Reader) *streamReader {
+	if stream == nil {
+		stream = strings.NewReader("")
+	}
+	return &streamReader{
+		lock:   make(chan struct{}, 1),
+		stream: stream,
+		chunks: make(chan streamChunk),
+	}
+}
+
+/*
+pump reads the stream until it ends, sending every chunk to the reads
+*/
+func (reader *streamReader) pump() {
+	for {
+		data := make([]byte, 4096)
+		count, readError := reader.stream.Read(data)
+		if count > 0 || readError != nil {
+			reader.chunks <- streamChunk{data: data[:count], err: readError}
+		}
+		if readError != nil {
+			return
+		}
+	}
+}
+
+/*
+take waits until split finds the end of the next token in the buffered input and removes the token from it.
+split receives the buffered bytes and if the stream ended, it returns the length of the token and if it was
+found. Reads cancelled by the context.Context return before taking anything, so the input stays buffered
+for the next read
+*/
+func (reader *streamReader) take(goContext gocontext.Context, split func(buffer []byte, ended bool) (int, bool)) ([]byte, error) {
+	select {
+	case reader.lock <- struct{}{}:
+	case <-goContext.Done():
+		return nil, cancellationError(goContext)
+	}
+	defer func() { <-reader.lock }()
+	for {
+		if length, found := split(reader.buffer, reader.ended != nil); found {
+			token := reader.buffer[:length:length]
+			reader.buffer = reader.buffer[length:]
+			return token, nil
+		}
+		if reader.ended != nil {
+			return nil, reader.ended
+		}
+		reader.start.Do(func() { go reader.pump() })
+		select {
+		case chunk := <-reader.chunks:
+			reader.buffer = append(reader.buffer, chunk.data...)
+			reader.ended = chunk.err
+		case <-goContext.Done():
+			return nil, cancellationError(goContext)
+		}
+	}
+}
+
+func executionStreamsOf(goContext gocontext.Context) *executionStreams {
+	streams, _ := goContext.Value(streamsKey{}).(*executionStreams)
+	if streams == nil {
+		return &executionStreams{}
+	}
+	return streams
+}
+
+/*
+sameStream reports if both streams are the same, streams of types that can not be compared are never the same
+*/
+func sameStream(a, b io.Reader) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+/*
+get returns the buffer of the stream, binding the empty buffer to it. When the buffer is bound to another stream
+it is replaced if replace is set, otherwise get returns nil
+*/
+func (buffer *stdinBuffer) get(stream io.Reader, replace bool) *streamReader {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	switch {
+	case buffer.reader != nil && sameStream(buffer.stream, stream):
+		return buffer.reader
+	case buffer.reader != nil && !replace:
+		return nil
+	}
+	buffer.stream, buffer.reader = stream, newStreamReader(stream)
+	return buffer.reader
+}
+
+/*
+stdinReader returns the buffered standard input of the execution running with the context.Context. The buffer of
+Stdin is shared by the VM and its forks, so reads of one of them do not lose the bytes buffered by the others.
+VMs whose Stdin is not the stream of the shared buffer, like forks given another Stdin, buffer it on their own
+*/
+func (plasma *Plasma) stdinReader(goContext gocontext.Context) *streamReader {
+	if stdin := executionStreamsOf(goContext).stdin; stdin != nil {
+		return stdin
+	}
+	if shared := plasma.stdin.get(plasma.Stdin, false); shared != nil {
+		return shared
+	}
+	return plasma.ownStdin.get(plasma.Stdin, true)
+}
+
+/*
+stdout returns the standard output of the execution running with the context.Context
+*/
+func (plasma *Plasma) stdout(goContext gocontext.Context) io.Writer {
+	if stdout := executionStreamsOf(goContext).stdout; stdout != nil {
+		return stdout
+	}
+	return plasma.Stdout
+}
+
+/*
+stderr returns the standard error of the execution running with the context.Context
+*/
+func (plasma *Plasma) stderr(goContext gocontext.Context) io.Writer {
+	if stderr := executionStreamsOf(goContext).stderr; stderr != nil {
+		return stderr
+	}
+	return plasma.Stderr
+}
+
+/*
+read flushes the output streams and takes the next token split finds in the standard input of the execution.
+Reads block until there is input, when the execution is cancelled the read is abandoned and the input it was
+waiting for is left to the next read. Input ending with an error other than io.EOF fails the reads once
+the buffered bytes were taken
+*/
+func (plasma *Plasma) read(goContext gocontext.Context, split func(buffer []byte, ended bool) (int, bool)) ([]byte, error) {
+	if flushError := plasma.flush(goContext); flushError != nil {
+		return nil, flushError
+	}
+	token, readError := plasma.stdinReader(goContext).take(goContext, split)
+	if readError == io.EOF {
+		return token, nil
+	}
+	return token, readError
+}
+
+/*
+readLine reads a line without its line ending, None when the input ended
+*/
+func (plasma *Plasma) readLine(goContext gocontext.Context) (*Value, error) {
+	line, readError := plasma.read(goContext, func(buffer []byte, ended bool) (int, bool) {
+		if index := bytes.IndexByte(buffer, '\n'); index >= 0 {
+			return index + 1, true
+		}
+		return len(buffer), ended && len(buffer) > 0
+	})
+	if readError != nil {
+		return nil, readError
+	}
+	if line == nil {
+		return plasma.none, nil
+	}
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	return plasma.NewString(line), nil
+}
+
+/*
+write writes the values separated by spaces followed by end
+*/
+func (plasma *Plasma) write(w io.Writer, values []*Value, end string) error {
+	for index, value := range values {
+		if index != 0 {
+			if _, writeError := w.Write([]byte(" ")); writeError != nil {
+				return writeError
+			}
+		}
+		if _, writeError := w.Write([]byte(value.String())); writeError != nil {
+			return writeError
+		}
+	}
+	if end == "" {
+		return nil
+	}
+	_, writeError := w.Write([]byte(end))
+	return writeError
+}
+
+/*
+flush flushes the standard output and error of the execution running with the context.Context,
+writers buffering their output like *bufio.Writer are flushed
+*/
+func (plasma *Plasma) flush(goContext gocontext.Context) error {
+	for _, stream := range []io.Writer{plasma.stdout(goContext), plasma.stderr(goContext)} {
+		if buffered, isBuffered := stream.(flusher); isBuffered {
+			if flushError := buffered.Flush(); flushError != nil {
+				return flushError
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ExecuteCaptured is ExecuteWithOptions writing the standard output and error of the execution to buffers,
+the captured output is returned even when the execution fails. Stdin of the options is used as input
+*/
+func (plasma *Plasma) ExecuteCaptured(goContext gocontext.Context, bytecode []byte, options ExecuteOptions) (*Captured, error) {
+	stdout, stderr := &lockedBuffer{}, &lockedBuffer{}
+	options.Stdout, options.Stderr = stdout, stderr
+	result, executeError := plasma.ExecuteWithOptions(goContext, bytecode, options)
+	return &Captured{
+		Result: result,
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}, executeError
+}
+
+func (buffer *lockedBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *lockedBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.String()
+}
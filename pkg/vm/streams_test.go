@@ -0,0 +1,178 @@
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlasma_ExecuteStreams(t *testing.T) {
+	vmOut := &bytes.Buffer{}
+	p := NewVM(strings.NewReader("vm input\n"), vmOut, nil)
+	out := &bytes.Buffer{}
+	result, executeError := p.ExecuteWithOptions(gocontext.Background(), compile(t, `
+name = input("name: ")
+println("hello", name)
+name
+`), ExecuteOptions{
+		Stdin:  strings.NewReader("plasma\n"),
+		Stdout: out,
+	})
+	assert.Nil(t, executeError)
+	assert.Equal(t, "plasma", result.String())
+	assert.Equal(t, "name: hello plasma\n", out.String())
+	assert.Empty(t, vmOut.String())
+
+	// Streams not set in the options are the ones of the VM
+	_, executeError = p.ExecuteWithOptions(gocontext.Background(), compile(t, `print(1, 2)`), ExecuteOptions{})
+	assert.Nil(t, executeError)
+	assert.Equal(t, "1 2", vmOut.String())
+}
+
+func TestPlasma_ExecuteCaptured(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	// Calls made by built-ins with the context of the execution use its streams
+	p.Load("each", func(plasma *Plasma) *Value {
+		return plasma.NewBuiltInContextFunction(plasma.RootSymbols(),
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				for i := int64(0); i < argument[1].GetInt64(); i++ {
+					if _, callError := plasma.CallValueContext(ctx, argument[0], plasma.NewInt(i)); callError != nil {
+						return nil, callError
+					}
+				}
+				return plasma.None(), nil
+			},
+		)
+	})
+	bytecode := compile(t, `
+each(lambda i: println("call", i, id), 2)
+id * 10
+`)
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			scope := p.NewScope()
+			scope.Set("id", p.NewInt(int64(i)))
+			captured, executeError := p.ExecuteCaptured(gocontext.Background(), bytecode, ExecuteOptions{Scope: scope})
+			if !assert.Nil(t, executeError) {
+				return
+			}
+			assert.Equal(t, int64(i*10), captured.Result.GetInt64())
+			assert.Equal(t, fmt.Sprintf("call 0 %d\ncall 1 %d\n", i, i), captured.Stdout)
+			assert.Empty(t, captured.Stderr)
+		}(i)
+	}
+	wait.Wait()
+
+	// Output written before failing is kept
+	captured, executeError := p.ExecuteCaptured(gocontext.Background(), compile(t, `println("before")
+undefined`), ExecuteOptions{})
+	assert.NotNil(t, executeError)
+	assert.Nil(t, captured.Result)
+	assert.Equal(t, "before\n", captured.Stdout)
+}
+
+func TestPlasma_ReadBuiltins(t *testing.T) {
+	p := NewVM(strings.NewReader("first\r\nsecond\nthird\nfourth\nrest of\nthe input"), nil, nil)
+	captured, executeError := p.ExecuteCaptured(gocontext.Background(), compile(t, `
+first = input("> ")
+second = read_line()
+collected = []
+for line in lines()
+	collected.append(line)
+	if line == "fourth"
+		break
+	end
+end
+(first, second, collected, read_bytes(4), read_all(), read_line(), read_bytes(4))
+`), ExecuteOptions{})
+	assert.Nil(t, executeError)
+	assert.Equal(t, "> ", captured.Stdout)
+	result, fromError := p.FromValue(captured.Result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{"first", "second", []any{"third", "fourth"}, []byte("rest"), " of\nthe input", nil, []byte{}}, result)
+
+	// Bytes buffered by one read are kept for the next executions
+	p = NewVM(strings.NewReader("one\ntwo\n"), &bytes.Buffer{}, nil)
+	for _, expected := range []string{"one", "two"} {
+		line, readError := p.ExecuteWithOptions(gocontext.Background(), compile(t, `input("")`), ExecuteOptions{})
+		assert.Nil(t, readError)
+		assert.Equal(t, expected, line.String())
+	}
+}
+
+func TestPlasma_ForkSharesStdin(t *testing.T) {
+	template := NewVM(strings.NewReader("one\ntwo\nthree\nfour\n"), nil, nil)
+	fork := template.Fork()
+	other := template.Fork()
+	other.Stdin = strings.NewReader("other\n")
+	readLine := compile(t, "read_line()")
+	for index, vm := range []*Plasma{fork, template, other, fork.Fork(), template} {
+		line, readError := vm.ExecuteContext(gocontext.Background(), readLine)
+		assert.Nil(t, readError)
+		assert.Equal(t, []string{"one", "two", "other", "three", "four"}[index], line.String())
+	}
+}
+
+func TestPlasma_CancelledReadKeepsInput(t *testing.T) {
+	stdin, input := io.Pipe()
+	template := NewVM(stdin, nil, nil)
+	fork := template.Fork()
+	readLine := compile(t, "read_line()")
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, readError := fork.ExecuteContext(ctx, readLine)
+	assert.ErrorIs(t, readError, gocontext.DeadlineExceeded)
+
+	go func() {
+		_, _ = input.Write([]byte("first\nsecond\n"))
+		_ = input.Close()
+	}()
+	for _, expected := range []string{"first", "second"} {
+		line, lineError := template.ExecuteContext(gocontext.Background(), readLine)
+		assert.Nil(t, lineError)
+		assert.Equal(t, expected, line.String())
+	}
+	line, lineError := fork.ExecuteContext(gocontext.Background(), readLine)
+	assert.Nil(t, lineError)
+	assert.Equal(t, NoneId, line.TypeId())
+}
+
+func TestPlasma_ErrorAndFlushBuiltins(t *testing.T) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	stdout := bufio.NewWriter(out)
+	p := NewVM(nil, stdout, errOut)
+	assert.Nil(t, p.LoadGo("written", func() string { return out.String() }))
+	result, executeError := p.ExecuteContext(gocontext.Background(), compile(t, `
+print("buffered")
+before = written()
+flush()
+after = written()
+eprint("warning:", 1)
+eprintln("")
+println("done")
+(before, after)
+`))
+	assert.Nil(t, executeError)
+	written, fromError := p.FromValue(result)
+	assert.Nil(t, fromError)
+	assert.Equal(t, []any{"", "buffered"}, written)
+	assert.Equal(t, "warning: 1\n", errOut.String())
+	// The output is flushed when the execution ends
+	assert.Equal(t, "buffereddone\n", out.String())
+
+	pure := NewVM(nil, nil, nil, WithProfile(ProfilePure))
+	for _, symbol := range ioSymbols {
+		_, getError := pure.RootSymbols().Get(symbol)
+		assert.NotNil(t, getError, symbol)
+	}
+}
@@ -3,6 +3,7 @@ package vm
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -11,10 +12,13 @@ var (
 
 type (
 	Symbols struct {
-		mutex  *sync.Mutex
-		values map[string]*Value
-		call   *Symbols
-		Parent *Symbols
+		version uint64 // Incremented on every Set and Del, keep it first for 64-bit atomic alignment
+		mutex   *sync.Mutex
+		values  map[string]*Value
+		call    *Symbols
+		Parent  *Symbols
+		fork    *forkCopier // Set in the root symbols of forks, copies the template globals on first access
+		owner   *Value      // Value whose attributes the symbols hold, the parent of the built-in methods created for it
 	}
 )
 
@@ -37,31 +41,90 @@ func (symbols *Symbols) Set(name string, value *Value) {
 	symbols.mutex.Lock()
 	defer symbols.mutex.Unlock()
 	symbols.values[name] = value
+	atomic.AddUint64(&symbols.version, 1)
 }
 
 /*
-Get retrieves a value based on the symbol
+Values returns a copy of the symbols assigned in the table, the symbols of its parents are not included
 */
-func (symbols *Symbols) Get(name string) (*Value, error) {
+func (symbols *Symbols) Values() map[string]*Value {
 	symbols.mutex.Lock()
-	defer symbols.mutex.Unlock()
-	var (
-		value *Value
-		found bool
-	)
-	value, found = symbols.values[name]
-	if found {
-		return value, nil
+	values := make(map[string]*Value, len(symbols.values))
+	for name, value := range symbols.values {
+		values[name] = value
 	}
-	for current := symbols.Parent; current != nil; current = current.Parent {
-		value, found = current.values[name]
+	symbols.mutex.Unlock()
+	if symbols.fork != nil {
+		for name, value := range values {
+			values[name] = symbols.fork.resolve(name, value)
+		}
+	}
+	return values
+}
+
+/*
+Get retrieves a value based on the symbol
+*/
+func (symbols *Symbols) Get(name string) (*Value, error) {
+	for current := symbols; current != nil; current = current.Parent {
+		current.mutex.Lock()
+		value, found := current.values[name]
+		current.mutex.Unlock()
 		if found {
+			if current.fork != nil {
+				value = current.fork.resolve(name, value)
+			}
 			return value, nil
 		}
 	}
 	return nil, fmt.Errorf(SymbolNotFoundError, name)
 }
 
+/*
+replace binds a copy of the value to the symbol in the table defining it, when the symbol still holds the value.
+It returns the copy, which stays unbound when the symbol holds another value
+*/
+func (symbols *Symbols) replace(name string, value *Value, copy func(*Value) *Value) *Value {
+	copied := copy(value)
+	for current := symbols; current != nil; current = current.Parent {
+		current.mutex.Lock()
+		bound, found := current.values[name]
+		if found && bound == value {
+			current.values[name] = copied
+			atomic.AddUint64(&current.version, 1)
+		}
+		current.mutex.Unlock()
+		if found {
+			break
+		}
+	}
+	return copied
+}
+
+/*
+lookup retrieves a value based on the symbol, it also returns the version of every symbol table
+walked until finding it, so the result can be cached until one of them changes
+*/
+func (symbols *Symbols) lookup(name string) (*Value, []symbolsVersion, bool) {
+	var chain []symbolsVersion
+	for current := symbols; current != nil; current = current.Parent {
+		current.mutex.Lock()
+		value, found := current.values[name]
+		chain = append(chain, symbolsVersion{
+			symbols: current,
+			version: current.version,
+		})
+		current.mutex.Unlock()
+		if found {
+			if current.fork != nil {
+				value = current.fork.resolve(name, value)
+			}
+			return value, chain, true
+		}
+	}
+	return nil, nil, false
+}
+
 /*
 Del deletes a symbol
 */
@@ -73,5 +136,6 @@ func (symbols *Symbols) Del(name string) error {
 		return fmt.Errorf(SymbolNotFoundError, name)
 	}
 	delete(symbols.values, name)
+	atomic.AddUint64(&symbols.version, 1)
 	return nil
 }
@@ -1,11 +1,15 @@
 package vm
 
 import (
+	gocontext "context"
 	"fmt"
 	magic_functions "github.com/shoriwe/plasma/pkg/common/magic-functions"
 	"reflect"
 )
 
+/*
+PlasmaCallback is a script callable held by Go, see NewCallback
+*/
 type PlasmaCallback func(arg ...any) (any, error)
 
 /*
@@ -123,13 +127,23 @@ func (plasma *Plasma) ZeroCopyArray(vt *Symbols, v any) *Value {
 FromValue maps a Go value to a plasma Value, this function easy the work for interfacing with plasma
 */
 func (plasma *Plasma) FromValue(value *Value) (any, error) {
+	return fromValue(value)
+}
+
+/*
+fromValue implements FromValue, it does not depend on the VM that created the value
+*/
+func fromValue(value *Value) (any, error) {
 	switch id := value.TypeId(); id {
 	case ValueId:
+		if value.proxy != nil {
+			return value.proxy.pointer.Interface(), nil
+		}
 		value.mutex.Lock()
 		defer value.mutex.Unlock()
 		r := make(map[string]any, len(value.vtable.values))
 		for key, objValue := range value.vtable.values {
-			v, err := plasma.FromValue(objValue)
+			v, err := fromValue(objValue)
 			if err != nil {
 				return nil, err
 			}
@@ -152,7 +166,7 @@ func (plasma *Plasma) FromValue(value *Value) (any, error) {
 		values := value.GetValues()
 		r := make([]any, 0, len(values))
 		for _, arrayValue := range values {
-			v, err := plasma.FromValue(arrayValue)
+			v, err := fromValue(arrayValue)
 			if err != nil {
 				return nil, err
 			}
@@ -165,11 +179,11 @@ func (plasma *Plasma) FromValue(value *Value) (any, error) {
 		defer hash.mutex.Unlock()
 		result := make(map[any]any, len(hash.internalMap))
 		for _, keyValue := range hash.internalMap {
-			key, err := plasma.FromValue(keyValue.Key)
+			key, err := fromValue(keyValue.Key)
 			if err != nil {
 				return nil, err
 			}
-			v, err := plasma.FromValue(keyValue.Value)
+			v, err := fromValue(keyValue.Value)
 			if err != nil {
 				return nil, err
 			}
@@ -189,14 +203,31 @@ func (plasma *Plasma) FromValue(value *Value) (any, error) {
 	}
 }
 
+var (
+	contextType = reflect.TypeOf((*gocontext.Context)(nil)).Elem()
+	plasmaType  = reflect.TypeOf((*Plasma)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+/*
+callGoFunc calls the Go function, a non nil trailing error is returned as the error of the call. The other
+results are converted with ToValue, none when there are no results and a Tuple when there are many
+*/
 func (plasma *Plasma) callGoFunc(symbols *Symbols, function reflect.Value, arguments ...reflect.Value) (*Value, error) {
 	result := function.Call(arguments)
+	functionType := function.Type()
+	if numOut := functionType.NumOut(); numOut > 0 && functionType.Out(numOut-1) == errorType {
+		if err := result[numOut-1]; !err.IsNil() {
+			return nil, err.Interface().(error)
+		}
+		result = result[:numOut-1]
+	}
 	if len(result) == 0 {
 		return plasma.None(), nil
 	}
 	plasmaResult := make([]*Value, 0, len(result))
 	for _, r := range result {
-		asPlasma, err := plasma.ToValue(symbols, r.Interface())
+		asPlasma, err := plasma.toValue(symbols, r.Interface(), true)
 		if err != nil {
 			return nil, err
 		}
@@ -205,143 +236,178 @@ func (plasma *Plasma) callGoFunc(symbols *Symbols, function reflect.Value, argum
 	if len(plasmaResult) == 1 {
 		return plasmaResult[0], nil
 	}
-	return plasma.NewArray(plasmaResult), nil
+	return plasma.NewTuple(plasmaResult), nil
 }
 
+/*
+reflectConvert converts a Go value returned by FromValue to the type t. Pointers are allocated, slices, arrays
+and maps are converted element by element and maps with string keys fill the fields of structs
+*/
 func reflectConvert(v reflect.Value, t reflect.Type) (reflect.Value, error) {
-	var result reflect.Value
-	nested := 0
-	targetType := t
-	for ; targetType.Kind() == reflect.Pointer; targetType = targetType.Elem() {
-		nested++
+	if v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return reflect.Zero(t), nil
 	}
 	vType := v.Type()
 	switch {
-	case v.Type() == targetType:
-		result = v
-	case v.CanConvert(targetType):
-		result = v.Convert(targetType)
-	case v.Kind() == reflect.Map && vType.Key().Kind() == reflect.String && vType.Elem().Kind() == reflect.Interface && targetType.Kind() == reflect.Struct:
-		result = reflect.New(targetType).Elem()
-		for fieldIndex := 0; fieldIndex < targetType.NumField(); fieldIndex++ {
-			field := targetType.Field(fieldIndex)
-			value := v.MapIndex(reflect.ValueOf(field.Name))
-			if value.IsZero() {
-				return reflect.Value{}, fmt.Errorf("field with name %s not found in plasma object", targetType.Field(fieldIndex).Name)
-			}
-			result.FieldByName(field.Name).Set(reflect.ValueOf(value.Interface()))
+	case vType == t:
+		return v, nil
+	case vType.Kind() == reflect.Pointer && vType.Elem() == t:
+		return v.Elem(), nil
+	case t.Kind() == reflect.Interface:
+		if !vType.Implements(t) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", vType, t)
 		}
-	default:
-		// TODO: Fix me this should work in any scenario
-		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", v.Type(), targetType)
+		result := reflect.New(t).Elem()
+		result.Set(v)
+		return result, nil
+	case t.Kind() == reflect.Pointer:
+		elem, convertError := reflectConvert(v, t.Elem())
+		if convertError != nil {
+			return reflect.Value{}, convertError
+		}
+		result := reflect.New(t.Elem())
+		result.Elem().Set(elem)
+		return result, nil
+	case t.Kind() == reflect.String && vType.Kind() != reflect.String && vType != reflect.TypeOf([]byte{}):
+		// Go converts integers to strings as runes
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", vType, t)
+	case v.CanConvert(t):
+		return v.Convert(t), nil
 	}
-	for doNested := 0; doNested < nested; doNested++ {
-		result = result.Addr()
+	switch {
+	case t.Kind() == reflect.Slice && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		result := reflect.MakeSlice(t, v.Len(), v.Len())
+		for index := 0; index < v.Len(); index++ {
+			elem, convertError := reflectConvert(v.Index(index), t.Elem())
+			if convertError != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", index, convertError)
+			}
+			result.Index(index).Set(elem)
+		}
+		return result, nil
+	case t.Kind() == reflect.Array && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == t.Len():
+		result := reflect.New(t).Elem()
+		for index := 0; index < v.Len(); index++ {
+			elem, convertError := reflectConvert(v.Index(index), t.Elem())
+			if convertError != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", index, convertError)
+			}
+			result.Index(index).Set(elem)
+		}
+		return result, nil
+	case t.Kind() == reflect.Map && v.Kind() == reflect.Map:
+		result := reflect.MakeMapWithSize(t, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			key, convertError := reflectConvert(iter.Key(), t.Key())
+			if convertError != nil {
+				return reflect.Value{}, fmt.Errorf("key %v: %w", iter.Key(), convertError)
+			}
+			value, convertError := reflectConvert(iter.Value(), t.Elem())
+			if convertError != nil {
+				return reflect.Value{}, fmt.Errorf("key %v: %w", iter.Key(), convertError)
+			}
+			result.SetMapIndex(key, value)
+		}
+		return result, nil
+	case t.Kind() == reflect.Struct && v.Kind() == reflect.Map &&
+		(vType.Key().Kind() == reflect.String || vType.Key().Kind() == reflect.Interface):
+		result := reflect.New(t).Elem()
+		for name, index := range structFields(t) {
+			value := v.MapIndex(reflect.ValueOf(name).Convert(vType.Key()))
+			if !value.IsValid() {
+				continue
+			}
+			field, convertError := reflectConvert(value, t.Field(index).Type)
+			if convertError != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", name, convertError)
+			}
+			result.Field(index).Set(field)
+		}
+		return result, nil
 	}
-	return result, nil
+	return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", vType, t)
 }
 
-func (plasma *Plasma) toValueGoFunctionCall(symbols *Symbols, function reflect.Value) func(argument ...*Value) (*Value, error) {
+/*
+toValueGoFunctionCall wraps the Go function in a callback, leading context.Context and *Plasma parameters receive
+the context of the execution and the VM instead of script arguments
+*/
+func (plasma *Plasma) toValueGoFunctionCall(symbols *Symbols, function reflect.Value) ContextCallback {
 	functionType := function.Type()
 	numIn := functionType.NumIn()
 	isVariadic := functionType.IsVariadic()
-	if numIn == 0 {
-		return func(argument ...*Value) (*Value, error) {
-			return plasma.callGoFunc(symbols, function)
-		}
+	injected := 0
+	for injected < numIn && (functionType.In(injected) == contextType || functionType.In(injected) == plasmaType) {
+		injected++
 	}
-	return func(arguments ...*Value) (*Value, error) {
-		if len(arguments) != numIn && !isVariadic {
-			return nil, fmt.Errorf("expecting %d arguments but recieved %d", numIn, len(arguments))
+	fixed := numIn
+	if isVariadic {
+		fixed--
+	}
+	return func(ctx gocontext.Context, arguments ...*Value) (*Value, error) {
+		switch {
+		case isVariadic && len(arguments) < fixed-injected:
+			return nil, fmt.Errorf("expecting at least %d arguments but recieved %d", fixed-injected, len(arguments))
+		case !isVariadic && len(arguments) != numIn-injected:
+			return nil, fmt.Errorf("expecting %d arguments but recieved %d", numIn-injected, len(arguments))
 		}
-		callArguments := make([]reflect.Value, 0, numIn)
-		var lastIndex int
-		if isVariadic {
-			lastIndex = numIn - 1
-		} else {
-			lastIndex = numIn
+		callArguments := make([]reflect.Value, 0, injected+len(arguments))
+		for index := 0; index < injected; index++ {
+			if functionType.In(index) == contextType {
+				callArguments = append(callArguments, reflect.ValueOf(&ctx).Elem())
+			} else {
+				callArguments = append(callArguments, reflect.ValueOf(plasma))
+			}
 		}
-		index := 0
-		for ; index < lastIndex; index++ {
-			argument := arguments[index]
+		for index, argument := range arguments {
+			var argumentType reflect.Type
+			if index+injected < fixed {
+				argumentType = functionType.In(index + injected)
+			} else {
+				argumentType = functionType.In(fixed).Elem()
+			}
 			asGoValue, asGoValueError := plasma.FromValue(argument)
 			if asGoValueError != nil {
 				return nil, asGoValueError
 			}
-			argumentAsReflectValue, convertErr := reflectConvert(reflect.ValueOf(asGoValue), functionType.In(index))
+			argumentAsReflectValue, convertErr := reflectConvert(reflect.ValueOf(asGoValue), argumentType)
 			if convertErr != nil {
-				return nil, convertErr
+				return nil, fmt.Errorf("argument %d: %w", index+1, convertErr)
 			}
-
 			callArguments = append(callArguments, argumentAsReflectValue)
 		}
-		// Insert values to variadic
-		if index < numIn {
-			variadicArguments := make([]reflect.Value, 0, numIn-index)
-			variadicArgumentType := functionType.In(index).Elem()
-			for ; index < len(arguments); index++ {
-				argument := arguments[index]
-				asGoValue, asGoValueError := plasma.FromValue(argument)
-				if asGoValueError != nil {
-					return nil, asGoValueError
-				}
-				argumentAsReflectValue, convertErr := reflectConvert(reflect.ValueOf(asGoValue), variadicArgumentType)
-				if convertErr != nil {
-					return nil, convertErr
-				}
-				variadicArguments = append(variadicArguments, argumentAsReflectValue)
-			}
-			callArguments = append(callArguments, variadicArguments...)
-		}
 		return plasma.callGoFunc(symbols, function, callArguments...)
 	}
 }
 
-func (plasma *Plasma) convertMethod(self reflect.Value, function reflect.Method) func(...any) any {
-	return func(arguments ...any) any {
-		in := make([]reflect.Value, 0, len(arguments)+1)
-		in = append(in, self)
-		for _, argument := range arguments {
-			in = append(in, reflect.ValueOf(argument))
-		}
-		out := function.Func.Call(in)
-		result := make([]any, 0, len(out))
-		for _, o := range out {
-			result = append(result, o.Interface())
-		}
-		switch len(result) {
-		case 0:
-			return nil
-		case 1:
-			return result[0]
-		default:
-			return result
-		}
-	}
-}
-
 func (plasma *Plasma) methodsToValue(symbols *Symbols, asReflectValue reflect.Value) (map[string]*Value, error) {
 	asReflectValueType := asReflectValue.Type()
 	numMethod := asReflectValueType.NumMethod()
 	methods := make(map[string]*Value, numMethod)
 	for index := 0; index < numMethod; index++ {
-		method := asReflectValueType.Method(index)
-		plasmaMethod, convertErr := plasma.ToValue(
+		methods[asReflectValueType.Method(index).Name] = plasma.NewBuiltInContextFunction(
 			symbols,
-			plasma.convertMethod(asReflectValue, method),
+			plasma.toValueGoFunctionCall(symbols, asReflectValue.Method(index)),
 		)
-		if convertErr != nil {
-			return nil, convertErr
-		}
-		methods[method.Name] = plasmaMethod
 	}
 	return methods, nil
 }
 
 /*
-ToValue maps a Plasma Value to a Go value, this function easy the work for interfacing with plasma
+ToValue maps a Plasma Value to a Go value, this function easy the work for interfacing with plasma.
+VMs with a restricted Profile do not expose methods and only convert functions passed directly
 */
 func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
+	return plasma.toValue(symbols, v, false)
+}
+
+/*
+toValue implements ToValue, nested reports if v was reached through another Go value
+*/
+func (plasma *Plasma) toValue(symbols *Symbols, v any, nested bool) (*Value, error) {
 	if v == nil {
 		return plasma.None(), nil
 	}
@@ -354,7 +420,7 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 	}
 	asReflectValue := reflect.ValueOf(v)
 	asReflectValueType := asReflectValue.Type()
-	if asReflectValueType.NumMethod() > 0 {
+	if asReflectValueType.NumMethod() > 0 && !plasma.restricted() {
 		var transformError error
 		methods, transformError = plasma.methodsToValue(symbols, asReflectValue)
 		if transformError != nil {
@@ -381,7 +447,7 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 		}
 		values := make([]*Value, 0, asReflectValue.Len())
 		for index := 0; index < asReflectValue.Len(); index++ {
-			value, err := plasma.ToValue(symbols, asReflectValue.Index(index).Interface())
+			value, err := plasma.toValue(symbols, asReflectValue.Index(index).Interface(), true)
 			if err != nil {
 				return nil, fmt.Errorf("transform error at index %d: %w", index, err)
 			}
@@ -393,12 +459,12 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 		hash := plasma.NewInternalHash()
 		hash.internalMap = make(map[string]HashKeyValue, len(keys))
 		for _, key := range keys {
-			keyV, keyErr := plasma.ToValue(symbols, key.Interface())
+			keyV, keyErr := plasma.toValue(symbols, key.Interface(), true)
 			if keyErr != nil {
 				return nil, fmt.Errorf("transform key %v error: %w", key, keyErr)
 			}
 			value := asReflectValue.MapIndex(key)
-			valueV, valueErr := plasma.ToValue(symbols, value.Interface())
+			valueV, valueErr := plasma.toValue(symbols, value.Interface(), true)
 			if valueErr != nil {
 				return nil, fmt.Errorf("transform key %v error: %w", key, valueErr)
 			}
@@ -409,39 +475,51 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 		}
 		obj = plasma.NewHash(hash)
 	case reflect.Struct:
-		nFields := asReflectValue.NumField()
 		obj = plasma.NewValue(symbols, ValueId, plasma.ValueClass())
-		for i := 0; i < nFields; i++ {
-			if !asReflectValue.Field(i).CanInterface() {
-				continue
-			}
-			fieldValue, err := plasma.ToValue(symbols, asReflectValue.Field(i).Interface())
+		for name, index := range structFields(asReflectValueType) {
+			fieldValue, err := plasma.toValue(symbols, asReflectValue.Field(index).Interface(), true)
 			if err != nil {
-				return nil, fmt.Errorf("transform struct error at field %s: %w", asReflectValue.Type().Field(i).Name, err)
+				return nil, fmt.Errorf("transform struct error at field %s: %w", name, err)
 			}
-			obj.Set(asReflectValue.Type().Field(i).Name, fieldValue)
+			obj.Set(name, fieldValue)
 		}
 	case reflect.Func:
-		obj = plasma.NewBuiltInFunction(symbols, plasma.toValueGoFunctionCall(symbols, asReflectValue))
+		if nested && plasma.restricted() {
+			return nil, fmt.Errorf("%w: nested Go function", ErrRestricted)
+		}
+		obj = plasma.NewBuiltInContextFunction(symbols, plasma.toValueGoFunctionCall(symbols, asReflectValue))
 	case reflect.Pointer:
+		if asReflectValue.IsNil() {
+			return plasma.None(), nil
+		}
+		if asReflectValueType.Elem().Kind() == reflect.Struct {
+			obj = plasma.structProxy(symbols, asReflectValue)
+			break
+		}
 		var err error
-		obj, err = plasma.ToValue(symbols, asReflectValue.Elem().Interface())
+		obj, err = plasma.toValue(symbols, asReflectValue.Elem().Interface(), nested)
 		if err != nil {
 			return nil, err
 		}
 	case reflect.Chan:
 		obj = plasma.NewValue(symbols, ValueId, plasma.ValueClass())
-		obj.Set("recv", plasma.NewBuiltInFunction(obj.VirtualTable(),
-			func(argument ...*Value) (*Value, error) {
-				vv, ok := asReflectValue.Recv()
+		obj.Set("recv", plasma.NewBuiltInContextFunction(obj.VirtualTable(),
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
+				chosen, vv, ok := reflect.Select([]reflect.SelectCase{
+					{Dir: reflect.SelectRecv, Chan: asReflectValue},
+					{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+				})
+				if chosen == 1 {
+					return nil, cancellationError(ctx)
+				}
 				if !ok {
 					return nil, fmt.Errorf("channel is closed")
 				}
-				return plasma.ToValue(obj.VirtualTable(), vv.Interface())
+				return plasma.toValue(obj.VirtualTable(), vv.Interface(), true)
 			},
 		))
-		obj.Set("send", plasma.NewBuiltInFunction(obj.VirtualTable(),
-			func(argument ...*Value) (*Value, error) {
+		obj.Set("send", plasma.NewBuiltInContextFunction(obj.VirtualTable(),
+			func(ctx gocontext.Context, argument ...*Value) (*Value, error) {
 				vv, err := plasma.FromValue(argument[0])
 				if err != nil {
 					return nil, err
@@ -454,7 +532,13 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 				} else {
 					return nil, fmt.Errorf("cannot convert type inside channel")
 				}
-				asReflectValue.Send(vvAsReflectValue)
+				chosen, _, _ := reflect.Select([]reflect.SelectCase{
+					{Dir: reflect.SelectSend, Chan: asReflectValue, Send: vvAsReflectValue},
+					{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+				})
+				if chosen == 1 {
+					return nil, cancellationError(ctx)
+				}
 				return plasma.None(), nil
 			},
 		))
@@ -473,6 +557,10 @@ func (plasma *Plasma) ToValue(symbols *Symbols, v any) (*Value, error) {
 	if methods == nil {
 		return obj, nil
 	}
+	if obj.Frozen() {
+		// Interned integers are shared by the whole VM, the methods go to a value of its own
+		obj = plasma.copyPrimitive(obj)
+	}
 	for methodName, method := range methods {
 		obj.Set(methodName, method)
 	}
@@ -1,7 +1,10 @@
 package vm
 
 import (
+	gocontext "context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -524,6 +527,24 @@ func TestPlasma_ToValuePointer(t *testing.T) {
 	assert.Equal(t, 100, Int[int](<-rCh))
 }
 
+type testPlasma_ToValuePointerMethods_counter int
+
+func (c *testPlasma_ToValuePointerMethods_counter) Inc() {
+	*c++
+}
+
+func TestPlasma_ToValuePointerMethods(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	c := testPlasma_ToValuePointerMethods_counter(5)
+	assert.Nil(t, p.LoadGo("c", &c))
+	_, errCh, _ := p.ExecuteString("c.Inc()\nx = 2 + 3\nx.Inc()")
+	assert.NotNil(t, <-errCh)
+	// Methods of the pointer are not attached to the interned integer
+	assert.Equal(t, testPlasma_ToValuePointerMethods_counter(6), c)
+	_, getError := p.NewInt(5).Get("Inc")
+	assert.NotNil(t, getError)
+}
+
 func TestPlasma_ToValueChan(t *testing.T) {
 	p := NewVM(nil, nil, nil)
 	a := make(chan int, 2)
@@ -542,3 +563,115 @@ func TestPlasma_ToValueChan(t *testing.T) {
 	assert.Equal(t, 100, <-a)
 
 }
+
+func TestPlasma_ToValueFuncErrorResult(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	failure := errors.New("division by zero")
+	f := func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, failure
+		}
+		return a / b, nil
+	}
+	assert.Nil(t, p.LoadGo("div", f))
+	rCh, errCh, _ := p.ExecuteString("div(10, 2)")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, 5, Int[int](<-rCh))
+	_, errCh, _ = p.ExecuteString("div(10, 0)")
+	assert.ErrorIs(t, <-errCh, failure)
+	// Only the error
+	assert.Nil(t, p.LoadGo("check", func(ok bool) error {
+		if ok {
+			return nil
+		}
+		return failure
+	}))
+	rCh, errCh, _ = p.ExecuteString("check(true)")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, NoneId, (<-rCh).TypeId())
+	_, errCh, _ = p.ExecuteString("check(false)")
+	assert.ErrorIs(t, <-errCh, failure)
+	// Several results with an error
+	assert.Nil(t, p.LoadGo("split", func(s string) (string, string, error) {
+		before, after, found := strings.Cut(s, "=")
+		if !found {
+			return "", "", failure
+		}
+		return before, after, nil
+	}))
+	rCh, errCh, _ = p.ExecuteString("split('a=b')")
+	assert.Nil(t, <-errCh)
+	result := <-rCh
+	assert.Equal(t, TupleId, result.TypeId())
+	assert.Equal(t, 2, len(result.GetValues()))
+	assert.Equal(t, "b", result.GetValues()[1].String())
+}
+
+func TestPlasma_ToValueFuncInjected(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	type key struct{}
+	ctx := gocontext.WithValue(gocontext.Background(), key{}, "from context")
+	assert.Nil(t, p.LoadGo("f", func(ctx gocontext.Context, plasma *Plasma, suffix string) string {
+		assert.Same(t, p, plasma)
+		return ctx.Value(key{}).(string) + suffix
+	}))
+	bytecode := compile(t, "f('!')")
+	result, err := p.ExecuteContext(ctx, bytecode)
+	assert.Nil(t, err)
+	assert.Equal(t, "from context!", result.String())
+	// The injected parameters are not counted as arguments
+	_, errCh, _ := p.ExecuteString("f()")
+	assert.NotNil(t, <-errCh)
+	// Functions taking only the context are called without arguments
+	assert.Nil(t, p.LoadGo("alive", func(ctx gocontext.Context) bool { return ctx.Err() == nil }))
+	result, err = p.ExecuteContext(gocontext.Background(), compile(t, "alive()"))
+	assert.Nil(t, err)
+	assert.True(t, result.Bool())
+}
+
+type testPlasma_ToValueMethodErrors struct{}
+
+func (testPlasma_ToValueMethodErrors) Parse(s string) (int, error) {
+	return strconv.Atoi(s)
+}
+
+func TestPlasma_ToValueMethodErrorResult(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	assert.Nil(t, p.LoadGo("parser", testPlasma_ToValueMethodErrors{}))
+	rCh, errCh, _ := p.ExecuteString("parser.Parse('12')")
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, 12, Int[int](<-rCh))
+	_, errCh, _ = p.ExecuteString("parser.Parse('twelve')")
+	assert.ErrorIs(t, <-errCh, strconv.ErrSyntax)
+}
+
+func TestPlasma_ToValueFuncConvertArguments(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	type point struct {
+		X, Y int
+	}
+	f := func(scale *float64, points []*point, labels map[string]int, extra ...*point) int {
+		total := 0
+		for _, p := range append(points, extra...) {
+			total += p.X + p.Y
+		}
+		for _, value := range labels {
+			total += value
+		}
+		return int(float64(total) * *scale)
+	}
+	assert.Nil(t, p.LoadGo("f", f))
+	rCh, errCh, _ := p.ExecuteString(`p = Value()
+p.X = 1
+p.Y = 2
+f(2, [p, p], {"a": 10}, p, {"X": 5})`)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, 2*(3+3+10+3+5), Int[int](<-rCh))
+	// Conversion errors name the argument
+	_, errCh, _ = p.ExecuteString("f(2, 1, {})")
+	err := <-errCh
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "argument 2")
+	_, errCh, _ = p.ExecuteString("f(2)")
+	assert.NotNil(t, <-errCh)
+}
@@ -2,7 +2,9 @@ package vm
 
 import (
 	"bytes"
+	gocontext "context"
 	"fmt"
+	special_symbols "github.com/shoriwe/plasma/pkg/common/special-symbols"
 	"github.com/shoriwe/plasma/pkg/lexer"
 	"golang.org/x/exp/constraints"
 	"sync"
@@ -28,14 +30,22 @@ const (
 type (
 	TypeId   int
 	Callback func(argument ...*Value) (*Value, error)
-	FuncInfo struct {
+	/*
+		ContextCallback is a Callback receiving the context.Context of the execution calling it,
+		built-ins that block should stop when it is done
+	*/
+	ContextCallback func(ctx gocontext.Context, argument ...*Value) (*Value, error)
+	FuncInfo        struct {
+		Name      string // Empty for anonymous functions
 		Arguments []string
 		Bytecode  []byte
+		caches    *inlineCaches
 	}
 	ClassInfo struct {
 		prepared bool
 		Bases    []*Value
 		Bytecode []byte
+		caches   *inlineCaches
 	}
 	Value struct {
 		onDemand map[string]func(self *Value) *Value
@@ -44,9 +54,39 @@ type (
 		mutex    *sync.Mutex
 		v        any
 		vtable   *Symbols
+		frozen   bool
+		shared   bool // Used by every binding of an interned integer or literal constant at once
+		proxy    *goStruct
 	}
 )
 
+var typeIdNames = map[TypeId]string{
+	ValueId:           special_symbols.Value,
+	StringId:          special_symbols.String,
+	BytesId:           special_symbols.Bytes,
+	BoolId:            special_symbols.Bool,
+	NoneId:            special_symbols.None,
+	IntId:             special_symbols.Int,
+	FloatId:           special_symbols.Float,
+	ArrayId:           special_symbols.Array,
+	TupleId:           special_symbols.Tuple,
+	HashId:            special_symbols.Hash,
+	BuiltInFunctionId: special_symbols.Function,
+	FunctionId:        special_symbols.Function,
+	BuiltInClassId:    special_symbols.Class,
+	ClassId:           special_symbols.Class,
+}
+
+/*
+String returns the name of the built-in class of the type
+*/
+func (typeId TypeId) String() string {
+	if name, found := typeIdNames[typeId]; found {
+		return name
+	}
+	return fmt.Sprintf("TypeId(%d)", int(typeId))
+}
+
 func (plasma *Plasma) valueClass() *Value {
 	class := plasma.NewValue(plasma.rootSymbols, BuiltInClassId, plasma.class)
 	class.SetAny(Callback(func(argument ...*Value) (*Value, error) {
@@ -67,6 +107,78 @@ func (value *Value) TypeId() TypeId {
 	return value.typeId
 }
 
+/*
+Frozen reports if the value is immutable for scripts. Interned integers and literal constants are frozen,
+which allows sharing them between executions and goroutines, scripts assigning or deleting their attributes
+modify a copy bound in their place. Other frozen values reject those changes
+*/
+func (value *Value) Frozen() bool {
+	return value.frozen
+}
+
+/*
+Freeze makes the value and every value reachable from its elements, entries and attributes immutable for scripts,
+frozen arrays and hashes reject modifications. Values must be frozen before sharing them between goroutines
+*/
+func (value *Value) Freeze() {
+	value.freeze(map[*Value]struct{}{})
+}
+
+func (value *Value) freeze(visited map[*Value]struct{}) {
+	if _, found := visited[value]; found || value.proxy != nil || value.shared {
+		return
+	}
+	visited[value] = struct{}{}
+	value.mutex.Lock()
+	value.frozen = true
+	typeId, v, vtable := value.typeId, value.v, value.vtable
+	value.mutex.Unlock()
+	switch typeId {
+	case ArrayId, TupleId:
+		for _, element := range v.([]*Value) {
+			element.freeze(visited)
+		}
+	case HashId:
+		hash := v.(*Hash)
+		hash.mutex.Lock()
+		entries := make([]HashKeyValue, 0, len(hash.internalMap))
+		for _, entry := range hash.internalMap {
+			entries = append(entries, entry)
+		}
+		hash.mutex.Unlock()
+		for _, entry := range entries {
+			entry.Key.freeze(visited)
+			entry.Value.freeze(visited)
+		}
+	case ValueId:
+		for _, attribute := range vtable.Values() {
+			attribute.freeze(visited)
+		}
+	}
+}
+
+/*
+copyPrimitive allocates a new value equal to the primitive value, the copy is neither frozen nor shared
+except for booleans and None, which are always frozen. Other values are returned untouched
+*/
+func (plasma *Plasma) copyPrimitive(value *Value) *Value {
+	switch value.TypeId() {
+	case IntId:
+		return plasma.newInt(value.GetInt64())
+	case FloatId:
+		return plasma.NewFloat(value.GetFloat64())
+	case StringId:
+		return plasma.NewString(value.GetBytes())
+	case BytesId:
+		return plasma.NewBytes(value.GetBytes())
+	case BoolId:
+		return plasma.NewBool(value.GetBool())
+	case NoneId:
+		return plasma.NewNone()
+	}
+	return value
+}
+
 func (value *Value) VirtualTable() *Symbols {
 	value.mutex.Lock()
 	defer value.mutex.Unlock()
@@ -89,14 +201,33 @@ func (value *Value) GetHash() *Hash {
 }
 
 /*
-GetCallback cast the internal value to Callback
+GetCallback cast the internal value to Callback, ContextCallback functions are called with a background context
 */
 func (value *Value) GetCallback() Callback {
 	value.mutex.Lock()
 	defer value.mutex.Unlock()
+	if callback, isContextCallback := value.v.(ContextCallback); isContextCallback {
+		return func(argument ...*Value) (*Value, error) {
+			return callback(gocontext.Background(), argument...)
+		}
+	}
 	return value.v.(Callback)
 }
 
+/*
+GetContextCallback cast the internal value to ContextCallback, plain Callback functions ignore the context
+*/
+func (value *Value) GetContextCallback() ContextCallback {
+	value.mutex.Lock()
+	defer value.mutex.Unlock()
+	if callback, isCallback := value.v.(Callback); isCallback {
+		return func(_ gocontext.Context, argument ...*Value) (*Value, error) {
+			return callback(argument...)
+		}
+	}
+	return value.v.(ContextCallback)
+}
+
 /*
 GetValues cast the internal value to []*Value
 */
@@ -170,16 +301,35 @@ func (value *Value) GetAny() any {
 }
 
 /*
-Set a plasma *Value to a symbol inside the Object
+Set a plasma *Value to a symbol inside the Object.
+Fields of Go structs ignore values that cannot be converted to the field type
 */
 func (value *Value) Set(symbol string, v *Value) {
+	_ = value.assign(symbol, v)
+}
+
+/*
+assign sets the symbol like Set, reporting the values that cannot be stored in a Go struct field
+*/
+func (value *Value) assign(symbol string, v *Value) error {
+	if value.proxy != nil {
+		if found, err := value.proxy.set(symbol, v); found {
+			return err
+		}
+	}
 	value.vtable.Set(symbol, v)
+	return nil
 }
 
 /*
 Get Retrieves the value named as the symbol
 */
 func (value *Value) Get(symbol string) (*Value, error) {
+	if value.proxy != nil {
+		if result, found, err := value.proxy.get(symbol); found {
+			return result, err
+		}
+	}
 	result, getError := value.vtable.Get(symbol)
 	if getError == nil {
 		return result, nil
@@ -199,6 +349,11 @@ func (value *Value) Get(symbol string) (*Value, error) {
 Del deletes the reference of the value named by the symbol
 */
 func (value *Value) Del(symbol string) error {
+	if value.proxy != nil {
+		if _, found := value.proxy.fields[symbol]; found {
+			return fmt.Errorf("%w: Go struct field %s", ErrImmutableValue, symbol)
+		}
+	}
 	return value.vtable.Del(symbol)
 }
 
@@ -602,7 +757,7 @@ func (value *Value) ClassEqual(other *Value) bool {
 NewValue Creates a new Value
 */
 func (plasma *Plasma) NewValue(parent *Symbols, typeId TypeId, class *Value) *Value {
-	return &Value{
+	result := &Value{
 		onDemand: plasma.onDemand,
 		class:    class,
 		typeId:   typeId,
@@ -610,4 +765,24 @@ func (plasma *Plasma) NewValue(parent *Symbols, typeId TypeId, class *Value) *Va
 		v:        nil,
 		vtable:   NewSymbols(parent),
 	}
+	result.vtable.owner = result
+	return result
+}
+
+/*
+receiver returns the value the built-in method was created for and the name the method has in it
+*/
+func (value *Value) receiver() (*Value, string, bool) {
+	value.mutex.Lock()
+	typeId, vtable := value.typeId, value.vtable
+	value.mutex.Unlock()
+	if typeId != BuiltInFunctionId || vtable == nil || vtable.Parent == nil || vtable.Parent.owner == nil {
+		return nil, "", false
+	}
+	for name, method := range vtable.Parent.Values() {
+		if method == value {
+			return vtable.Parent.owner, name, true
+		}
+	}
+	return nil, "", false
 }
@@ -0,0 +1,330 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/shoriwe/plasma/pkg/common"
+)
+
+const unknownStackDepth int64 = -1
+
+type (
+	verifyInstruction struct {
+		offset     int64
+		op         byte
+		pops       int64
+		pushes     int64
+		jump       int64
+		hasJump    bool
+		terminates bool
+	}
+	verifier struct {
+		bytecode     []byte
+		index        int64
+		instructions []verifyInstruction
+		boundaries   map[int64]int
+	}
+)
+
+func newVerifier(bytecode []byte) *verifier {
+	return &verifier{
+		bytecode:     bytecode,
+		index:        0,
+		instructions: nil,
+		boundaries:   map[int64]int{},
+	}
+}
+
+func (v *verifier) errorf(offset int64, format string, a ...any) error {
+	return fmt.Errorf("%w: offset %d: %s", ErrInvalidBytecode, offset, fmt.Sprintf(format, a...))
+}
+
+func (v *verifier) remaining() int64 {
+	return int64(len(v.bytecode)) - v.index
+}
+
+func (v *verifier) readInt(offset int64) (int64, error) {
+	if v.remaining() < 8 {
+		return 0, v.errorf(offset, "truncated operand")
+	}
+	value := common.BytesToInt(v.bytecode[v.index : v.index+8])
+	v.index += 8
+	return value, nil
+}
+
+func (v *verifier) readLength(offset int64) (int64, error) {
+	length, readError := v.readInt(offset)
+	if readError != nil {
+		return 0, readError
+	}
+	if length < 0 || length > v.remaining() {
+		return 0, v.errorf(offset, "length %d out of bounds", length)
+	}
+	return length, nil
+}
+
+func (v *verifier) readCount(offset int64) (int64, error) {
+	count, readError := v.readInt(offset)
+	if readError != nil {
+		return 0, readError
+	}
+	if count < 0 || count > int64(len(v.bytecode)) {
+		return 0, v.errorf(offset, "count %d out of bounds", count)
+	}
+	return count, nil
+}
+
+func (v *verifier) readSymbol(offset int64) error {
+	symbolLength, readError := v.readLength(offset)
+	if readError != nil {
+		return readError
+	}
+	v.index += symbolLength
+	return nil
+}
+
+func (v *verifier) readBody(offset int64) error {
+	bodyLength, readError := v.readLength(offset)
+	if readError != nil {
+		return readError
+	}
+	body := v.bytecode[v.index : v.index+bodyLength]
+	v.index += bodyLength
+	if verifyError := verifyBody(body); verifyError != nil {
+		return fmt.Errorf("in body at offset %d: %w", offset, verifyError)
+	}
+	return nil
+}
+
+func (v *verifier) decode() error {
+	for v.index < int64(len(v.bytecode)) {
+		instruction := verifyInstruction{
+			offset: v.index,
+			op:     v.bytecode[v.index],
+		}
+		v.index++
+		var decodeError error
+		switch instruction.op {
+		case opcodes.Push:
+			instruction.pushes = 1
+		case opcodes.Pop:
+			instruction.pops = 1
+		case opcodes.IdentifierAssign:
+			instruction.pops = 1
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.SelectorAssign:
+			instruction.pops = 2
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.Label, opcodes.Line:
+			_, decodeError = v.readInt(instruction.offset)
+		case opcodes.Jump:
+			var jump int64
+			jump, decodeError = v.readInt(instruction.offset)
+			instruction.jump = instruction.offset + jump
+			instruction.hasJump = true
+			instruction.terminates = true
+		case opcodes.IfJump:
+			var jump int64
+			jump, decodeError = v.readInt(instruction.offset)
+			instruction.pops = 1
+			instruction.jump = instruction.offset + jump
+			instruction.hasJump = true
+		case opcodes.Return:
+			instruction.pops = 1
+			instruction.terminates = true
+		case opcodes.DeleteIdentifier:
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.DeleteSelector:
+			instruction.pops = 1
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.Defer:
+			decodeError = v.readBody(instruction.offset)
+		case opcodes.NewFunction:
+			var numberOfArguments int64
+			decodeError = v.readSymbol(instruction.offset)
+			if decodeError == nil {
+				numberOfArguments, decodeError = v.readCount(instruction.offset)
+			}
+			for i := int64(0); decodeError == nil && i < numberOfArguments; i++ {
+				decodeError = v.readSymbol(instruction.offset)
+			}
+			if decodeError == nil {
+				decodeError = v.readBody(instruction.offset)
+			}
+		case opcodes.NewClass:
+			instruction.pops, decodeError = v.readCount(instruction.offset)
+			if decodeError == nil {
+				decodeError = v.readBody(instruction.offset)
+			}
+		case opcodes.Call:
+			instruction.pops, decodeError = v.readCount(instruction.offset)
+			instruction.pops++ // The function itself
+		case opcodes.NewArray, opcodes.NewTuple:
+			instruction.pops, decodeError = v.readCount(instruction.offset)
+		case opcodes.NewHash:
+			instruction.pops, decodeError = v.readCount(instruction.offset)
+			instruction.pops *= 2 // Key and value
+		case opcodes.Identifier:
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.Integer, opcodes.Float:
+			_, decodeError = v.readInt(instruction.offset)
+		case opcodes.String, opcodes.Bytes:
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.True, opcodes.False, opcodes.None:
+			break
+		case opcodes.Selector:
+			instruction.pops = 1
+			decodeError = v.readSymbol(instruction.offset)
+		case opcodes.Add, opcodes.Sub, opcodes.Mul, opcodes.Div, opcodes.FloorDiv, opcodes.Modulus, opcodes.PowerOf,
+			opcodes.BitwiseOr, opcodes.BitwiseXor, opcodes.BitwiseAnd, opcodes.BitwiseLeft, opcodes.BitwiseRight,
+			opcodes.Equal, opcodes.NotEqual, opcodes.GreaterThan, opcodes.GreaterOrEqualThan, opcodes.LessThan,
+			opcodes.LessOrEqualThan:
+			instruction.pops = 2
+		case opcodes.Super:
+			decodeError = v.errorf(instruction.offset, "opcode %s is not supported by the VM", opcodes.OpCodes[instruction.op])
+		default:
+			decodeError = v.errorf(instruction.offset, "unknown opcode %d", instruction.op)
+		}
+		if decodeError != nil {
+			return decodeError
+		}
+		v.boundaries[instruction.offset] = len(v.instructions)
+		v.instructions = append(v.instructions, instruction)
+	}
+	return nil
+}
+
+func (v *verifier) checkJumps() error {
+	bytecodeLength := int64(len(v.bytecode))
+	for _, instruction := range v.instructions {
+		if !instruction.hasJump {
+			continue
+		}
+		if instruction.jump == bytecodeLength {
+			continue
+		}
+		if _, found := v.boundaries[instruction.jump]; !found {
+			return v.errorf(instruction.offset, "jump target %d is not an instruction boundary", instruction.jump)
+		}
+	}
+	return nil
+}
+
+/*
+checkStack propagates the operand stack depth through the control flow of the body,
+rejecting instructions that pop values the body never pushed and merge points
+reached with different depths
+*/
+func (v *verifier) checkStack() error {
+	if len(v.instructions) == 0 {
+		return nil
+	}
+	depths := make([]int64, len(v.instructions))
+	for index := range depths {
+		depths[index] = unknownStackDepth
+	}
+	depths[0] = 0
+	pending := []int{0}
+	propagate := func(from verifyInstruction, target int, depth int64) error {
+		switch depths[target] {
+		case unknownStackDepth:
+			depths[target] = depth
+			pending = append(pending, target)
+		case depth:
+			break
+		default:
+			return v.errorf(
+				from.offset,
+				"stack depth %d conflicts with depth %d at offset %d",
+				depth, depths[target], v.instructions[target].offset,
+			)
+		}
+		return nil
+	}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		instruction := v.instructions[current]
+		depth := depths[current]
+		if depth < instruction.pops {
+			return v.errorf(instruction.offset, "%s pops %d values but the stack holds %d",
+				opcodes.OpCodes[instruction.op], instruction.pops, depth)
+		}
+		depth = depth - instruction.pops + instruction.pushes
+		if instruction.hasJump {
+			if target, found := v.boundaries[instruction.jump]; found {
+				if propagateError := propagate(instruction, target, depth); propagateError != nil {
+					return propagateError
+				}
+			}
+		}
+		if !instruction.terminates && current+1 < len(v.instructions) {
+			if propagateError := propagate(instruction, current+1, depth); propagateError != nil {
+				return propagateError
+			}
+		}
+	}
+	return nil
+}
+
+func verifyBody(bytecode []byte) error {
+	v := newVerifier(bytecode)
+	if decodeError := v.decode(); decodeError != nil {
+		return decodeError
+	}
+	if jumpError := v.checkJumps(); jumpError != nil {
+		return jumpError
+	}
+	return v.checkStack()
+}
+
+/*
+programBody checks the header the assembler writes at the start of the programs and returns the instructions
+following it. Bytecode without it was compiled by a version of plasma older than the format header
+*/
+func programBody(bytecode []byte) ([]byte, error) {
+	if len(bytecode) < opcodes.HeaderLength || string(bytecode[:len(opcodes.Magic)]) != opcodes.Magic {
+		return nil, fmt.Errorf("%w: missing format header, compile the script again", ErrBytecodeVersion)
+	}
+	version := common.BytesToInt(bytecode[len(opcodes.Magic):opcodes.HeaderLength])
+	if version != opcodes.FormatVersion {
+		return nil, fmt.Errorf(
+			"%w: bytecode has format version %d but the VM executes version %d, compile the script again",
+			ErrBytecodeVersion, version, opcodes.FormatVersion,
+		)
+	}
+	return bytecode[opcodes.HeaderLength:], nil
+}
+
+/*
+Verify checks the format header of the bytecode and walks every instruction after it, including nested
+function, class and defer bodies. It checks that operands are inside the bytecode bounds, jump targets land
+on instruction boundaries and the operand stack never underflows. Offsets in its errors start after the header.
+Use it before executing bytecode received from untrusted sources
+*/
+func Verify(bytecode []byte) error {
+	body, headerError := programBody(bytecode)
+	if headerError != nil {
+		return headerError
+	}
+	return verifyBody(body)
+}
+
+/*
+verifyFrame checks the bytecode of a code frame restored by LoadExecution. The operand stack is not checked
+since frames use values pushed by their callers, rip must be an instruction boundary or the end of the code,
+after the end while its defer blocks run
+*/
+func verifyFrame(bytecode []byte, rip int64) error {
+	v := newVerifier(bytecode)
+	if decodeError := v.decode(); decodeError != nil {
+		return decodeError
+	}
+	if jumpError := v.checkJumps(); jumpError != nil {
+		return jumpError
+	}
+	if _, found := v.boundaries[rip]; !found && rip != int64(len(bytecode)) && rip != int64(len(bytecode))+1 {
+		return v.errorf(rip, "rip is not an instruction boundary")
+	}
+	return nil
+}
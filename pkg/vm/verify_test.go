@@ -0,0 +1,118 @@
+package vm
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"github.com/shoriwe/plasma/pkg/bytecode/opcodes"
+	"github.com/shoriwe/plasma/pkg/common"
+	"github.com/shoriwe/plasma/pkg/compiler"
+	"github.com/shoriwe/plasma/pkg/test-samples/success"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/*
+program prepends the format header to the instructions
+*/
+func program(instructions []byte) []byte {
+	result := append([]byte(opcodes.Magic), common.IntToBytes(opcodes.FormatVersion)...)
+	return append(result, instructions...)
+}
+
+func TestVerifySampleScripts(t *testing.T) {
+	for index := 1; index <= len(success.Samples); index++ {
+		sampleScript := fmt.Sprintf("sample-%d.pm", index)
+		bytecode, compileError := compiler.Compile(success.Samples[sampleScript].Code)
+		assert.Nil(t, compileError)
+		assert.Nil(t, Verify(bytecode), sampleScript)
+	}
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	bytecode, compileError := compiler.Compile("a = 'Plasma'\nprintln(a)")
+	assert.Nil(t, compileError)
+	for length := 1; length < len(bytecode); length++ {
+		verifyError := Verify(bytecode[:length])
+		if verifyError == nil {
+			// Truncation can land on an instruction boundary
+			continue
+		}
+		assert.True(t, errors.Is(verifyError, ErrInvalidBytecode))
+	}
+	assert.NotNil(t, Verify(program([]byte{opcodes.String, 0, 0, 0, 0, 0, 0, 0, 100, 'a'})))
+}
+
+func TestVerifyBadJump(t *testing.T) {
+	bytecode := []byte{opcodes.Jump}
+	bytecode = append(bytecode, common.IntToBytes(3)...)
+	bytecode = append(bytecode, opcodes.None)
+	assert.NotNil(t, Verify(program(bytecode)))
+	bytecode = []byte{opcodes.Jump}
+	bytecode = append(bytecode, common.IntToBytes(9)...)
+	bytecode = append(bytecode, opcodes.None)
+	assert.Nil(t, Verify(program(bytecode)))
+}
+
+func TestVerifyStackUnderflow(t *testing.T) {
+	assert.NotNil(t, Verify(program([]byte{opcodes.Pop})))
+	bytecode := []byte{opcodes.None, opcodes.Push, opcodes.Call}
+	bytecode = append(bytecode, common.IntToBytes(2)...)
+	assert.NotNil(t, Verify(program(bytecode)))
+}
+
+func TestPlasma_ExecuteVerified(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	rCh, errCh, _ := p.ExecuteVerified(program([]byte{opcodes.Integer, 0, 0}))
+	assert.NotNil(t, <-errCh)
+	assert.Nil(t, <-rCh)
+	bytecode, compileError := compiler.Compile("1 + 2")
+	assert.Nil(t, compileError)
+	rCh, errCh, _ = p.ExecuteVerified(bytecode)
+	assert.Nil(t, <-errCh)
+	assert.Equal(t, int64(3), (<-rCh).GetInt64())
+}
+
+func TestVerifyFormatHeader(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	bytecode, compileError := compiler.Compile("1 + 2")
+	assert.Nil(t, compileError)
+	assert.Equal(t, opcodes.Magic, string(bytecode[:len(opcodes.Magic)]))
+	assert.Nil(t, Verify(bytecode))
+	headerless := bytecode[opcodes.HeaderLength:]
+	outdated := append([]byte(opcodes.Magic), common.IntToBytes(opcodes.FormatVersion-1)...)
+	outdated = append(outdated, headerless...)
+	for _, invalid := range [][]byte{nil, headerless, outdated} {
+		assert.ErrorIs(t, Verify(invalid), ErrBytecodeVersion)
+		assert.ErrorIs(t, Verify(invalid), ErrInvalidBytecode)
+		_, executeError := p.ExecuteContext(gocontext.Background(), invalid)
+		assert.ErrorIs(t, executeError, ErrBytecodeVersion)
+		_, errCh, _ := p.Execute(invalid)
+		assert.ErrorIs(t, <-errCh, ErrBytecodeVersion)
+	}
+	assert.Contains(t, Verify(outdated).Error(), fmt.Sprintf("format version %d", opcodes.FormatVersion-1))
+	result, executeError := p.ExecuteContext(gocontext.Background(), bytecode)
+	assert.Nil(t, executeError)
+	assert.Equal(t, int64(3), result.GetInt64())
+}
+
+func TestExecuteOptions_Verify(t *testing.T) {
+	p := NewVM(nil, nil, nil)
+	invalid := program([]byte{opcodes.Pop})
+	options := ExecuteOptions{Verify: true}
+	_, executeError := p.ExecuteWithOptions(gocontext.Background(), invalid, options)
+	assert.ErrorIs(t, executeError, ErrInvalidBytecode)
+	_, runError := p.NewExecution(invalid, options).Run(gocontext.Background())
+	assert.ErrorIs(t, runError, ErrInvalidBytecode)
+	_, captureError := p.ExecuteCaptured(gocontext.Background(), invalid, options)
+	assert.ErrorIs(t, captureError, ErrInvalidBytecode)
+
+	bytecode, compileError := compiler.Compile("1 + 2")
+	assert.Nil(t, compileError)
+	result, executeError := p.ExecuteWithOptions(gocontext.Background(), bytecode, options)
+	assert.Nil(t, executeError)
+	assert.Equal(t, int64(3), result.GetInt64())
+	result, runError = p.NewExecution(bytecode, options).Run(gocontext.Background())
+	assert.Nil(t, runError)
+	assert.Equal(t, int64(3), result.GetInt64())
+}
@@ -1,13 +1,30 @@
 package vm
 
 import (
+	gocontext "context"
 	"fmt"
 	"github.com/shoriwe/plasma/pkg/compiler"
 	"io"
+	"sync"
+	"sync/atomic"
 )
 
 type (
 	Loader func(plasma *Plasma) *Value
+	/*
+		ExecuteOptions configures a single execution started with ExecuteWithOptions,
+		when Scope is nil the execution uses the root symbols as global symbol table.
+		Stdin, Stdout and Stderr replace the streams of the VM for the built-ins called by the execution,
+		the ones left nil use the streams of the VM. Verify checks the bytecode with Verify before executing it,
+		set it for bytecode received from untrusted sources
+	*/
+	ExecuteOptions struct {
+		Limits         Limits
+		Scope          *Symbols
+		Stdin          io.Reader
+		Stdout, Stderr io.Writer
+		Verify         bool
+	}
 	Plasma struct {
 		Stdin             io.Reader
 		Stdout, Stderr    io.Writer
@@ -26,6 +43,18 @@ type (
 		hash              *Value
 		function          *Value
 		class             *Value
+		smallInts         [maxSmallInt - minSmallInt + 1]atomic.Value
+		profile           Profile
+		hooks             atomic.Value
+		debugger          atomic.Value
+		limits            Limits
+		streamBuiltins    map[string]*Value // Built-ins of ioSymbols bound to the streams of this VM
+		stdin             *stdinBuffer      // Shared with the forks of the VM
+		ownStdin          stdinBuffer       // Used when Stdin is not the stream of stdin
+		bindings          *sync.Map         // Values installed by NewVM, Load and LoadGo to the name of their global
+		adapters          *sync.Map         // Interface types to the adapters registered with RegisterInterface
+		stopped           chan struct{}
+		stopOnce          sync.Once
 	}
 )
 
@@ -93,43 +122,136 @@ func (plasma *Plasma) MetaClass() *Value {
 	return plasma.class
 }
 
-func (plasma *Plasma) executeCtx(ctx *context) {
+/*
+executionError converts values recovered from panics raised by the execution to errors, keeping
+error values in the chain so they can be matched with errors.Is
+*/
+func executionError(err any) error {
+	if asError, isError := err.(error); isError {
+		return fmt.Errorf("execution error: %w", asError)
+	}
+	return fmt.Errorf("execution error: %v", err)
+}
+
+/*
+run executes the context until its code finishes, it is stopped, suspended or its context.Context is done,
+panics raised by the execution are returned as errors
+*/
+func (plasma *Plasma) run(ctx *context) (runError error) {
 	defer func() {
 		err := recover()
 		if err != nil {
-			ctx.err <- fmt.Errorf("execution error: %v", err)
-		} else {
-			ctx.err <- nil
+			runError = executionError(err)
+		}
+		if flushError := plasma.flush(ctx.goContext); flushError != nil && runError == nil {
+			runError = flushError
+		}
+		if runError != nil && runError != ErrSuspended && ctx.hooks != nil {
+			ctx.hooks.error(ctx, runError)
 		}
-		ctx.result <- ctx.register
-		return
 	}()
+	if ctx.bytecodeError != nil {
+		return ctx.bytecodeError
+	}
+	done := ctx.goContext.Done()
 	for ctx.hasNext() {
 		select {
 		case <-ctx.stop:
-			return
+			return nil
+		case <-done:
+			return cancellationError(ctx.goContext)
+		case <-ctx.stopped:
+			return ErrStopped
+		case <-ctx.suspend:
+			return ErrSuspended
 		default:
-			plasma.do(ctx)
+			if ctx.hooks != nil {
+				ctx.hooks.instruction(ctx)
+			}
+			if ctx.limits != nil {
+				ctx.limits.instruction()
+				plasma.do(ctx)
+				ctx.limits.checkSize(ctx.register)
+			} else {
+				plasma.do(ctx)
+			}
+			if ctx.suspended {
+				return ErrSuspended
+			}
 		}
 	}
+	return nil
 }
 
+/*
+Stop aborts every running execution, call and callback of the VM with ErrStopped, the ones started
+later fail immediately. A stopped VM can not be restarted
+*/
+func (plasma *Plasma) Stop() {
+	plasma.stopOnce.Do(func() {
+		close(plasma.stopped)
+	})
+}
+
+func (plasma *Plasma) executeCtx(ctx *context) {
+	ctx.err <- plasma.run(ctx)
+	ctx.result <- ctx.register
+}
+
+/*
+Load installs the value returned by the loader as a global, like LoadGo the value is frozen
+*/
 func (plasma *Plasma) Load(symbol string, loader Loader) {
-	plasma.rootSymbols.Set(symbol, loader(plasma))
+	plasma.bind(symbol, loader(plasma))
 }
 
+/*
+LoadGo converts the Go value with ToValue and installs it as a global. Bindings are shared by every scope and
+fork of the VM, so the value is frozen with Freeze and scripts can not modify it. Pointers to Go structs stay
+writable, since their fields are the ones of the Go value
+*/
 func (plasma *Plasma) LoadGo(symbol string, v any) error {
 	pv, err := plasma.ToValue(plasma.RootSymbols(), v)
 	if err != nil {
 		return err
 	}
-	plasma.rootSymbols.Set(symbol, pv)
+	plasma.bind(symbol, pv)
 	return nil
 }
 
+/*
+bind freezes the value and installs it as a global, shared values are copied first so freezing them
+does not turn every equal literal into a binding
+*/
+func (plasma *Plasma) bind(symbol string, value *Value) {
+	if value.shared {
+		value = plasma.copyPrimitive(value)
+	}
+	value.Freeze()
+	plasma.bindings.Store(value, symbol)
+	plasma.rootSymbols.Set(symbol, value)
+}
+
 func (plasma *Plasma) Execute(bytecode []byte) (result chan *Value, err chan error, stop chan struct{}) {
+	return plasma.ExecuteIn(plasma.rootSymbols, bytecode)
+}
+
+/*
+NewScope creates a global symbol table layered over the root symbols. Scripts executed in it can read
+the built-ins and loaded Go bindings, which are frozen so no scope can modify them, while their own
+globals stay in the scope
+*/
+func (plasma *Plasma) NewScope() *Symbols {
+	return NewSymbols(plasma.rootSymbols)
+}
+
+/*
+ExecuteIn is Execute using the scope as global symbol table, use NewScope to isolate concurrent executions
+*/
+func (plasma *Plasma) ExecuteIn(scope *Symbols, bytecode []byte) (result chan *Value, err chan error, stop chan struct{}) {
 	// Create new context
 	ctx := plasma.newContext(bytecode)
+	ctx.currentSymbols = scope
 	ctx.result = make(chan *Value, 1)
 	ctx.err = make(chan error, 1)
 	ctx.stop = make(chan struct{}, 1)
@@ -138,6 +260,62 @@ func (plasma *Plasma) Execute(bytecode []byte) (result chan *Value, err chan err
 	return ctx.result, ctx.err, ctx.stop
 }
 
+/*
+ExecuteContext executes the bytecode in the calling goroutine and returns its result. When the context.Context
+is cancelled or its deadline expires the execution is aborted with ErrCancelled or context.DeadlineExceeded,
+built-ins blocked on input or channels are aborted too
+*/
+func (plasma *Plasma) ExecuteContext(goContext gocontext.Context, bytecode []byte) (*Value, error) {
+	return plasma.ExecuteWithOptions(goContext, bytecode, ExecuteOptions{})
+}
+
+/*
+ExecuteWithOptions is ExecuteContext with per execution options. Executions exceeding any of the limits
+fail with an error wrapping ErrLimitExceeded and the error of the specific limit, like ErrInstructionLimit
+*/
+func (plasma *Plasma) ExecuteWithOptions(goContext gocontext.Context, bytecode []byte, options ExecuteOptions) (*Value, error) {
+	if goContext.Err() != nil {
+		return nil, cancellationError(goContext)
+	}
+	ctx := plasma.newContext(bytecode)
+	ctx.goContext = withStreams(goContext, newExecutionStreams(executionStreamsOf(goContext), options))
+	if options.Verify && ctx.bytecodeError == nil {
+		ctx.bytecodeError = Verify(bytecode)
+	}
+	if options.Limits != (Limits{}) {
+		ctx.limits = newExecutionLimits(options.Limits)
+	}
+	if options.Scope != nil {
+		ctx.currentSymbols = options.Scope
+	}
+	runError := plasma.run(ctx)
+	if runError != nil {
+		return nil, runError
+	}
+	return ctx.register, nil
+}
+
+/*
+ExecuteVerified checks the bytecode with Verify before executing it, malformed bytecode is reported
+through the error channel instead of crashing the VM
+*/
+func (plasma *Plasma) ExecuteVerified(bytecode []byte) (result chan *Value, err chan error, stop chan struct{}) {
+	verifyError := Verify(bytecode)
+	// Create new context
+	ctx := plasma.newContext(bytecode)
+	ctx.result = make(chan *Value, 1)
+	ctx.err = make(chan error, 1)
+	ctx.stop = make(chan struct{}, 1)
+	if verifyError != nil {
+		ctx.result <- nil
+		ctx.err <- verifyError
+	} else {
+		// Execute bytecode with context
+		go plasma.executeCtx(ctx)
+	}
+	return ctx.result, ctx.err, ctx.stop
+}
+
 func (plasma *Plasma) ExecuteString(scriptCode string) (result chan *Value, err chan error, stop chan struct{}) {
 	bytecode, compileError := compiler.Compile(scriptCode)
 	// Create new context
@@ -155,13 +333,29 @@ func (plasma *Plasma) ExecuteString(scriptCode string) (result chan *Value, err
 	return ctx.result, ctx.err, ctx.stop
 }
 
-func NewVM(stdin io.Reader, stdout, stderr io.Writer) *Plasma {
+/*
+NewVM creates a new VM, by default every built-in is installed. Use the options to restrict its capabilities
+*/
+func NewVM(stdin io.Reader, stdout, stderr io.Writer, options ...Option) *Plasma {
 	plasma := &Plasma{
 		Stdin:       stdin,
 		Stdout:      stdout,
 		Stderr:      stderr,
 		rootSymbols: NewSymbols(nil),
+		stopped:     make(chan struct{}),
+		bindings:    &sync.Map{},
+		adapters:    &sync.Map{},
+		stdin:       &stdinBuffer{},
 	}
 	plasma.init()
+	for name, value := range plasma.rootSymbols.values {
+		value.Freeze()
+		plasma.bindings.Store(value, name)
+	}
+	config := &vmOptions{profile: ProfileFull}
+	for _, option := range options {
+		option(config)
+	}
+	plasma.applyOptions(config)
 	return plasma
 }
@@ -6,8 +6,8 @@ import (
 	"io"
 )
 
-func NewVM(stdin io.Reader, stdout io.Writer, stderr io.Writer) *vm.Plasma {
-	return vm.NewVM(stdin, stdout, stderr)
+func NewVM(stdin io.Reader, stdout io.Writer, stderr io.Writer, options ...vm.Option) *vm.Plasma {
+	return vm.NewVM(stdin, stdout, stderr, options...)
 }
 
 func Compile(scriptCode string) ([]byte, error) {